@@ -0,0 +1,25 @@
+package main
+
+import (
+	"cryptoRestTest/internal/fakeexchange"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Локальная замена websocket стрима Binance для провайдера binance_ws.
+// Запуск: go run ./cmd/fakeexchange -addr :8091, в config.yaml stream.url: "ws://localhost:8091/ws"
+func main() {
+	addr := flag.String("addr", ":8091", "address to listen on")
+	interval := flag.Duration("interval", time.Second, "how often tickers are sent")
+	dropAfter := flag.Duration("drop-after", 0, "close every connection after this time to test reconnects, 0 to keep")
+	seed := flag.Int64("seed", 1, "seed for price moves")
+	flag.Parse()
+
+	log.Printf("fake exchange stream listening on %s/ws, interval %s", *addr, *interval)
+	err := http.ListenAndServe(*addr, fakeexchange.NewServer(*interval, *dropAfter, *seed))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
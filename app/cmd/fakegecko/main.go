@@ -0,0 +1,23 @@
+package main
+
+import (
+	"cryptoRestTest/internal/fakegecko"
+	"flag"
+	"log"
+	"net/http"
+)
+
+// Локальная замена CoinGecko для CI и работы без сети.
+// Запуск: go run ./cmd/fakegecko -addr :8090, в config.yaml coingecko.base_url: "http://localhost:8090"
+func main() {
+	addr := flag.String("addr", ":8090", "address to listen on")
+	mode := flag.String("mode", fakegecko.ModeDeterministic, "price mode: deterministic, random_walk")
+	seed := flag.Int64("seed", 1, "seed for random_walk mode")
+	flag.Parse()
+
+	log.Printf("fake coingecko listening on %s, mode %s", *addr, *mode)
+	err := http.ListenAndServe(*addr, fakegecko.NewServer(*mode, *seed))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -5,6 +5,11 @@ import (
 	_ "cryptoRestTest/docs" //документы для swagger
 	"cryptoRestTest/domain"
 	coingecko "cryptoRestTest/gates/providers"
+	"cryptoRestTest/gates/providers/breaker"
+	"cryptoRestTest/gates/providers/consensus"
+	"cryptoRestTest/gates/providers/registry"
+	"cryptoRestTest/gates/providers/replay"
+	"cryptoRestTest/gates/providers/stream"
 	"cryptoRestTest/gates/server"
 	"cryptoRestTest/gates/storage"
 	"cryptoRestTest/internal/config"
@@ -14,9 +19,14 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" //драйвер postgres
 	goose "github.com/pressly/goose/v3"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata" //часовые пояса для tz, в образе alpine их нет
 )
 
 //@title Crypto_REST_test
@@ -27,6 +37,10 @@ import (
 // @BasePath /
 
 func main() {
+	//контекст приложения, отменяется по Ctrl+C или SIGTERM от докера
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	//инициализация конфига
 	cfg := config.MustLoad()
 
@@ -54,25 +68,34 @@ func main() {
 	if migrationsPath == "" {
 		migrationsPath = "./gates\\storage\\migrations"
 	}
+	if os.Getenv("MIGRATIONS_CURRENCY") == "" { //в этой валюте хранились цены до появления колонки currency
+		os.Setenv("MIGRATIONS_CURRENCY", cfg.CoinsWatcher.Currency.Default())
+	}
 	//err = goose.Down(conn.DB, migrationsPath)
 	err = goose.Up(conn.DB, migrationsPath)
 	if err != nil {
 		panic(err)
 	}
 
-	//инициализация provider client
-	provider := coingecko.NewClient(context.Background(), cfg, log)
+	//инициализация провайдеров цен
+	provider := mustBuildProvider(ctx, cfg, log, store)
 
 	//инициализация watcher
-	watcher := domain.NewWatcher(context.Background(), store, log, provider, cfg)
+	watcher := domain.NewWatcher(store, log, provider, cfg)
 
 	//запуск горутины по отслеживанию монет
 	go func(watcher *domain.Watcher) {
 		observeTicker := time.NewTicker(cfg.CoinsWatcher.Cooldown)
+		defer observeTicker.Stop()
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case <-observeTicker.C:
-				err = watcher.ScanPrices()
+				//скан не должен наезжать на следующий тик
+				scanCtx, cancel := context.WithTimeout(ctx, cfg.CoinsWatcher.Cooldown)
+				err := watcher.ScanPrices(scanCtx)
+				cancel()
 				if err != nil {
 					log.Warn("------------------WARNING, ScanPrices failed!--------------------------")
 				}
@@ -80,12 +103,125 @@ func main() {
 		}
 	}(watcher)
 
+	//запуск горутины по записи курсов валют для convert_to
+	if cfg.FX.Enabled {
+		go func(watcher *domain.Watcher) {
+			fxTicker := time.NewTicker(cfg.FX.Interval)
+			defer fxTicker.Stop()
+			for {
+				//первые курсы пишутся сразу, чтобы пересчёт работал не через час после запуска
+				fxCtx, cancel := context.WithTimeout(ctx, cfg.CoinsWatcher.Timeout)
+				err := watcher.RecordFXRates(fxCtx)
+				cancel()
+				if err != nil {
+					log.Warn("failed to record fx rates", "error", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-fxTicker.C:
+				}
+			}
+		}(watcher)
+	}
+
+	//запуск горутины по обновлению описания монет, описание меняется редко
+	if cfg.CoinsWatcher.Metadata.Enabled {
+		go func(watcher *domain.Watcher) {
+			metadataTicker := time.NewTicker(cfg.CoinsWatcher.Metadata.Interval)
+			defer metadataTicker.Stop()
+			for {
+				metadataCtx, cancel := context.WithTimeout(ctx, cfg.CoinsWatcher.Metadata.Interval)
+				err := watcher.RefreshWatchlistMetadata(metadataCtx)
+				cancel()
+				if err != nil {
+					log.Warn("failed to refresh coin metadata", "error", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-metadataTicker.C:
+				}
+			}
+		}(watcher)
+	}
+
+	//запуск горутины по свёртке истории цен и удалению устаревших строк
+	if cfg.Rollups.Enabled {
+		go func(watcher *domain.Watcher) {
+			rollupTicker := time.NewTicker(cfg.Rollups.Interval)
+			defer rollupTicker.Stop()
+			for {
+				//при первом запуске сворачивается вся накопленная история
+				err := watcher.RunRollups(ctx)
+				if err != nil {
+					log.Warn("failed to roll up price history", "error", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-rollupTicker.C:
+				}
+			}
+		}(watcher)
+	}
+
 	//настройка и запуск REST сервера
 	router := chi.NewRouter()
 	_ = server.NewServer(router, store, log, cfg, watcher)
-	restServerAddr := cfg.Rest.Host + ":" + cfg.Rest.Port //получение адреса rest сервера из конфига
-	err = http.ListenAndServe(restServerAddr, router)
-	if err != nil {
+	restServer := &http.Server{
+		Addr:    cfg.Rest.Host + ":" + cfg.Rest.Port, //получение адреса rest сервера из конфига
+		Handler: router,
+		//контексты запросов наследуют контекст приложения, так остановка сервера отменяет запросы к провайдерам
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		log.Info("shutting down rest server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.CoinsWatcher.Timeout)
+		defer cancel()
+		_ = restServer.Shutdown(shutdownCtx)
+	}()
+	err = restServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		panic(err)
 	}
 }
+
+// собирает провайдеров из конфига в том порядке, в котором они там указаны
+func mustBuildProvider(ctx context.Context, cfg *config.Config, log *slog.Logger, store *storage.Store) domain.Provider {
+	entries := make([]registry.Entry, 0, len(cfg.Providers.Order))
+	for _, name := range cfg.Providers.Order {
+		var provider domain.Provider
+		switch name {
+		case "coingecko":
+			client := coingecko.NewClient(cfg, log, store)
+			go client.RunCoinListRefresh(ctx)
+			provider = client
+		case "binance_ws":
+			ws := stream.NewProvider(cfg.Stream, log, store)
+			if cfg.Providers.Mode == "consensus" { //в бд пишется только согласованная цена
+				ws.DisableFlush()
+			}
+			go ws.Run(ctx)
+			provider = ws
+		case "replay":
+			player, err := replay.NewProvider(cfg.Replay, log)
+			if err != nil {
+				panic(err)
+			}
+			provider = player
+		default:
+			panic(fmt.Sprintf("unknown provider in config: %s", name))
+		}
+		entries = append(entries, registry.Entry{Name: name, Provider: breaker.New(name, provider, cfg.Providers.Breaker, log)})
+	}
+	if len(entries) == 0 {
+		panic(registry.ErrNoProviders)
+	}
+	log.Info("providers configured", "order", cfg.Providers.Order, "mode", cfg.Providers.Mode)
+	if cfg.Providers.Mode == "consensus" {
+		return consensus.NewAggregator(log, cfg.Providers.Consensus, entries...)
+	}
+	return registry.NewRegistry(log, cfg.CoinsWatcher.Currency, entries...)
+}
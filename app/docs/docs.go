@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/currency/add": {
             "post": {
-                "description": "Adds a list of currencies to the observed list.",
+                "description": "Adds a list of currencies to the observed list. Coins may be passed as \"btc,eth\" or as a list\nof symbols and {\"symbol\":\"eth\",\"id\":\"ethereum\"} objects to pin an exact CoinGecko id.\nTokens may be added by {\"platform\":\"ethereum\",\"contract\":\"0x...\"}, prices are then fetched by contract.",
                 "consumes": [
                     "application/json"
                 ],
@@ -52,6 +52,217 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "409": {
+                        "description": "Symbol matches several coins, candidates are listed",
+                        "schema": {
+                            "$ref": "#/definitions/server.ambiguousCoinsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/currency/backfill": {
+            "get": {
+                "description": "Returns progress of loading historical prices for a coin added to the watchlist.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Currencies"
+                ],
+                "summary": "Get Backfill Status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Currency symbol (e.g., btc)",
+                        "name": "coin",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Backfill progress",
+                        "schema": {
+                            "$ref": "#/definitions/server.backfillStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "No backfill for this coin",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/currency/candles": {
+            "get": {
+                "description": "Returns open, high, low and close prices and the number of samples per interval between from (inclusive) and to (exclusive). Intervals shorter than a day are counted from the unix epoch, daily candles start at midnight in tz and weekly candles start on Monday in tz. Times are unix seconds and prices are JSON numbers, so the array can be passed to charting libraries as is. Intervals without samples are skipped.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Currencies"
+                ],
+                "summary": "Get Currency Candles",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Currency symbol (e.g., btc)",
+                        "name": "coin",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the range in Unix format",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range in Unix format",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Candle size: a number with unit s, m, h, d or w (e.g., 15m, 4h, 1d, 1w), defaults to 1d",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "IANA timezone for daily and weekly candles (e.g., America/New_York), defaults to UTC",
+                        "name": "tz",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Quote currency (e.g., usd), defaults to the first configured currency",
+                        "name": "vs",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Candles in ascending time order",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.candleResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/currency/history": {
+            "get": {
+                "description": "Returns prices of a currency between from (inclusive) and to (exclusive), bucketed into intervals. Intervals shorter than a day are counted from the unix epoch, whole days start at midnight in tz and weeks start on Monday. The array is streamed as it is read from the database, so long ranges are not buffered in memory.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Currencies"
+                ],
+                "summary": "Get Currency Price History",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Currency symbol (e.g., btc)",
+                        "name": "coin",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the range in Unix format",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range in Unix format",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bucket size: a number with unit s, m, h, d or w (e.g., 1m, 1h, 1d), defaults to 1h",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Aggregation per bucket: last (default), avg or ohlc",
+                        "name": "agg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "IANA timezone for daily and weekly buckets (e.g., Europe/Berlin), defaults to UTC",
+                        "name": "tz",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Quote currency (e.g., usd), defaults to the first configured currency",
+                        "name": "vs",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Buckets in ascending time order, empty buckets are skipped",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.historyPointResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -88,6 +299,36 @@ const docTemplate = `{
                         "name": "timestamp",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Quote currency (e.g., usd), defaults to the first configured currency",
+                        "name": "vs",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Pass 'market' to also return market cap, 24h volume, 24h change and last update time",
+                        "name": "include",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Fiat currency to convert the stored price to (e.g., eur), using the fx rate nearest to the price time",
+                        "name": "convert_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Lookup mode: nearest (default), at_or_before, at_or_after or interpolate (linear between neighbouring samples)",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Maximum distance between the timestamp and a sample used, as seconds or a duration (e.g., 90s, 1h)",
+                        "name": "max_distance",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -98,7 +339,13 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid input or validation error",
+                        "description": "Invalid input, validation error or no fx rate for convert_to",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "No sample within max_distance",
                         "schema": {
                             "type": "string"
                         }
@@ -158,9 +405,35 @@ const docTemplate = `{
                 }
             }
         },
+        "/currency/scan": {
+            "get": {
+                "description": "Returns how many quotes the last scan stored and which were skipped as stale, because the provider had not updated them since the previous scan.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Currencies"
+                ],
+                "summary": "Get Last Scan Result",
+                "responses": {
+                    "200": {
+                        "description": "Last scan result",
+                        "schema": {
+                            "$ref": "#/definitions/server.scanReportResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/currency/watchlist": {
             "get": {
-                "description": "Retrieves a list of all observed currencies.",
+                "description": "Retrieves a list of all observed currencies. With include=details the list holds watchlistEntryResponse\nobjects: id, contract and metadata (name, image, categories, genesis date, market cap rank) once it is loaded.",
                 "produces": [
                     "application/json"
                 ],
@@ -168,6 +441,14 @@ const docTemplate = `{
                     "Currencies"
                 ],
                 "summary": "Get Observed Currencies",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Pass 'details' to return coin metadata instead of bare symbols",
+                        "name": "include",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "List of observed currencies",
@@ -186,6 +467,102 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/provider/coins-cache": {
+            "get": {
+                "description": "Returns size and age of the coin list cache used to verify coins, per provider.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Providers"
+                ],
+                "summary": "Get Coin List Cache Status",
+                "responses": {
+                    "200": {
+                        "description": "Coin list cache status per provider",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.coinListCacheResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/provider/health": {
+            "get": {
+                "description": "Returns circuit breaker state per provider. Responds with 503 when every provider circuit is open.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Providers"
+                ],
+                "summary": "Get Provider Health",
+                "responses": {
+                    "200": {
+                        "description": "Circuit breaker state per provider",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.providerHealthResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "All provider circuits are open",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.providerHealthResponse"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/provider/throttling": {
+            "get": {
+                "description": "Returns rate limiter, retry and error counters per provider, useful to size the API plan.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Providers"
+                ],
+                "summary": "Get Provider Throttling Statistics",
+                "responses": {
+                    "200": {
+                        "description": "Throttling statistics per provider",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.throttleStatsResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
@@ -193,6 +570,123 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "coins": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.coinRef"
+                    }
+                }
+            }
+        },
+        "server.ambiguousCoinsResponse": {
+            "type": "object",
+            "properties": {
+                "candidates": {
+                    "description": "символ -\u003e подходящие монеты",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "$ref": "#/definitions/server.candidateCoin"
+                        }
+                    }
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.backfillStatusResponse": {
+            "type": "object",
+            "properties": {
+                "coin": {
+                    "type": "string"
+                },
+                "done": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "progress": {
+                    "description": "в процентах",
+                    "type": "number"
+                },
+                "samples": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "pending, running, done, failed",
+                    "type": "string",
+                    "example": "running"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.candidateCoin": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.candleResponse": {
+            "type": "object",
+            "properties": {
+                "close": {
+                    "type": "number",
+                    "example": 94990.1
+                },
+                "count": {
+                    "description": "сколько цен попало в свечу",
+                    "type": "integer",
+                    "example": 1440
+                },
+                "high": {
+                    "type": "number",
+                    "example": 95120
+                },
+                "low": {
+                    "type": "number",
+                    "example": 93800.25
+                },
+                "open": {
+                    "type": "number",
+                    "example": 94250.5
+                },
+                "time": {
+                    "description": "начало свечи",
+                    "type": "integer",
+                    "example": 1736467200
+                }
+            }
+        },
+        "server.coinListCacheResponse": {
+            "type": "object",
+            "properties": {
+                "age_seconds": {
+                    "description": "возраст кэша",
+                    "type": "integer"
+                },
+                "coins": {
+                    "type": "integer"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "unix timestamp, пусто если список ещё не загружен",
                     "type": "string"
                 }
             }
@@ -203,6 +697,28 @@ const docTemplate = `{
                 "coin": {
                     "type": "string"
                 },
+                "conversion": {
+                    "description": "только при convert_to",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.conversionData"
+                        }
+                    ]
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "lookup": {
+                    "$ref": "#/definitions/server.lookupData"
+                },
+                "market": {
+                    "description": "только при include=market",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/server.marketData"
+                        }
+                    ]
+                },
                 "price": {
                     "type": "number"
                 },
@@ -211,6 +727,46 @@ const docTemplate = `{
                 }
             }
         },
+        "server.coinRef": {
+            "type": "object",
+            "properties": {
+                "contract": {
+                    "description": "адрес контракта токена",
+                    "type": "string",
+                    "example": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+                },
+                "id": {
+                    "description": "явный id coingecko, если символ неоднозначный",
+                    "type": "string",
+                    "example": "ethereum"
+                },
+                "platform": {
+                    "description": "сеть токена, вместе с contract",
+                    "type": "string",
+                    "example": "ethereum"
+                },
+                "symbol": {
+                    "type": "string",
+                    "example": "eth"
+                }
+            }
+        },
+        "server.conversionData": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "usd"
+                },
+                "rate": {
+                    "type": "number"
+                },
+                "rate_timestamp": {
+                    "description": "unix timestamp использованного курса",
+                    "type": "string"
+                }
+            }
+        },
         "server.deleteCoinsReq": {
             "type": "object",
             "properties": {
@@ -218,6 +774,173 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "server.historyPointResponse": {
+            "type": "object",
+            "properties": {
+                "close": {
+                    "type": "number"
+                },
+                "high": {
+                    "type": "number"
+                },
+                "low": {
+                    "type": "number"
+                },
+                "open": {
+                    "type": "number"
+                },
+                "price": {
+                    "type": "number"
+                },
+                "samples": {
+                    "description": "сколько цен попало в интервал",
+                    "type": "integer",
+                    "example": 60
+                },
+                "timestamp": {
+                    "description": "unix timestamp начала интервала",
+                    "type": "string",
+                    "example": "1736499600"
+                }
+            }
+        },
+        "server.lookupData": {
+            "type": "object",
+            "properties": {
+                "after_timestamp": {
+                    "type": "string"
+                },
+                "before_timestamp": {
+                    "description": "unix timestamp соседей, только при интерполяции",
+                    "type": "string"
+                },
+                "distance_seconds": {
+                    "description": "от запрошенного времени до сэмпла, при интерполяции - до дальнего соседа",
+                    "type": "number",
+                    "example": 42
+                },
+                "interpolated": {
+                    "type": "boolean"
+                },
+                "mode": {
+                    "type": "string",
+                    "example": "nearest"
+                },
+                "tier": {
+                    "description": "уровень истории: raw, 1m, 1h или 1d",
+                    "type": "string",
+                    "example": "raw"
+                }
+            }
+        },
+        "server.marketData": {
+            "type": "object",
+            "properties": {
+                "change_24h": {
+                    "type": "number"
+                },
+                "last_updated_at": {
+                    "description": "unix timestamp цены у провайдера",
+                    "type": "string"
+                },
+                "market_cap": {
+                    "type": "number"
+                },
+                "volume_24h": {
+                    "type": "number"
+                }
+            }
+        },
+        "server.providerHealthResponse": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "description": "ошибок подряд",
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_failure": {
+                    "type": "string"
+                },
+                "opened_at": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "retry_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "description": "closed, open, half_open",
+                    "type": "string",
+                    "example": "closed"
+                }
+            }
+        },
+        "server.scanReportResponse": {
+            "type": "object",
+            "properties": {
+                "stale": {
+                    "type": "integer"
+                },
+                "stale_coins": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "btc/usd"
+                    ]
+                },
+                "stored": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "total_stale": {
+                    "type": "integer"
+                },
+                "total_stored": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.throttleStatsResponse": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "last_retry_after_seconds": {
+                    "type": "number"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "rate_limited": {
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer"
+                },
+                "retries": {
+                    "type": "integer"
+                },
+                "server_errors": {
+                    "type": "integer"
+                },
+                "throttle_wait_seconds": {
+                    "type": "number"
+                },
+                "throttled": {
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNoHistoryProvider = errors.New("provider can't load price history")
+
+// Backfill загружает историю цен для только что добавленных монет за coins_watcher.backfill.lookback_days.
+// История грузится окнами по window_days, прогресс сохраняется после каждого окна
+func (w Watcher) Backfill(ctx context.Context, coins map[string]WatchedCoin) {
+	const op = "domain.Watcher.Backfill"
+
+	history, ok := w.provider.(HistoryProvider)
+	if !ok {
+		w.log.Warn(op, "skipping backfill", ErrNoHistoryProvider)
+		return
+	}
+
+	cfg := w.cfg.CoinsWatcher.Backfill
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -cfg.LookbackDays)
+	windows := splitPeriod(from, to, time.Duration(cfg.WindowDays)*24*time.Hour)
+	currencies := w.cfg.CoinsWatcher.Currency
+
+	statuses := make(map[string]BackfillStatus, len(coins))
+	for coin := range coins {
+		statuses[coin] = BackfillStatus{
+			Coin:      coin,
+			Status:    BackfillPending,
+			Total:     len(windows) * len(currencies),
+			StartedAt: time.Now().UTC(),
+		}
+		w.saveBackfillStatus(ctx, statuses[coin])
+	}
+
+	for coin, watched := range coins {
+		status := statuses[coin]
+		status.Status = BackfillRunning
+		w.saveBackfillStatus(ctx, status)
+
+		for _, currency := range currencies {
+			for _, window := range windows {
+				samples, err := history.CoinHistory(ctx, watched.Id, currency, window[0], window[1])
+				if err == nil {
+					for i := range samples {
+						samples[i].Coin = coin
+						samples[i].Currency = currency
+					}
+					var added int64
+					added, err = w.store.AddPriceSamples(ctx, samples)
+					status.Samples += added
+				}
+				if err == nil && w.cfg.Rollups.Enabled {
+					//старая история лежит раньше, чем свёртка дошла по расписанию, поэтому сворачивается сразу
+					if rollupErr := w.RollupRange(ctx, window[0], window[1]); rollupErr != nil {
+						w.log.Warn(op, "failed to roll up backfilled prices", coin, "error", rollupErr)
+					}
+				}
+				if err != nil {
+					w.log.Error(op, "failed to backfill coin", coin, "error", err)
+					status.Error = err.Error()
+					break
+				}
+				status.Done++
+				w.saveBackfillStatus(ctx, status)
+			}
+			if status.Error != "" {
+				break
+			}
+		}
+
+		finishedAt := time.Now().UTC()
+		status.FinishedAt = &finishedAt
+		status.Status = BackfillDone
+		if status.Error != "" {
+			status.Status = BackfillFailed
+		}
+		w.saveBackfillStatus(ctx, status)
+		w.log.Info(op, "backfill finished for coin", coin, "status", status.Status, "samples", status.Samples)
+	}
+}
+
+func (w Watcher) GetBackfillStatus(ctx context.Context, coin string) (BackfillStatus, error) {
+	const op = "domain.Watcher.GetBackfillStatus"
+
+	status, err := w.store.GetBackfillStatus(ctx, coin)
+	if err != nil {
+		w.log.Error(op, "failed to get backfill status", err)
+		return BackfillStatus{}, err
+	}
+	return status, nil
+}
+
+func (w Watcher) saveBackfillStatus(ctx context.Context, status BackfillStatus) {
+	const op = "domain.Watcher.saveBackfillStatus"
+
+	err := w.store.SaveBackfillStatus(ctx, status)
+	if err != nil {
+		w.log.Error(op, "failed to save backfill status", err)
+	}
+}
+
+// делит период на окна [from, to) не длиннее window
+func splitPeriod(from, to time.Time, window time.Duration) [][2]time.Time {
+	if window <= 0 {
+		return [][2]time.Time{{from, to}}
+	}
+	var windows [][2]time.Time
+	for start := from; start.Before(to); start = start.Add(window) {
+		end := start.Add(window)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, [2]time.Time{start, end})
+	}
+	return windows
+}
@@ -0,0 +1,187 @@
+package domain
+
+import (
+	"context"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"github.com/shopspring/decimal"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSplitPeriod(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		name   string
+		to     time.Time
+		window time.Duration
+		want   [][2]time.Time
+	}{
+		{name: "exact multiple", to: from.Add(4 * day), window: 2 * day, want: [][2]time.Time{
+			{from, from.Add(2 * day)},
+			{from.Add(2 * day), from.Add(4 * day)},
+		}},
+		{name: "remainder", to: from.Add(5 * day), window: 2 * day, want: [][2]time.Time{
+			{from, from.Add(2 * day)},
+			{from.Add(2 * day), from.Add(4 * day)},
+			{from.Add(4 * day), from.Add(5 * day)},
+		}},
+		{name: "shorter than window", to: from.Add(time.Hour), window: day, want: [][2]time.Time{
+			{from, from.Add(time.Hour)},
+		}},
+		{name: "empty period", to: from, window: day, want: nil},
+		{name: "no window", to: from.Add(5 * day), window: 0, want: [][2]time.Time{
+			{from, from.Add(5 * day)},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitPeriod(from, tc.to, tc.window)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d windows %v, want %v", len(got), got, tc.want)
+			}
+			for i := range got {
+				if !got[i][0].Equal(tc.want[i][0]) || !got[i][1].Equal(tc.want[i][1]) {
+					t.Errorf("window %d = %v, want %v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+// провайдер истории: одна цена на каждый запрос, для монеты из failOn запрос с номером failAt падает
+type historySource struct {
+	Provider
+	failOn string
+	failAt int
+	calls  map[string]int
+}
+
+func (p *historySource) CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]PriceSample, error) {
+	p.calls[id]++
+	if id == p.failOn && p.calls[id] == p.failAt {
+		return nil, errors.New("provider is down")
+	}
+	return []PriceSample{{Price: decimal.NewFromInt(1), Time: from}}, nil
+}
+
+// хранилище, которое запоминает историю статусов, добавленные цены и свёрнутые периоды
+type backfillStore struct {
+	*tiersStore
+	statuses map[string][]BackfillStatus
+	samples  []PriceSample
+	rollups  [][2]time.Time //периоды свёртки в минутный уровень
+}
+
+func (s *backfillStore) AddPriceSamples(ctx context.Context, samples []PriceSample) (int64, error) {
+	s.samples = append(s.samples, samples...)
+	return int64(len(samples)), nil
+}
+
+func (s *backfillStore) SaveBackfillStatus(ctx context.Context, status BackfillStatus) error {
+	s.statuses[status.Coin] = append(s.statuses[status.Coin], status)
+	return nil
+}
+
+func (s *backfillStore) RollupPrices(ctx context.Context, tier RollupTier, from, to time.Time) (int64, error) {
+	if tier.Name == TierMinute {
+		s.rollups = append(s.rollups, [2]time.Time{from, to})
+	}
+	return s.tiersStore.RollupPrices(ctx, tier, from, to)
+}
+
+func newBackfillWatcher(provider Provider, rollups bool) (*Watcher, *backfillStore) {
+	store := &backfillStore{tiersStore: newTiersStore(), statuses: make(map[string][]BackfillStatus)}
+	cfg := &config.Config{}
+	cfg.CoinsWatcher.Currency = config.Currencies{"usd", "eur"}
+	cfg.CoinsWatcher.Backfill = config.Backfill{Enabled: true, LookbackDays: 10, WindowDays: 3}
+	cfg.Rollups.Enabled = rollups
+	return NewWatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), provider, cfg), store
+}
+
+func TestBackfillProgress(t *testing.T) {
+	provider := &historySource{calls: make(map[string]int)}
+	w, store := newBackfillWatcher(provider, true)
+
+	w.Backfill(context.Background(), map[string]WatchedCoin{"btc": {Id: "bitcoin"}})
+
+	//10 дней окнами по 3 дня - 4 окна в каждой из двух валют
+	const windows = 8
+	statuses := store.statuses["btc"]
+	if len(statuses) != windows+3 {
+		t.Fatalf("got %d status updates, want pending, running, %d windows and the result", len(statuses), windows)
+	}
+	if statuses[0].Status != BackfillPending || statuses[0].Total != windows {
+		t.Errorf("first status %+v, want pending with %d windows", statuses[0], windows)
+	}
+	if statuses[1].Status != BackfillRunning || statuses[1].Done != 0 {
+		t.Errorf("second status %+v, want running with nothing done", statuses[1])
+	}
+	for i := 1; i <= windows; i++ {
+		if status := statuses[i+1]; status.Status != BackfillRunning || status.Done != i {
+			t.Errorf("status after window %d: %+v", i, status)
+		}
+	}
+	last := statuses[len(statuses)-1]
+	if last.Status != BackfillDone || last.Done != windows || last.Samples != windows || last.FinishedAt == nil || last.Error != "" {
+		t.Errorf("final status %+v, want done with %d windows and samples", last, windows)
+	}
+
+	for _, sample := range store.samples {
+		if sample.Coin != "btc" || (sample.Currency != "usd" && sample.Currency != "eur") {
+			t.Errorf("sample is not tagged with the coin and currency: %+v", sample)
+		}
+	}
+
+	//каждое окно сворачивается сразу после загрузки
+	if len(store.rollups) != windows {
+		t.Fatalf("rolled up %d periods, want one per window", len(store.rollups))
+	}
+	first := store.rollups[0]
+	if first[1].Sub(first[0]) < 3*24*time.Hour {
+		t.Errorf("first rollup %v does not cover a whole window", first)
+	}
+}
+
+func TestBackfillFailure(t *testing.T) {
+	provider := &historySource{calls: make(map[string]int), failOn: "ethereum", failAt: 3}
+	w, store := newBackfillWatcher(provider, true)
+
+	w.Backfill(context.Background(), map[string]WatchedCoin{"btc": {Id: "bitcoin"}, "eth": {Id: "ethereum"}})
+
+	btc := store.statuses["btc"]
+	if last := btc[len(btc)-1]; last.Status != BackfillDone || last.Done != 8 {
+		t.Errorf("btc final status %+v, a failing coin should not stop the others", last)
+	}
+
+	eth := store.statuses["eth"]
+	last := eth[len(eth)-1]
+	if last.Status != BackfillFailed || last.Error == "" || last.FinishedAt == nil {
+		t.Errorf("eth final status %+v, want failed with an error", last)
+	}
+	if last.Done != 2 || last.Samples != 2 {
+		t.Errorf("eth stopped after %d windows and %d samples, want 2 and 2", last.Done, last.Samples)
+	}
+	if provider.calls["ethereum"] != 3 {
+		t.Errorf("eth history requested %d times, backfill should stop at the first error", provider.calls["ethereum"])
+	}
+	if len(store.rollups) != 8+2 {
+		t.Errorf("rolled up %d periods, the failed window should not be rolled up", len(store.rollups))
+	}
+}
+
+func TestBackfillWithoutRollups(t *testing.T) {
+	w, store := newBackfillWatcher(&historySource{calls: make(map[string]int)}, false)
+
+	w.Backfill(context.Background(), map[string]WatchedCoin{"btc": {Id: "bitcoin"}})
+
+	if len(store.samples) != 8 {
+		t.Errorf("stored %d samples, want 8", len(store.samples))
+	}
+	if len(store.rolled) != 0 {
+		t.Errorf("rollups are disabled, but %v were rolled up", store.rolled)
+	}
+}
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+var (
+	ErrNoFXProvider = errors.New("provider can't load fx rates")
+	ErrNoFXRate     = errors.New("no fx rate recorded for this currency")
+)
+
+// RecordFXRates записывает текущие курсы fx.currencies относительно fx.base
+func (w Watcher) RecordFXRates(ctx context.Context) error {
+	const op = "domain.Watcher.RecordFXRates"
+
+	source, ok := w.provider.(FXSource)
+	if !ok {
+		w.log.Warn(op, "skipping fx rates", ErrNoFXProvider)
+		return ErrNoFXProvider
+	}
+	rates, err := source.FXRates(ctx, w.cfg.FX.Base, w.cfg.FX.Currencies)
+	if err != nil {
+		w.log.Error(op, "failed to load fx rates", err)
+		return err
+	}
+	if len(rates) == 0 {
+		w.log.Warn(op, "provider returned no fx rates", w.cfg.FX.Currencies)
+		return nil
+	}
+	err = w.store.AddFXRates(ctx, rates)
+	if err != nil {
+		w.log.Error(op, "failed to add fx rates to store", err)
+		return err
+	}
+	w.log.Debug(op, "recorded fx rates", len(rates))
+	return nil
+}
+
+// пересчитывает цену и рыночные данные в валюту to. Изменение за сутки в процентах не меняется
+func (w Watcher) convert(ctx context.Context, sample PriceSample, to string) (PriceSample, error) {
+	const op = "domain.Watcher.convert"
+
+	rate, rateTime, err := w.crossRate(ctx, sample.Currency, to, sample.Time)
+	if err != nil {
+		w.log.Warn(op, "cannot convert price", sample.Currency, "to", to, "error", err)
+		return PriceSample{}, err
+	}
+
+	sample.Conversion = &Conversion{From: sample.Currency, Rate: rate, RateTime: rateTime}
+	sample.Currency = to
+	sample.Price = sample.Price.Mul(rate)
+	if sample.MarketCap != nil {
+		marketCap := sample.MarketCap.Mul(rate)
+		sample.MarketCap = &marketCap
+	}
+	if sample.Volume24h != nil {
+		volume := sample.Volume24h.Mul(rate)
+		sample.Volume24h = &volume
+	}
+	return sample, nil
+}
+
+// курс from -> to через базовую валюту: (base -> to) / (base -> from).
+// Время курса - время того из двух курсов, что дальше от момента цены
+func (w Watcher) crossRate(ctx context.Context, from, to string, at time.Time) (decimal.Decimal, time.Time, error) {
+	fromRate, err := w.baseRate(ctx, from, at)
+	if err != nil {
+		return decimal.Decimal{}, time.Time{}, err
+	}
+	toRate, err := w.baseRate(ctx, to, at)
+	if err != nil {
+		return decimal.Decimal{}, time.Time{}, err
+	}
+
+	rateTime := fromRate.Time
+	if absDuration(toRate.Time, at) > absDuration(fromRate.Time, at) {
+		rateTime = toRate.Time
+	}
+	return toRate.Rate.Div(fromRate.Rate), rateTime, nil
+}
+
+// курс base -> quote, ближайший ко времени at. Для самой базовой валюты курс 1
+func (w Watcher) baseRate(ctx context.Context, quote string, at time.Time) (FXRate, error) {
+	base := w.cfg.FX.Base
+	if quote == base {
+		return FXRate{Base: base, Quote: quote, Rate: decimal.NewFromInt(1), Time: at}, nil
+	}
+	rate, err := w.store.GetFXRate(ctx, base, quote, at)
+	if err != nil {
+		return FXRate{}, fmt.Errorf("%s/%s: %w", base, quote, err)
+	}
+	if rate.Rate.IsZero() { //делить на такой курс нельзя
+		return FXRate{}, fmt.Errorf("%s/%s: %w", base, quote, ErrNoFXRate)
+	}
+	return rate, nil
+}
+
+func absDuration(a, b time.Time) time.Duration {
+	if a.After(b) {
+		return a.Sub(b)
+	}
+	return b.Sub(a)
+}
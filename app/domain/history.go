@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Способы свернуть цены внутри интервала
+const (
+	AggregateLast = "last" //последняя цена интервала
+	AggregateAvg  = "avg"  //средняя цена интервала
+	AggregateOHLC = "ohlc" //открытие, максимум, минимум и закрытие
+)
+
+var (
+	ErrInvalidInterval     = errors.New("invalid interval, expected a number with unit s, m, h, d or w, e.g. 1m, 1h, 1d")
+	ErrUnknownAggregation  = errors.New("unknown aggregation, expected last, avg or ohlc")
+	ErrInvalidHistoryRange = errors.New("invalid history range, from must be before to")
+	ErrInvalidTimezone     = errors.New("invalid timezone, expected an IANA name like Europe/Berlin")
+)
+
+// HistoryQuery ряд цен монеты за [From, To), свёрнутый в интервалы по Interval.
+// Интервалы короче суток отсчитываются от начала unix-времени. Интервалы в целое число суток
+// начинаются в полночь по Location (пустой - UTC), а кратные неделе - в понедельник,
+// поэтому сутки с переходом на летнее время получаются на час короче или длиннее
+type HistoryQuery struct {
+	Coin        string
+	Currency    string
+	From        time.Time
+	To          time.Time
+	Interval    time.Duration
+	Aggregation string
+	Location    *time.Location
+	Tier        string    //уровень истории, его выбирает Watcher, пустой - сырые цены
+	TierEnd     time.Time //до какого времени Tier свёрнут, дальше ряд дочитывается из сырых цен. Нулевое - Tier покрывает весь период
+}
+
+// Calendar выравниваются ли интервалы по местным суткам
+func (q HistoryQuery) Calendar() bool {
+	return q.Interval%(24*time.Hour) == 0
+}
+
+// PriceBucket цены монеты за один интервал. Заполнены только поля, нужные Aggregation запроса
+type PriceBucket struct {
+	Time    time.Time //начало интервала
+	Open    *decimal.Decimal
+	High    *decimal.Decimal
+	Low     *decimal.Decimal
+	Close   *decimal.Decimal
+	Avg     *decimal.Decimal
+	Samples int64
+}
+
+// fitsTier собираются ли интервалы запроса из целых строк уровня: уровень не грубее интервала
+// и каждый интервал начинается на границе строки. Строки уровней выровнены по UTC,
+// поэтому для календарных интервалов смещение пояса на всём периоде должно быть кратно размеру уровня:
+// для Asia/Kolkata (+05:30) не годится часовой уровень, а для любого пояса, кроме UTC, - дневной
+func (q HistoryQuery) fitsTier(tier string) bool {
+	size := tierSize(tier)
+	if size == 0 {
+		return true
+	}
+	if q.Interval%size != 0 {
+		return false
+	}
+	if !q.Calendar() {
+		return true
+	}
+	for at := q.From; at.Before(q.To); {
+		local := at.In(q.Location)
+		_, offset := local.Zone()
+		if time.Duration(offset)*time.Second%size != 0 {
+			return false
+		}
+		_, end := local.ZoneBounds()
+		if end.IsZero() { //смещение больше не меняется
+			break
+		}
+		at = end
+	}
+	return true
+}
+
+func (q HistoryQuery) Validate() error {
+	switch q.Aggregation {
+	case AggregateLast, AggregateAvg, AggregateOHLC:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAggregation, q.Aggregation)
+	}
+	if q.Interval < time.Second {
+		return ErrInvalidInterval
+	}
+	if !q.From.Before(q.To) {
+		return ErrInvalidHistoryRange
+	}
+	return nil
+}
+
+// LoadTimezone часовой пояс по имени IANA, пустое имя - UTC.
+// Local не принимается: бд про часовой пояс сервера ничего не знает
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, name)
+	}
+	return location, nil
+}
+
+// ParseInterval разбирает интервал вида 30s, 5m, 1h, 1d, 1w
+func ParseInterval(value string) (time.Duration, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	units := map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	if len(value) < 2 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	unit, ok := units[value[len(value)-1:]]
+	count, err := strconv.Atoi(value[:len(value)-1])
+	if !ok || err != nil || count <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// PriceHistory отдаёт интервалы ряда по одному в fn, по возрастанию времени, не собирая весь ряд в памяти.
+// Ошибка из fn прерывает чтение и возвращается как есть
+func (w Watcher) PriceHistory(ctx context.Context, query HistoryQuery, fn func(PriceBucket) error) error {
+	const op = "domain.Watcher.PriceHistory"
+
+	query.Currency = strings.ToLower(query.Currency)
+	if query.Location == nil {
+		query.Location = time.UTC
+	}
+	err := query.Validate()
+	if err != nil {
+		w.log.Debug(op, "invalid history query", err)
+		return err
+	}
+	query.Tier = w.historyTier(query.From, query.fitsTier)
+	if end := w.coverage.until(query.Tier); !end.IsZero() && end.Before(query.To) {
+		query.TierEnd = end //хвост периода, обычно текущий час или день, ещё не свёрнут
+	}
+	w.log.Debug(op, "trying to get price history", query)
+	err = w.store.GetPriceHistory(ctx, query, fn)
+	if err != nil {
+		w.log.Error(op, "failed to get price history", err)
+		return err
+	}
+	return nil
+}
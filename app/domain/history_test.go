@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "30s", want: 30 * time.Second},
+		{value: "5m", want: 5 * time.Minute},
+		{value: "1h", want: time.Hour},
+		{value: "1d", want: 24 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: " 1H ", want: time.Hour},
+	} {
+		got, err := ParseInterval(tc.value)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseInterval(%q) = %s, %v, want %s", tc.value, got, err, tc.want)
+		}
+	}
+	for _, value := range []string{"", "h", "1", "0h", "-1h", "1y", "1.5h", "h1", "1hh"} {
+		if got, err := ParseInterval(value); !errors.Is(err, ErrInvalidInterval) {
+			t.Errorf("ParseInterval(%q) = %s, %v, want ErrInvalidInterval", value, got, err)
+		}
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	for _, name := range []string{"", "UTC", "Europe/Berlin", "Asia/Kolkata"} {
+		location, err := LoadTimezone(name)
+		if err != nil || location == nil {
+			t.Errorf("LoadTimezone(%q) = %v, %v", name, location, err)
+		}
+	}
+	for _, name := range []string{"Local", "Mars/Olympus", "+03:00", "europe/berlin/x"} {
+		if _, err := LoadTimezone(name); !errors.Is(err, ErrInvalidTimezone) {
+			t.Errorf("LoadTimezone(%q) = %v, want ErrInvalidTimezone", name, err)
+		}
+	}
+}
+
+func TestHistoryQueryCalendar(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		want     bool
+	}{
+		{interval: time.Second, want: false},
+		{interval: time.Hour, want: false},
+		{interval: 36 * time.Hour, want: false},
+		{interval: 24 * time.Hour, want: true},
+		{interval: 48 * time.Hour, want: true},
+		{interval: 7 * 24 * time.Hour, want: true},
+	} {
+		if got := (HistoryQuery{Interval: tc.interval}).Calendar(); got != tc.want {
+			t.Errorf("Calendar(%s) = %t, want %t", tc.interval, got, tc.want)
+		}
+	}
+}
+
+func TestHistoryQueryValidate(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	valid := HistoryQuery{From: from, To: from.Add(time.Hour), Interval: time.Minute, Aggregation: AggregateLast}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for _, tc := range []struct {
+		name  string
+		query func(q HistoryQuery) HistoryQuery
+		err   error
+	}{
+		{name: "unknown aggregation", query: func(q HistoryQuery) HistoryQuery { q.Aggregation = "median"; return q }, err: ErrUnknownAggregation},
+		{name: "sub-second interval", query: func(q HistoryQuery) HistoryQuery { q.Interval = time.Millisecond; return q }, err: ErrInvalidInterval},
+		{name: "empty range", query: func(q HistoryQuery) HistoryQuery { q.To = q.From; return q }, err: ErrInvalidHistoryRange},
+		{name: "reversed range", query: func(q HistoryQuery) HistoryQuery { q.From, q.To = q.To, q.From; return q }, err: ErrInvalidHistoryRange},
+	} {
+		if err := tc.query(valid).Validate(); !errors.Is(err, tc.err) {
+			t.Errorf("%s: Validate = %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Режимы поиска цены на момент времени
+const (
+	LookupNearest     = "nearest"      //ближайший сэмпл с любой стороны
+	LookupAtOrBefore  = "at_or_before" //последний сэмпл не позже момента
+	LookupAtOrAfter   = "at_or_after"  //первый сэмпл не раньше момента
+	LookupInterpolate = "interpolate"  //линейно между соседними сэмплами
+)
+
+var (
+	ErrUnknownLookupMode   = errors.New("unknown lookup mode, expected nearest, at_or_before, at_or_after or interpolate")
+	ErrNoSampleInTolerance = errors.New("no sample within tolerance")
+)
+
+// PriceLookup как искать цену на момент времени. Пустой Mode - nearest, нулевой MaxDistance - без ограничения.
+// Tier - уровень истории, в котором искать, его выбирает Watcher, пустой - сырые цены.
+// В свёрнутых уровнях ценой интервала считается цена открытия, а временем - его начало
+type PriceLookup struct {
+	Mode        string
+	MaxDistance time.Duration
+	Tier        string
+}
+
+// PriceMatch как найденная цена соотносится с запрошенным моментом
+type PriceMatch struct {
+	Mode      string
+	Requested time.Time
+	// от запрошенного момента до использованного сэмпла, при интерполяции - до дальнего из соседей
+	Distance     time.Duration
+	Interpolated bool
+	Before       *time.Time //соседи, между которыми интерполирована цена
+	After        *time.Time
+	Tier         string //уровень истории, из которого взята цена
+}
+
+func (l PriceLookup) Validate() error {
+	switch l.Mode {
+	case "", LookupNearest, LookupAtOrBefore, LookupAtOrAfter, LookupInterpolate:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownLookupMode, l.Mode)
+	}
+	if l.MaxDistance < 0 {
+		return fmt.Errorf("max distance can't be negative: %s", l.MaxDistance)
+	}
+	return nil
+}
+
+// NeedsBefore нужен ли для поиска сэмпл не позже момента
+func (l PriceLookup) NeedsBefore() bool {
+	return l.Mode != LookupAtOrAfter
+}
+
+// NeedsAfter нужен ли для поиска сэмпл не раньше момента
+func (l PriceLookup) NeedsAfter() bool {
+	return l.Mode != LookupAtOrBefore
+}
+
+// Resolve выбирает цену на момент at из соседних сэмплов: before - последний не позже at, after - первый не раньше at,
+// любой из них может отсутствовать. Если подходящего сэмпла нет или он дальше MaxDistance, возвращает ErrNoSampleInTolerance.
+// Интерполяция вне истории (есть только один сосед) отдаёт этого соседа, как nearest
+func (l PriceLookup) Resolve(at time.Time, before, after *PriceSample) (PriceSample, error) {
+	mode := l.Mode
+	if mode == "" {
+		mode = LookupNearest
+	}
+
+	var candidates []*PriceSample
+	switch mode {
+	case LookupAtOrBefore:
+		candidates = []*PriceSample{before}
+	case LookupAtOrAfter:
+		candidates = []*PriceSample{after}
+	case LookupNearest, LookupInterpolate:
+		candidates = []*PriceSample{before, after}
+	default:
+		return PriceSample{}, fmt.Errorf("%w: %q", ErrUnknownLookupMode, l.Mode)
+	}
+
+	// соседи дальше допуска не используются, в том числе для интерполяции
+	var within []*PriceSample
+	var closest time.Duration = -1
+	for _, sample := range candidates {
+		if sample == nil {
+			continue
+		}
+		distance := absDuration(sample.Time, at)
+		if closest < 0 || distance < closest {
+			closest = distance
+		}
+		if l.MaxDistance == 0 || distance <= l.MaxDistance {
+			within = append(within, sample)
+		}
+	}
+	if len(within) == 0 {
+		if closest < 0 {
+			return PriceSample{}, ErrNoSampleInTolerance
+		}
+		return PriceSample{}, fmt.Errorf("%w: closest sample is %s away, max distance %s", ErrNoSampleInTolerance, closest, l.MaxDistance)
+	}
+
+	tier := l.Tier
+	if tier == "" {
+		tier = TierRaw
+	}
+	if mode == LookupInterpolate && len(within) == 2 && !within[0].Time.Equal(within[1].Time) {
+		result := interpolate(at, *within[0], *within[1])
+		result.Match.Tier = tier
+		return result, nil
+	}
+
+	best := within[0]
+	for _, sample := range within[1:] { //при равном расстоянии остаётся более ранний
+		if absDuration(sample.Time, at) < absDuration(best.Time, at) {
+			best = sample
+		}
+	}
+	result := *best
+	result.Match = &PriceMatch{Mode: mode, Requested: at, Distance: absDuration(best.Time, at), Tier: tier}
+	return result, nil
+}
+
+// линейная интерполяция цены между before и after. Рыночные данные на момент at неизвестны и не заполняются
+func interpolate(at time.Time, before, after PriceSample) PriceSample {
+	span := decimal.NewFromInt(after.Time.Sub(before.Time).Nanoseconds())
+	elapsed := decimal.NewFromInt(at.Sub(before.Time).Nanoseconds())
+	price := before.Price.Add(after.Price.Sub(before.Price).Mul(elapsed).Div(span))
+
+	beforeTime, afterTime := before.Time, after.Time
+	return PriceSample{
+		Coin:     before.Coin,
+		Currency: before.Currency,
+		Price:    price,
+		Time:     at,
+		Provider: before.Provider,
+		Match: &PriceMatch{
+			Mode:         LookupInterpolate,
+			Requested:    at,
+			Distance:     max(absDuration(before.Time, at), absDuration(after.Time, at)),
+			Interpolated: true,
+			Before:       &beforeTime,
+			After:        &afterTime,
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"errors"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+var lookupAt = time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+func sampleAt(offset time.Duration, price string) *PriceSample {
+	return &PriceSample{Coin: "btc", Currency: "usd", Price: decimal.RequireFromString(price), Time: lookupAt.Add(offset)}
+}
+
+func TestResolve(t *testing.T) {
+	before := sampleAt(-10*time.Minute, "100")
+	after := sampleAt(30*time.Minute, "200")
+	for _, tc := range []struct {
+		name          string
+		lookup        PriceLookup
+		before, after *PriceSample
+		price         string //пусто - ждём ErrNoSampleInTolerance
+		time          time.Time
+		distance      time.Duration
+		interpolated  bool
+	}{
+		{name: "nearest picks the closer neighbour", lookup: PriceLookup{}, before: before, after: after, price: "100", time: before.Time, distance: 10 * time.Minute},
+		{name: "nearest on a tie keeps the earlier", lookup: PriceLookup{Mode: LookupNearest}, before: sampleAt(-time.Minute, "100"), after: sampleAt(time.Minute, "200"), price: "100", time: lookupAt.Add(-time.Minute), distance: time.Minute},
+		{name: "at_or_before", lookup: PriceLookup{Mode: LookupAtOrBefore}, before: before, after: after, price: "100", time: before.Time, distance: 10 * time.Minute},
+		{name: "at_or_after", lookup: PriceLookup{Mode: LookupAtOrAfter}, before: before, after: after, price: "200", time: after.Time, distance: 30 * time.Minute},
+		{name: "at_or_after without a later sample", lookup: PriceLookup{Mode: LookupAtOrAfter}, before: before},
+		{name: "at_or_before without an earlier sample", lookup: PriceLookup{Mode: LookupAtOrBefore}, after: after},
+		{name: "exact hit", lookup: PriceLookup{Mode: LookupAtOrAfter}, after: sampleAt(0, "150"), price: "150", time: lookupAt, distance: 0},
+		{
+			name: "interpolate between neighbours", lookup: PriceLookup{Mode: LookupInterpolate}, before: before, after: after,
+			price: "125", time: lookupAt, distance: 30 * time.Minute, interpolated: true,
+		},
+		{
+			name: "interpolate on an exact hit is not interpolated", lookup: PriceLookup{Mode: LookupInterpolate}, before: sampleAt(0, "150"), after: sampleAt(0, "150"),
+			price: "150", time: lookupAt, distance: 0,
+		},
+		{
+			name: "interpolate with one neighbour acts as nearest", lookup: PriceLookup{Mode: LookupInterpolate}, before: before,
+			price: "100", time: before.Time, distance: 10 * time.Minute,
+		},
+		{
+			name: "interpolate drops a neighbour beyond max distance", lookup: PriceLookup{Mode: LookupInterpolate, MaxDistance: 15 * time.Minute}, before: before, after: after,
+			price: "100", time: before.Time, distance: 10 * time.Minute,
+		},
+		{name: "max distance boundary is inclusive", lookup: PriceLookup{MaxDistance: 10 * time.Minute}, before: before, price: "100", time: before.Time, distance: 10 * time.Minute},
+		{name: "just beyond max distance", lookup: PriceLookup{MaxDistance: 10*time.Minute - time.Nanosecond}, before: before},
+		{name: "nearest beyond max distance falls back to the other side", lookup: PriceLookup{MaxDistance: 5 * time.Minute}, before: sampleAt(-10*time.Minute, "100"), after: sampleAt(4*time.Minute, "200"), price: "200", time: lookupAt.Add(4 * time.Minute), distance: 4 * time.Minute},
+		{name: "no samples at all", lookup: PriceLookup{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.lookup.Resolve(lookupAt, tc.before, tc.after)
+			if tc.price == "" {
+				if !errors.Is(err, ErrNoSampleInTolerance) {
+					t.Fatalf("expected ErrNoSampleInTolerance, got %v, %v", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if !got.Price.Equal(decimal.RequireFromString(tc.price)) || !got.Time.Equal(tc.time) {
+				t.Errorf("got %s @ %s, want %s @ %s", got.Price, got.Time, tc.price, tc.time)
+			}
+			if got.Match == nil {
+				t.Fatal("match is not filled")
+			}
+			if got.Match.Distance != tc.distance || got.Match.Interpolated != tc.interpolated {
+				t.Errorf("match distance %s interpolated %t, want %s %t", got.Match.Distance, got.Match.Interpolated, tc.distance, tc.interpolated)
+			}
+			if got.Match.Tier != TierRaw || !got.Match.Requested.Equal(lookupAt) {
+				t.Errorf("match = %+v", got.Match)
+			}
+			if tc.interpolated && (!got.Match.Before.Equal(tc.before.Time) || !got.Match.After.Equal(tc.after.Time)) {
+				t.Errorf("interpolated between %s and %s, want %s and %s", got.Match.Before, got.Match.After, tc.before.Time, tc.after.Time)
+			}
+		})
+	}
+}
+
+func TestResolveKeepsTier(t *testing.T) {
+	got, err := PriceLookup{Tier: TierHour}.Resolve(lookupAt, sampleAt(-time.Hour, "1"), nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.Match.Tier != TierHour {
+		t.Errorf("tier = %s, want %s", got.Match.Tier, TierHour)
+	}
+}
+
+func TestPriceLookupValidate(t *testing.T) {
+	for _, tc := range []struct {
+		lookup PriceLookup
+		ok     bool
+	}{
+		{lookup: PriceLookup{}, ok: true},
+		{lookup: PriceLookup{Mode: LookupInterpolate, MaxDistance: time.Hour}, ok: true},
+		{lookup: PriceLookup{Mode: "closest"}},
+		{lookup: PriceLookup{MaxDistance: -time.Second}},
+	} {
+		if err := tc.lookup.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v", tc.lookup, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+var ErrNoMetadataProvider = errors.New("provider can't load coin metadata")
+
+// RefreshMetadata загружает описание монет у провайдера и сохраняет его.
+// Монеты запрашиваются по одной, поэтому при отмене ctx сохраняется то, что успели загрузить
+func (w Watcher) RefreshMetadata(ctx context.Context, coins map[string]WatchedCoin) error {
+	const op = "domain.Watcher.RefreshMetadata"
+
+	provider, ok := w.provider.(MetadataProvider)
+	if !ok {
+		w.log.Warn(op, "skipping metadata", ErrNoMetadataProvider)
+		return ErrNoMetadataProvider
+	}
+
+	seen := make(map[string]bool, len(coins))
+	metadata := make([]CoinMetadata, 0, len(coins))
+	var lastErr error
+	for _, watched := range coins {
+		if seen[watched.Id] {
+			continue
+		}
+		seen[watched.Id] = true
+		meta, err := provider.CoinMetadata(ctx, watched.Id)
+		if ctx.Err() != nil {
+			w.log.Warn(op, "metadata refresh cancelled", ctx.Err())
+			lastErr = ctx.Err()
+			break
+		}
+		if err != nil {
+			w.log.Warn(op, "failed to load metadata for coin", watched.Id, "error", err)
+			lastErr = err
+			continue
+		}
+		metadata = append(metadata, meta)
+	}
+
+	if len(metadata) > 0 {
+		//отмена не должна терять уже загруженное
+		err := w.store.SaveCoinMetadata(context.WithoutCancel(ctx), metadata)
+		if err != nil {
+			w.log.Error(op, "failed to save coin metadata", err)
+			return err
+		}
+	}
+	w.log.Info(op, "coin metadata refreshed", len(metadata), "of", len(seen))
+	return lastErr
+}
+
+// RefreshWatchlistMetadata обновляет описание всех монет из списка наблюдения
+func (w Watcher) RefreshWatchlistMetadata(ctx context.Context) error {
+	const op = "domain.Watcher.RefreshWatchlistMetadata"
+
+	coins, err := w.store.GetObserveredCoinsList(ctx)
+	if err != nil {
+		w.log.Error(op, "failed to get observered coins list", err)
+		return err
+	}
+	if len(coins) == 0 {
+		return nil
+	}
+	return w.RefreshMetadata(ctx, coins)
+}
+
+// GetWatchlistDetails список наблюдения с описанием монет, отсортированный по символу
+func (w Watcher) GetWatchlistDetails(ctx context.Context) ([]WatchlistEntry, error) {
+	const op = "domain.Watcher.GetWatchlistDetails"
+
+	coins, err := w.store.GetObserveredCoinsList(ctx)
+	if err != nil {
+		w.log.Error(op, "failed to get observered coins list", err)
+		return nil, err
+	}
+	ids := make([]string, 0, len(coins))
+	for _, watched := range coins {
+		ids = append(ids, watched.Id)
+	}
+	metadata, err := w.store.GetCoinMetadata(ctx, ids)
+	if err != nil {
+		w.log.Error(op, "failed to get coin metadata", err)
+		return nil, err
+	}
+
+	entries := make([]WatchlistEntry, 0, len(coins))
+	for coin, watched := range coins {
+		entry := WatchlistEntry{Coin: coin, WatchedCoin: watched}
+		if meta, ok := metadata[watched.Id]; ok {
+			entry.Metadata = &meta
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Coin < entries[j].Coin })
+	return entries, nil
+}
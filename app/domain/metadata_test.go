@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"context"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// провайдер описаний: считает запросы по id, для failID отвечает ошибкой, после cancelAfter запросов отменяет ctx
+type metadataSource struct {
+	Provider
+	failID      string
+	cancelAfter int
+	cancel      context.CancelFunc
+	calls       map[string]int
+}
+
+func (p *metadataSource) CoinMetadata(ctx context.Context, id string) (CoinMetadata, error) {
+	p.calls[id]++
+	if p.cancel != nil && len(p.calls) >= p.cancelAfter {
+		p.cancel()
+	}
+	if id == p.failID {
+		return CoinMetadata{}, errors.New("coin not found")
+	}
+	return CoinMetadata{Id: id, Name: "name of " + id, UpdatedAt: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)}, nil
+}
+
+// хранилище списка наблюдения и описаний монет в памяти
+type metadataStore struct {
+	CoinsStore
+	watched  map[string]WatchedCoin
+	metadata map[string]CoinMetadata
+	saves    int
+}
+
+func (s *metadataStore) GetObserveredCoinsList(ctx context.Context) (map[string]WatchedCoin, error) {
+	return s.watched, nil
+}
+
+func (s *metadataStore) SaveCoinMetadata(ctx context.Context, metadata []CoinMetadata) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.saves++
+	for _, meta := range metadata {
+		s.metadata[meta.Id] = meta
+	}
+	return nil
+}
+
+func (s *metadataStore) GetCoinMetadata(ctx context.Context, ids []string) (map[string]CoinMetadata, error) {
+	result := make(map[string]CoinMetadata, len(ids))
+	for _, id := range ids {
+		if meta, ok := s.metadata[id]; ok {
+			result[id] = meta
+		}
+	}
+	return result, nil
+}
+
+func newMetadataWatcher(provider Provider) (*Watcher, *metadataStore) {
+	store := &metadataStore{
+		watched: map[string]WatchedCoin{
+			"btc":       {Id: "bitcoin"},
+			"doge":      {Id: "dogecoin"},
+			"usdt":      {Id: "tether", Platform: "ethereum", Contract: "0xdac1"},
+			"usdt-tron": {Id: "tether", Platform: "tron", Contract: "tr7n"},
+		},
+		metadata: make(map[string]CoinMetadata),
+	}
+	return NewWatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), provider, &config.Config{}), store
+}
+
+func TestRefreshWatchlistMetadata(t *testing.T) {
+	provider := &metadataSource{failID: "dogecoin", calls: make(map[string]int)}
+	w, store := newMetadataWatcher(provider)
+
+	err := w.RefreshWatchlistMetadata(context.Background())
+	if err == nil {
+		t.Error("expected the dogecoin error to be returned")
+	}
+	//одна монета в двух сетях запрашивается один раз
+	for _, id := range []string{"bitcoin", "dogecoin", "tether"} {
+		if provider.calls[id] != 1 {
+			t.Errorf("%s requested %d times, want once", id, provider.calls[id])
+		}
+	}
+	//ошибка одной монеты не мешает сохранить остальные
+	if store.saves != 1 || len(store.metadata) != 2 {
+		t.Errorf("saved %v in %d calls, want bitcoin and tether at once", store.metadata, store.saves)
+	}
+
+	entries, err := w.GetWatchlistDetails(context.Background())
+	if err != nil {
+		t.Fatalf("GetWatchlistDetails: %v", err)
+	}
+	wantCoins := []string{"btc", "doge", "usdt", "usdt-tron"}
+	if len(entries) != len(wantCoins) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(wantCoins))
+	}
+	for i, entry := range entries {
+		if entry.Coin != wantCoins[i] {
+			t.Errorf("entry %d = %s, want %s", i, entry.Coin, wantCoins[i])
+		}
+		if entry.Id == "dogecoin" {
+			if entry.Metadata != nil {
+				t.Errorf("doge has metadata %+v, but it failed to load", entry.Metadata)
+			}
+			continue
+		}
+		if entry.Metadata == nil || entry.Metadata.Name != "name of "+entry.Id {
+			t.Errorf("%s metadata = %+v", entry.Coin, entry.Metadata)
+		}
+	}
+	if entries[2].Contract != "0xdac1" || entries[3].Platform != "tron" {
+		t.Errorf("entries lost the contract of the token: %+v, %+v", entries[2], entries[3])
+	}
+}
+
+func TestRefreshMetadataKeepsLoadedOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider := &metadataSource{cancelAfter: 2, cancel: cancel, calls: make(map[string]int)}
+	w, store := newMetadataWatcher(provider)
+
+	err := w.RefreshWatchlistMetadata(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(provider.calls) != 2 {
+		t.Errorf("provider called for %v, refresh should stop after the cancel", provider.calls)
+	}
+	if store.saves != 1 || len(store.metadata) != 1 {
+		t.Errorf("saved %v, want the metadata loaded before the cancel", store.metadata)
+	}
+}
+
+func TestRefreshMetadataWithoutProvider(t *testing.T) {
+	w, store := newMetadataWatcher(fixedPrices{})
+
+	if err := w.RefreshWatchlistMetadata(context.Background()); !errors.Is(err, ErrNoMetadataProvider) {
+		t.Errorf("err = %v, want ErrNoMetadataProvider", err)
+	}
+	if store.saves != 0 {
+		t.Errorf("saved metadata without a provider: %v", store.metadata)
+	}
+}
@@ -2,18 +2,213 @@ package domain
 
 import (
 	"errors"
+	"fmt"
 	"github.com/shopspring/decimal"
+	"sort"
+	"strings"
+	"time"
 )
 
 var ErrNoVerifiedCoins = errors.New("no coins passed verification")
+var ErrCircuitOpen = errors.New("provider circuit is open")
+
+// AmbiguousCoinsError символ подходит под несколько монет провайдера и выбрать одну не получилось
+type AmbiguousCoinsError struct {
+	Candidates map[string][]KnownCoin //символ -> подходящие монеты
+}
+
+func (e *AmbiguousCoinsError) Error() string {
+	symbols := make([]string, 0, len(e.Candidates))
+	for symbol := range e.Candidates {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return fmt.Sprintf("ambiguous coin symbols, pass an explicit id: %s", strings.Join(symbols, ", "))
+}
+
+// PartialPricesError провайдер отдал цены не всех монет: часть запросов упала.
+// Полученные цены возвращаются вместе с ошибкой и годятся в дело, Missing - монеты без цены
+type PartialPricesError struct {
+	Missing []string
+	Err     error
+}
+
+func (e *PartialPricesError) Error() string {
+	return fmt.Sprintf("no prices for %d coins (%s): %v", len(e.Missing), strings.Join(e.Missing, ", "), e.Err)
+}
+
+func (e *PartialPricesError) Unwrap() error {
+	return e.Err
+}
 
 type Coin struct {
-	Name  string
-	Id    string
-	Price decimal.Decimal
+	Name     string
+	Id       string
+	Price    decimal.Decimal
+	Currency string                     //валюта котировки
+	Provider string                     //имя провайдера, который отдал цену
+	Quotes   map[string]decimal.Decimal //сырые котировки по провайдерам, если цена агрегированная
+
+	//рыночные данные, nil если провайдер их не отдал
+	MarketCap   *decimal.Decimal
+	Volume24h   *decimal.Decimal
+	Change24h   *decimal.Decimal //изменение цены за 24 часа в процентах
+	LastUpdated time.Time        //когда провайдер последний раз обновил цену, нулевое если неизвестно
+
+	Persisted bool //провайдер сам пишет эту цену в бд (стрим), ScanPrices её второй раз не записывает
+}
+
+const (
+	BackfillPending = "pending"
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// BackfillStatus состояние загрузки истории цен для монеты
+type BackfillStatus struct {
+	Coin       string
+	Status     string
+	Done       int //загружено окон (окно - один запрос истории в одной валюте)
+	Total      int
+	Samples    int64 //сколько цен добавлено в историю
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Error      string
+}
+
+// PriceSample сохранённая цена монеты
+type PriceSample struct {
+	Coin        string
+	Currency    string
+	Price       decimal.Decimal
+	Time        time.Time
+	Provider    string
+	MarketCap   *decimal.Decimal
+	Volume24h   *decimal.Decimal
+	Change24h   *decimal.Decimal
+	LastUpdated *time.Time
+	Conversion  *Conversion //заполнено, если цена пересчитана в другую валюту
+	Match       *PriceMatch //заполнено, если цена искалась на момент времени
+}
+
+// Conversion как цена была пересчитана: исходная валюта, курс и время курса
+type Conversion struct {
+	From     string
+	Rate     decimal.Decimal
+	RateTime time.Time
+}
+
+// CoinMetadata описание монеты от провайдера, меняется редко
+type CoinMetadata struct {
+	Id            string
+	Symbol        string
+	Name          string
+	ImageURL      string
+	Categories    []string
+	GenesisDate   *time.Time
+	MarketCapRank *int
+	UpdatedAt     time.Time
+}
+
+// WatchlistEntry монета из списка наблюдения вместе с описанием, если оно уже загружено
+type WatchlistEntry struct {
+	Coin string
+	WatchedCoin
+	Metadata *CoinMetadata
+}
+
+// FXRate курс фиатной валюты: сколько Quote дают за одну единицу Base
+type FXRate struct {
+	Base  string
+	Quote string
+	Rate  decimal.Decimal
+	Time  time.Time
+}
+
+// CoinRef монета, которую просят добавить: символ и, если нужно, явный id провайдера.
+// Токен можно указать сетью и адресом контракта, тогда символ служит только именем в списке наблюдения
+type CoinRef struct {
+	Symbol   string
+	Id       string
+	Platform string
+	Contract string
+}
+
+func (r CoinRef) IsContract() bool {
+	return r.Platform != "" && r.Contract != ""
+}
+
+// WatchedCoin монета из списка наблюдения: id провайдера и, для токенов, сеть и адрес контракта
+type WatchedCoin struct {
+	Id       string
+	Platform string
+	Contract string
+}
+
+func (c WatchedCoin) IsContract() bool {
+	return c.Platform != "" && c.Contract != ""
+}
+
+// ContractKey имя токена в списке наблюдения, если символ не указан: символы токенов часто совпадают
+func ContractKey(platform, contract string) string {
+	return strings.ToLower(platform) + ":" + strings.ToLower(contract)
+}
+
+// монета из полного списка провайдера (а не из списка наблюдения)
+type KnownCoin struct {
+	Id     string
+	Symbol string
+	Name   string
+}
+
+// статистика ограничения запросов к провайдеру
+type ThrottleStats struct {
+	Provider       string
+	Requests       int64         //попыток запроса, включая повторы
+	Throttled      int64         //сколько раз ждали свободный токен
+	ThrottleWait   time.Duration //сколько всего ждали токены
+	RateLimited    int64         //ответов 429
+	ServerErrors   int64         //ответов 5xx
+	Retries        int64
+	Failed         int64 //запросов, которые так и не удались
+	LastRetryAfter time.Duration
+}
+
+// ScanReport итог последнего скана цен. Stale - котировки, которые провайдер не обновлял с прошлого скана
+type ScanReport struct {
+	Time        time.Time
+	Stored      int
+	Stale       int
+	StaleCoins  []string //монета/валюта
+	TotalStored int64    //с запуска сервиса
+	TotalStale  int64
+}
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ProviderHealth состояние предохранителя провайдера
+type ProviderHealth struct {
+	Provider    string
+	State       string //closed, open, half_open
+	Failures    int    //ошибок подряд
+	LastError   string
+	LastFailure *time.Time
+	OpenedAt    *time.Time
+	RetryAt     *time.Time //когда открытый предохранитель пропустит пробный запрос
+}
+
+type CoinListCacheInfo struct {
+	Provider  string
+	Coins     int
+	UpdatedAt time.Time
 }
 
-func extractKeys(input map[string]string) []string {
+func extractKeys(input map[string]WatchedCoin) []string {
 	keys := make([]string, 0, len(input))
 	for key := range input {
 		keys = append(keys, key)
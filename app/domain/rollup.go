@@ -0,0 +1,228 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Уровни истории цен, от подробного к грубому
+const (
+	TierRaw    = "raw" //price_history как есть
+	TierMinute = "1m"
+	TierHour   = "1h"
+	TierDay    = "1d"
+)
+
+// HistoryTiers все уровни истории, от подробного к грубому
+var HistoryTiers = []string{TierRaw, TierMinute, TierHour, TierDay}
+
+// RollupTier свёрнутый уровень: интервалы по Size, собранные из уровня Source
+type RollupTier struct {
+	Name   string
+	Size   time.Duration
+	Source string
+}
+
+// RollupTiers в порядке свёртки: каждый следующий собирается из предыдущего
+var RollupTiers = []RollupTier{
+	{Name: TierMinute, Size: time.Minute, Source: TierRaw},
+	{Name: TierHour, Size: time.Hour, Source: TierMinute},
+	{Name: TierDay, Size: 24 * time.Hour, Source: TierHour},
+}
+
+// tierCoverage с какого и до какого времени в каждом уровне есть строки, по всем монетам сразу.
+// Пересчитывается после свёртки и очистки, поэтому выбор уровня для запроса не ходит в бд
+type tierCoverage struct {
+	mu       sync.RWMutex
+	earliest map[string]time.Time //пустых уровней здесь нет
+	end      map[string]time.Time //конец последнего свёрнутого интервала
+}
+
+func newTierCoverage() *tierCoverage {
+	return &tierCoverage{earliest: make(map[string]time.Time), end: make(map[string]time.Time)}
+}
+
+func (c *tierCoverage) set(earliest map[string]time.Time, end map[string]time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.earliest = earliest
+	c.end = end
+}
+
+func (c *tierCoverage) start(tier string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	start, ok := c.earliest[tier]
+	return start, ok
+}
+
+// до какого времени уровень свёрнут, у сырых цен и пустых уровней - нулевое время
+func (c *tierCoverage) until(tier string) time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.end[tier]
+}
+
+// размер строки уровня, у сырых цен - 0
+func tierSize(tier string) time.Duration {
+	for _, rollup := range RollupTiers {
+		if rollup.Name == tier {
+			return rollup.Size
+		}
+	}
+	return 0
+}
+
+// RunRollups сворачивает цены, появившиеся с прошлого запуска, и удаляет строки старше срока хранения уровня.
+// Цены пишутся со временем провайдера и могут прийти позже уже свёрнутого интервала, поэтому
+// последние rollups.grace каждого уровня пересчитываются заново. Незаконченный текущий интервал не сворачивается
+func (w Watcher) RunRollups(ctx context.Context) error {
+	const op = "domain.Watcher.RunRollups"
+
+	now := time.Now().UTC()
+	for _, tier := range RollupTiers {
+		from, err := w.store.LatestHistoryTime(ctx, tier.Name)
+		if err != nil {
+			w.log.Error(op, "failed to get latest rollup", tier.Name, "error", err)
+			return err
+		}
+		if !from.IsZero() {
+			from = from.Add(-w.cfg.Rollups.Grace).Truncate(tier.Size)
+		}
+		to := now.Truncate(tier.Size)
+		if !from.Before(to) {
+			continue
+		}
+		rows, err := w.store.RollupPrices(ctx, tier, from, to)
+		if err != nil {
+			w.log.Error(op, "failed to roll up prices", tier.Name, "error", err)
+			return err
+		}
+		w.log.Debug(op, "rolled up tier", tier.Name, "rows", rows)
+	}
+	err := w.expireHistory(ctx, now)
+	if err != nil {
+		return err
+	}
+	return w.refreshCoverage(ctx)
+}
+
+// RollupRange пересчитывает все уровни за период, например после загрузки старой истории
+func (w Watcher) RollupRange(ctx context.Context, from, to time.Time) error {
+	const op = "domain.Watcher.RollupRange"
+
+	for _, tier := range RollupTiers {
+		//период расширяется до целых интервалов уровня, иначе крайние интервалы пересчитаются не полностью
+		tierFrom, tierTo := from.Truncate(tier.Size), to.Truncate(tier.Size)
+		if tierTo.Before(to) {
+			tierTo = tierTo.Add(tier.Size)
+		}
+		_, err := w.store.RollupPrices(ctx, tier, tierFrom, tierTo)
+		if err != nil {
+			w.log.Error(op, "failed to roll up prices", tier.Name, "error", err)
+			return err
+		}
+	}
+	return w.refreshCoverage(ctx)
+}
+
+// перечитывает, с какого и до какого времени есть строки в каждом уровне
+func (w Watcher) refreshCoverage(ctx context.Context) error {
+	const op = "domain.Watcher.refreshCoverage"
+
+	earliest := make(map[string]time.Time, len(HistoryTiers))
+	end := make(map[string]time.Time, len(RollupTiers))
+	for _, tier := range HistoryTiers {
+		start, err := w.store.EarliestHistoryTime(ctx, tier)
+		if err != nil {
+			w.log.Error(op, "failed to get earliest history time", tier, "error", err)
+			return err
+		}
+		if start.IsZero() {
+			continue
+		}
+		earliest[tier] = start
+		if tier == TierRaw {
+			continue
+		}
+		latest, err := w.store.LatestHistoryTime(ctx, tier)
+		if err != nil {
+			w.log.Error(op, "failed to get latest history time", tier, "error", err)
+			return err
+		}
+		end[tier] = latest.Add(tierSize(tier))
+	}
+	w.coverage.set(earliest, end)
+	w.log.Debug(op, "history coverage", earliest, "rolled up until", end)
+	return nil
+}
+
+// удаляет строки старше срока хранения уровня, но не те, что ещё не свёрнуты в следующий уровень
+// или будут пересчитаны заново в пределах rollups.grace
+func (w Watcher) expireHistory(ctx context.Context, now time.Time) error {
+	const op = "domain.Watcher.expireHistory"
+
+	cfg := w.cfg.Rollups.Retention
+	retention := map[string]time.Duration{
+		TierRaw:    cfg.Raw,
+		TierMinute: cfg.Minute,
+		TierHour:   cfg.Hour,
+		TierDay:    cfg.Day,
+	}
+	for i, tier := range HistoryTiers {
+		if retention[tier] <= 0 {
+			continue
+		}
+		cutoff := now.Add(-retention[tier])
+		if i+1 < len(HistoryTiers) {
+			rolledUp, err := w.store.LatestHistoryTime(ctx, HistoryTiers[i+1])
+			if err != nil {
+				w.log.Error(op, "failed to get latest rollup", HistoryTiers[i+1], "error", err)
+				return err
+			}
+			if !rolledUp.IsZero() {
+				rolledUp = rolledUp.Add(-w.cfg.Rollups.Grace)
+			}
+			if rolledUp.Before(cutoff) {
+				cutoff = rolledUp
+			}
+		}
+		if cutoff.IsZero() { //следующий уровень ещё пуст
+			continue
+		}
+		deleted, err := w.store.DeleteHistoryBefore(ctx, tier, cutoff)
+		if err != nil {
+			w.log.Error(op, "failed to delete expired history", tier, "error", err)
+			return err
+		}
+		if deleted > 0 {
+			w.log.Info(op, "deleted expired rows", deleted, "tier", tier, "before", cutoff)
+		}
+	}
+	return nil
+}
+
+// historyTier самый подробный из уровней usable, где есть цены не позже at.
+// Если at раньше всех, берётся уровень, уходящий дальше всех в прошлое. Без rollups.enabled или до первой свёртки -
+// всегда сырые цены. Покрытие уровней общее для всех монет и берётся из кэша, который обновляет RunRollups
+func (w Watcher) historyTier(at time.Time, usable func(tier string) bool) string {
+	if !w.cfg.Rollups.Enabled {
+		return TierRaw
+	}
+
+	tier, oldest := TierRaw, time.Time{}
+	for _, candidate := range HistoryTiers {
+		start, ok := w.coverage.start(candidate)
+		if !ok || !usable(candidate) {
+			continue
+		}
+		if !start.After(at) {
+			return candidate
+		}
+		if oldest.IsZero() || start.Before(oldest) {
+			tier, oldest = candidate, start
+		}
+	}
+	return tier
+}
@@ -0,0 +1,347 @@
+package domain
+
+import (
+	"context"
+	"cryptoRestTest/internal/config"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// хранилище уровней истории в памяти: для каждого уровня помнит первую и последнюю строку.
+// Остальные методы CoinsStore не нужны и при вызове упадут
+type tiersStore struct {
+	CoinsStore
+	earliest map[string]time.Time
+	latest   map[string]time.Time
+	deleted  map[string]time.Time //уровень -> до какого времени удалены строки
+	rolled   []string
+}
+
+func newTiersStore() *tiersStore {
+	return &tiersStore{
+		earliest: make(map[string]time.Time),
+		latest:   make(map[string]time.Time),
+		deleted:  make(map[string]time.Time),
+	}
+}
+
+func (s *tiersStore) RollupPrices(ctx context.Context, tier RollupTier, from, to time.Time) (int64, error) {
+	s.rolled = append(s.rolled, tier.Name)
+	return 0, nil
+}
+
+func (s *tiersStore) LatestHistoryTime(ctx context.Context, tier string) (time.Time, error) {
+	return s.latest[tier], nil
+}
+
+func (s *tiersStore) EarliestHistoryTime(ctx context.Context, tier string) (time.Time, error) {
+	return s.earliest[tier], nil
+}
+
+func (s *tiersStore) DeleteHistoryBefore(ctx context.Context, tier string, before time.Time) (int64, error) {
+	s.deleted[tier] = before
+	if s.earliest[tier].Before(before) {
+		s.earliest[tier] = before
+	}
+	return 1, nil
+}
+
+func newRollupWatcher(store CoinsStore, retention config.Retention) *Watcher {
+	cfg := &config.Config{}
+	cfg.Rollups.Enabled = true
+	cfg.Rollups.Retention = retention
+	return NewWatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cfg)
+}
+
+var rollupNow = time.Date(2025, 2, 10, 12, 0, 0, 0, time.UTC)
+
+func TestExpireHistory(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		retention config.Retention
+		grace     time.Duration
+		latest    map[string]time.Time
+		want      map[string]time.Time //уровень -> граница удаления, отсутствие - ничего не удалено
+	}{
+		{
+			name:      "rolled up rows expire by retention",
+			retention: config.Retention{Raw: time.Hour, Minute: 24 * time.Hour},
+			latest:    map[string]time.Time{TierMinute: rollupNow.Add(-time.Minute), TierHour: rollupNow.Add(-time.Hour)},
+			want:      map[string]time.Time{TierRaw: rollupNow.Add(-time.Hour), TierMinute: rollupNow.Add(-24 * time.Hour)},
+		},
+		{
+			name:      "not yet rolled up is never deleted",
+			retention: config.Retention{Raw: time.Hour, Minute: time.Hour},
+			latest:    map[string]time.Time{TierMinute: rollupNow.Add(-3 * time.Hour), TierHour: rollupNow.Add(-5 * time.Hour)},
+			want:      map[string]time.Time{TierRaw: rollupNow.Add(-3 * time.Hour), TierMinute: rollupNow.Add(-5 * time.Hour)},
+		},
+		{
+			name:      "nothing is deleted while the next tier is empty",
+			retention: config.Retention{Raw: time.Hour, Minute: time.Hour},
+			latest:    map[string]time.Time{TierMinute: rollupNow.Add(-time.Minute)},
+			want:      map[string]time.Time{TierRaw: rollupNow.Add(-time.Hour)},
+		},
+		{
+			name:      "rows inside grace wait for the next rollup",
+			retention: config.Retention{Raw: time.Minute},
+			grace:     15 * time.Minute,
+			latest:    map[string]time.Time{TierMinute: rollupNow.Add(-time.Minute)},
+			want:      map[string]time.Time{TierRaw: rollupNow.Add(-16 * time.Minute)},
+		},
+		{
+			name:      "zero retention keeps the tier forever",
+			retention: config.Retention{Hour: time.Hour},
+			latest:    map[string]time.Time{TierMinute: rollupNow, TierHour: rollupNow, TierDay: rollupNow.Add(-24 * time.Hour)},
+			want:      map[string]time.Time{TierHour: rollupNow.Add(-24 * time.Hour)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newTiersStore()
+			store.latest = tc.latest
+			w := newRollupWatcher(store, tc.retention)
+			w.cfg.Rollups.Grace = tc.grace
+
+			if err := w.expireHistory(context.Background(), rollupNow); err != nil {
+				t.Fatalf("expireHistory: %v", err)
+			}
+			for _, tier := range HistoryTiers {
+				got, deleted := store.deleted[tier]
+				want, ok := tc.want[tier]
+				if deleted != ok || !got.Equal(want) {
+					t.Errorf("%s: deleted before %s (%t), want %s (%t)", tier, got, deleted, want, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryTier(t *testing.T) {
+	coverage := map[string]time.Time{
+		TierRaw:    rollupNow.Add(-7 * 24 * time.Hour),
+		TierMinute: rollupNow.Add(-30 * 24 * time.Hour),
+		TierHour:   rollupNow.Add(-365 * 24 * time.Hour),
+		TierDay:    rollupNow.Add(-3 * 365 * 24 * time.Hour),
+	}
+	everyTier := func(string) bool { return true }
+	for _, tc := range []struct {
+		name     string
+		coverage map[string]time.Time
+		at       time.Time
+		usable   func(string) bool
+		want     string
+	}{
+		{name: "recent time uses raw prices", coverage: coverage, at: rollupNow.Add(-time.Hour), usable: everyTier, want: TierRaw},
+		{name: "exactly at the raw start", coverage: coverage, at: coverage[TierRaw], usable: everyTier, want: TierRaw},
+		{name: "older than raw uses minutes", coverage: coverage, at: rollupNow.Add(-10 * 24 * time.Hour), usable: everyTier, want: TierMinute},
+		{name: "older than minutes uses hours", coverage: coverage, at: rollupNow.Add(-100 * 24 * time.Hour), usable: everyTier, want: TierHour},
+		{name: "before all history uses the oldest tier", coverage: coverage, at: rollupNow.Add(-10 * 365 * 24 * time.Hour), usable: everyTier, want: TierDay},
+		{
+			name: "unusable tiers are skipped", coverage: coverage, at: rollupNow.Add(-100 * 24 * time.Hour),
+			usable: func(tier string) bool { return tier != TierHour }, want: TierDay,
+		},
+		{
+			name: "empty tiers are skipped", coverage: map[string]time.Time{TierRaw: coverage[TierRaw], TierHour: coverage[TierHour]},
+			at: rollupNow.Add(-10 * 24 * time.Hour), usable: everyTier, want: TierHour,
+		},
+		{name: "no coverage yet uses raw prices", coverage: map[string]time.Time{}, at: rollupNow.Add(-100 * 24 * time.Hour), usable: everyTier, want: TierRaw},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newRollupWatcher(newTiersStore(), config.Retention{})
+			w.coverage.set(tc.coverage, nil)
+			if got := w.historyTier(tc.at, tc.usable); got != tc.want {
+				t.Errorf("historyTier = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHistoryTierWithoutRollups(t *testing.T) {
+	w := newRollupWatcher(newTiersStore(), config.Retention{})
+	w.cfg.Rollups.Enabled = false
+	w.coverage.set(map[string]time.Time{TierDay: rollupNow.Add(-365 * 24 * time.Hour)}, nil)
+	if got := w.historyTier(rollupNow, func(string) bool { return true }); got != TierRaw {
+		t.Errorf("historyTier = %s, want raw", got)
+	}
+}
+
+func TestFitsTier(t *testing.T) {
+	load := func(name string) *time.Location {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return location
+	}
+	//период с переходом на летнее время и в Европе, и в Австралии
+	from, to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)
+	day, week := 24*time.Hour, 7*24*time.Hour
+	for _, tc := range []struct {
+		location *time.Location
+		interval time.Duration
+		want     map[string]bool
+	}{
+		{time.UTC, 90 * time.Second, map[string]bool{TierRaw: true, TierMinute: false, TierHour: false, TierDay: false}},
+		{time.UTC, 15 * time.Minute, map[string]bool{TierRaw: true, TierMinute: true, TierHour: false, TierDay: false}},
+		{time.UTC, 90 * time.Minute, map[string]bool{TierRaw: true, TierMinute: true, TierHour: false, TierDay: false}},
+		{time.UTC, 4 * time.Hour, map[string]bool{TierRaw: true, TierMinute: true, TierHour: true, TierDay: false}},
+		{time.UTC, day, map[string]bool{TierRaw: true, TierMinute: true, TierHour: true, TierDay: true}},
+		{time.UTC, week, map[string]bool{TierRaw: true, TierMinute: true, TierHour: true, TierDay: true}},
+		{load("Europe/Berlin"), day, map[string]bool{TierRaw: true, TierMinute: true, TierHour: true, TierDay: false}},
+		{load("Asia/Kolkata"), day, map[string]bool{TierRaw: true, TierMinute: true, TierHour: false, TierDay: false}},
+		{load("Australia/Adelaide"), week, map[string]bool{TierRaw: true, TierMinute: true, TierHour: false, TierDay: false}},
+		//+10:30 зимой и +11:00 летом: на летнем отрезке час годился бы, но период захватывает оба
+		{load("Australia/Lord_Howe"), day, map[string]bool{TierRaw: true, TierMinute: true, TierHour: false, TierDay: false}},
+		//интервалы короче суток от пояса не зависят
+		{load("Asia/Kolkata"), 2 * time.Hour, map[string]bool{TierRaw: true, TierMinute: true, TierHour: true, TierDay: false}},
+	} {
+		query := HistoryQuery{From: from, To: to, Interval: tc.interval, Location: tc.location}
+		for tier, want := range tc.want {
+			if got := query.fitsTier(tier); got != want {
+				t.Errorf("%s %s: fitsTier(%s) = %t, want %t", tc.location, tc.interval, tier, got, want)
+			}
+		}
+	}
+}
+
+func TestRunRollupsRefreshesCoverage(t *testing.T) {
+	store := newTiersStore()
+	store.earliest = map[string]time.Time{TierRaw: rollupNow.Add(-48 * time.Hour), TierMinute: rollupNow.Add(-48 * time.Hour)}
+	store.latest = map[string]time.Time{TierMinute: rollupNow.Add(-time.Minute)}
+	w := newRollupWatcher(store, config.Retention{Raw: 24 * time.Hour})
+
+	at := rollupNow.Add(-36 * time.Hour)
+	if got := w.historyTier(at, func(string) bool { return true }); got != TierRaw {
+		t.Fatalf("before the first run historyTier = %s, want raw", got)
+	}
+	if err := w.RunRollups(context.Background()); err != nil {
+		t.Fatalf("RunRollups: %v", err)
+	}
+	if len(store.rolled) != len(RollupTiers) {
+		t.Errorf("rolled up %v, want every tier", store.rolled)
+	}
+	//сырые цены удалены до последней свёртки в минуты, за ними теперь идём в минутный уровень
+	if got := w.historyTier(at, func(string) bool { return true }); got != TierMinute {
+		t.Errorf("after the run historyTier = %s, want 1m", got)
+	}
+}
+
+// сырые цены и минутный уровень в памяти, свёртка в минуты настоящая
+type lateStore struct {
+	*tiersStore
+	raw     []time.Time
+	minutes map[time.Time]int64 //начало минуты -> сколько в ней цен
+}
+
+func (s *lateStore) RollupPrices(ctx context.Context, tier RollupTier, from, to time.Time) (int64, error) {
+	if tier.Name != TierMinute {
+		return 0, nil
+	}
+	//как upsert в бд: интервалы периода пересчитываются целиком
+	for bucket := range s.minutes {
+		if !bucket.Before(from) && bucket.Before(to) {
+			delete(s.minutes, bucket)
+		}
+	}
+	for _, at := range s.raw {
+		if !at.Before(from) && at.Before(to) {
+			s.minutes[at.Truncate(time.Minute)]++
+		}
+	}
+	return int64(len(s.minutes)), nil
+}
+
+func (s *lateStore) LatestHistoryTime(ctx context.Context, tier string) (time.Time, error) {
+	if tier != TierMinute {
+		return time.Time{}, nil
+	}
+	var latest time.Time
+	for bucket := range s.minutes {
+		if bucket.After(latest) {
+			latest = bucket
+		}
+	}
+	return latest, nil
+}
+
+func TestRunRollupsPicksUpLateSamples(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	for _, tc := range []struct {
+		name  string
+		grace time.Duration
+		want  bool
+	}{
+		{name: "late sample within grace is rolled up", grace: 15 * time.Minute, want: true},
+		{name: "without grace it is lost", grace: 0, want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &lateStore{tiersStore: newTiersStore(), minutes: make(map[time.Time]int64)}
+			store.raw = []time.Time{now.Add(-10 * time.Minute), now.Add(-5 * time.Minute)}
+			w := newRollupWatcher(store, config.Retention{})
+			w.cfg.Rollups.Grace = tc.grace
+
+			if err := w.RunRollups(context.Background()); err != nil {
+				t.Fatalf("RunRollups: %v", err)
+			}
+			//провайдер прислал цену с last_updated_at раньше уже свёрнутой минуты
+			late := now.Add(-8*time.Minute + 30*time.Second)
+			store.raw = append(store.raw, late)
+			if err := w.RunRollups(context.Background()); err != nil {
+				t.Fatalf("RunRollups: %v", err)
+			}
+
+			if _, ok := store.minutes[late.Truncate(time.Minute)]; ok != tc.want {
+				t.Errorf("late minute rolled up = %t, want %t (minutes %v)", ok, tc.want, store.minutes)
+			}
+			if store.minutes[now.Add(-10*time.Minute)] != 1 || store.minutes[now.Add(-5*time.Minute)] != 1 {
+				t.Errorf("re-rolling changed earlier minutes: %v", store.minutes)
+			}
+		})
+	}
+}
+
+// запоминает, с каким запросом пришли за историей
+type historyStore struct {
+	*tiersStore
+	query HistoryQuery
+}
+
+func (s *historyStore) GetPriceHistory(ctx context.Context, query HistoryQuery, fn func(PriceBucket) error) error {
+	s.query = query
+	return nil
+}
+
+func TestPriceHistoryReadsUnrolledTailFromRaw(t *testing.T) {
+	store := &historyStore{tiersStore: newTiersStore()}
+	store.earliest = map[string]time.Time{TierRaw: rollupNow.Add(-24 * time.Hour), TierHour: rollupNow.Add(-365 * 24 * time.Hour)}
+	store.latest = map[string]time.Time{TierHour: rollupNow.Add(-2 * time.Hour)}
+	w := newRollupWatcher(store, config.Retention{})
+	if err := w.refreshCoverage(context.Background()); err != nil {
+		t.Fatalf("refreshCoverage: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		from    time.Time
+		to      time.Time
+		tier    string
+		tierEnd time.Time
+	}{
+		{name: "range up to now fills the tail", from: rollupNow.Add(-30 * 24 * time.Hour), to: rollupNow, tier: TierHour, tierEnd: rollupNow.Add(-time.Hour)},
+		{name: "range inside the rolled up hours", from: rollupNow.Add(-30 * 24 * time.Hour), to: rollupNow.Add(-3 * time.Hour), tier: TierHour},
+		{name: "raw prices have no tail", from: rollupNow.Add(-time.Hour), to: rollupNow, tier: TierRaw},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := w.PriceHistory(context.Background(), HistoryQuery{
+				Coin: "btc", Currency: "usd", From: tc.from, To: tc.to, Interval: time.Hour, Aggregation: AggregateAvg,
+			}, func(PriceBucket) error { return nil })
+			if err != nil {
+				t.Fatalf("PriceHistory: %v", err)
+			}
+			if store.query.Tier != tc.tier || !store.query.TierEnd.Equal(tc.tierEnd) {
+				t.Errorf("tier %s until %s, want %s until %s", store.query.Tier, store.query.TierEnd, tc.tier, tc.tierEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// scanState помнит, до какого времени провайдер уже обновлял каждую котировку,
+// чтобы не писать одну и ту же цену под новым временем
+type scanState struct {
+	mu         sync.Mutex
+	lastSource map[sampleKey]time.Time
+	report     ScanReport
+}
+
+type sampleKey struct {
+	coin     string
+	currency string
+}
+
+func newScanState() *scanState {
+	return &scanState{lastSource: make(map[sampleKey]time.Time)}
+}
+
+// убирает цены, которые провайдер уже записал сам, и возвращает, сколько их было
+func withoutPersisted(coins []Coin) ([]Coin, int) {
+	result := make([]Coin, 0, len(coins))
+	for _, coin := range coins {
+		if !coin.Persisted {
+			result = append(result, coin)
+		}
+	}
+	return result, len(coins) - len(result)
+}
+
+// делит котировки на свежие и устаревшие. Котировка без времени провайдера всегда считается свежей
+func (s *scanState) split(coins []Coin) (fresh []Coin, stale []Coin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, coin := range coins {
+		last, ok := s.lastSource[sampleKey{coin: coin.Name, currency: coin.Currency}]
+		if ok && !coin.LastUpdated.IsZero() && !coin.LastUpdated.After(last) {
+			stale = append(stale, coin)
+			continue
+		}
+		fresh = append(fresh, coin)
+	}
+	return fresh, stale
+}
+
+// запоминает время записанных котировок и итог скана
+func (s *scanState) record(stored []Coin, stale []Coin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, coin := range stored {
+		if !coin.LastUpdated.IsZero() {
+			s.lastSource[sampleKey{coin: coin.Name, currency: coin.Currency}] = coin.LastUpdated
+		}
+	}
+
+	staleCoins := make([]string, 0, len(stale))
+	for _, coin := range stale {
+		staleCoins = append(staleCoins, coin.Name+"/"+coin.Currency)
+	}
+	s.report = ScanReport{
+		Time:        time.Now().UTC(),
+		Stored:      len(stored),
+		Stale:       len(stale),
+		StaleCoins:  staleCoins,
+		TotalStored: s.report.TotalStored + int64(len(stored)),
+		TotalStale:  s.report.TotalStale + int64(len(stale)),
+	}
+}
+
+func (s *scanState) lastReport() ScanReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.report
+}
@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"context"
+	"cryptoRestTest/internal/config"
+	"github.com/shopspring/decimal"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+// провайдер с заранее заданным ответом
+type fixedPrices []Coin
+
+func (p fixedPrices) CoinsPrice(ctx context.Context, coins map[string]WatchedCoin) ([]Coin, error) {
+	return p, nil
+}
+
+func (p fixedPrices) VerifyCoins(ctx context.Context, coins []CoinRef) (map[string]WatchedCoin, error) {
+	return nil, nil
+}
+
+// хранилище, которое запоминает записанные цены
+type scanStore struct {
+	CoinsStore
+	stored []Coin
+}
+
+func (s *scanStore) GetObserveredCoinsList(ctx context.Context) (map[string]WatchedCoin, error) {
+	return map[string]WatchedCoin{"btc": {Id: "bitcoin"}, "eth": {Id: "ethereum"}}, nil
+}
+
+func (s *scanStore) AddCoinsPrices(ctx context.Context, coins []Coin) error {
+	s.stored = append(s.stored, coins...)
+	return nil
+}
+
+func TestScanPricesSkipsPersistedPrices(t *testing.T) {
+	updated := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	provider := fixedPrices{
+		{Name: "btc", Id: "bitcoin", Price: decimal.NewFromInt(97000), Currency: "usd", LastUpdated: updated, Persisted: true},
+		{Name: "eth", Id: "ethereum", Price: decimal.NewFromInt(3300), Currency: "usd", LastUpdated: updated},
+	}
+	store := &scanStore{}
+	w := NewWatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), provider, &config.Config{})
+
+	if err := w.ScanPrices(context.Background()); err != nil {
+		t.Fatalf("ScanPrices: %v", err)
+	}
+	if len(store.stored) != 1 || store.stored[0].Name != "eth" {
+		t.Errorf("stored %v, want only eth", store.stored)
+	}
+}
+
+// провайдер, который на каждом скане отдаёт следующий ответ
+type scanSequence struct {
+	scans [][]Coin
+}
+
+func (p *scanSequence) CoinsPrice(ctx context.Context, coins map[string]WatchedCoin) ([]Coin, error) {
+	next := p.scans[0]
+	p.scans = p.scans[1:]
+	return next, nil
+}
+
+func (p *scanSequence) VerifyCoins(ctx context.Context, coins []CoinRef) (map[string]WatchedCoin, error) {
+	return nil, nil
+}
+
+func TestScanPricesSkipsStaleQuotes(t *testing.T) {
+	first := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Minute)
+	quote := func(name, currency string, updated time.Time) Coin {
+		return Coin{Name: name, Price: decimal.NewFromInt(1), Currency: currency, LastUpdated: updated}
+	}
+	provider := &scanSequence{scans: [][]Coin{
+		{quote("btc", "usd", first), quote("btc", "eur", first), quote("eth", "usd", first)},
+		//btc не обновился, eth сдвинулся, eur у btc хранится отдельно от usd
+		{quote("btc", "usd", first), quote("btc", "eur", second), quote("eth", "usd", second)},
+		//время из прошлого тоже не пишется, а котировка без времени пишется всегда
+		{quote("btc", "usd", first.Add(-time.Minute)), quote("btc", "eur", second), quote("eth", "usd", time.Time{})},
+	}}
+	store := &scanStore{}
+	w := NewWatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), provider, &config.Config{})
+
+	wantStored := [][]string{
+		{"btc/usd", "btc/eur", "eth/usd"},
+		{"btc/eur", "eth/usd"},
+		{"eth/usd"},
+	}
+	wantStale := [][]string{
+		{},
+		{"btc/usd"},
+		{"btc/usd", "btc/eur"},
+	}
+	var totalStored, totalStale int64
+	for i := range wantStored {
+		store.stored = nil
+		if err := w.ScanPrices(context.Background()); err != nil {
+			t.Fatalf("scan %d: %v", i+1, err)
+		}
+
+		stored := make([]string, 0, len(store.stored))
+		for _, coin := range store.stored {
+			stored = append(stored, coin.Name+"/"+coin.Currency)
+		}
+		if !slices.Equal(stored, wantStored[i]) {
+			t.Errorf("scan %d stored %v, want %v", i+1, stored, wantStored[i])
+		}
+
+		report := w.LastScan()
+		totalStored += int64(len(wantStored[i]))
+		totalStale += int64(len(wantStale[i]))
+		if !slices.Equal(report.StaleCoins, wantStale[i]) {
+			t.Errorf("scan %d stale %v, want %v", i+1, report.StaleCoins, wantStale[i])
+		}
+		if report.Stored != len(wantStored[i]) || report.Stale != len(wantStale[i]) {
+			t.Errorf("scan %d report %d stored/%d stale, want %d/%d", i+1, report.Stored, report.Stale, len(wantStored[i]), len(wantStale[i]))
+		}
+		if report.TotalStored != totalStored || report.TotalStale != totalStale {
+			t.Errorf("scan %d totals %d/%d, want %d/%d", i+1, report.TotalStored, report.TotalStale, totalStored, totalStale)
+		}
+	}
+}
@@ -3,9 +3,9 @@ package domain
 import (
 	"context"
 	"cryptoRestTest/internal/config"
-	"github.com/shopspring/decimal"
+	"errors"
 	"log/slog"
-	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,57 +14,118 @@ type Watcher struct {
 	log      *slog.Logger
 	cfg      *config.Config
 	provider Provider
-	ctx      context.Context
+	scans    *scanState
+	coverage *tierCoverage
 }
 
-func NewWatcher(ctx context.Context, store CoinsStore, log *slog.Logger, provider Provider, cfg *config.Config) *Watcher {
+func NewWatcher(store CoinsStore, log *slog.Logger, provider Provider, cfg *config.Config) *Watcher {
 	return &Watcher{
 		store:    store,
 		log:      log,
 		cfg:      cfg,
 		provider: provider,
-		ctx:      ctx,
+		scans:    newScanState(),
+		coverage: newTierCoverage(),
 	}
 }
 
 type CoinsStore interface {
-	AddObserveredCoins(ctx context.Context, coins map[string]string) error
-	GetObserveredCoinsList(ctx context.Context) (map[string]string, error)
+	AddObserveredCoins(ctx context.Context, coins map[string]WatchedCoin) error
+	GetObserveredCoinsList(ctx context.Context) (map[string]WatchedCoin, error)
 	AddCoinsPrices(ctx context.Context, coins []Coin) error
-	GetPrice(ctx context.Context, coin string, timestamp time.Time) (decimal.Decimal, time.Time, error)
+	GetPrice(ctx context.Context, coin string, currency string, timestamp time.Time, lookup PriceLookup) (PriceSample, error)
+	GetPriceHistory(ctx context.Context, query HistoryQuery, fn func(PriceBucket) error) error
+	RollupPrices(ctx context.Context, tier RollupTier, from, to time.Time) (int64, error)
+	LatestHistoryTime(ctx context.Context, tier string) (time.Time, error)
+	DeleteHistoryBefore(ctx context.Context, tier string, before time.Time) (int64, error)
+	EarliestHistoryTime(ctx context.Context, tier string) (time.Time, error)
 	DeleteObserveredCoins(ctx context.Context, coins []string) error
+	AddPriceSamples(ctx context.Context, samples []PriceSample) (int64, error)
+	SaveBackfillStatus(ctx context.Context, status BackfillStatus) error
+	GetBackfillStatus(ctx context.Context, coin string) (BackfillStatus, error)
+	AddFXRates(ctx context.Context, rates []FXRate) error
+	GetFXRate(ctx context.Context, base string, quote string, timestamp time.Time) (FXRate, error)
+	SaveCoinMetadata(ctx context.Context, metadata []CoinMetadata) error
+	GetCoinMetadata(ctx context.Context, ids []string) (map[string]CoinMetadata, error)
 }
 
+// Provider источник текущих цен. Вызовы должны прерываться, как только отменён ctx
 type Provider interface {
-	CoinsPrice(coins map[string]string) ([]Coin, error)
-	VerifyCoins(coins []string) map[string]string
+	CoinsPrice(ctx context.Context, coins map[string]WatchedCoin) ([]Coin, error)
+	VerifyCoins(ctx context.Context, coins []CoinRef) (map[string]WatchedCoin, error)
 }
 
-func (w Watcher) AddObserveredCoins(coins []string) error {
+// HistoryProvider провайдер, который умеет отдавать исторические цены за период
+type HistoryProvider interface {
+	CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]PriceSample, error)
+}
+
+// FXSource провайдер, который знает курсы фиатных валют
+type FXSource interface {
+	FXRates(ctx context.Context, base string, quotes []string) ([]FXRate, error)
+}
+
+// MetadataProvider провайдер, который отдаёт описание монеты: название, картинку, категории, ранг
+type MetadataProvider interface {
+	CoinMetadata(ctx context.Context, id string) (CoinMetadata, error)
+}
+
+// Throttler провайдер, который ограничивает частоту запросов
+type Throttler interface {
+	ThrottleStats() []ThrottleStats
+}
+
+// HealthReporter провайдер, который знает состояние своих предохранителей
+type HealthReporter interface {
+	ProviderHealth() []ProviderHealth
+}
+
+// CoinListCacher провайдер, который кэширует полный список монет
+type CoinListCacher interface {
+	CoinListCacheInfo() []CoinListCacheInfo
+}
+
+func (w Watcher) AddObserveredCoins(ctx context.Context, coins []CoinRef) error {
 	const op = "domain.Watcher.AddObserveredCoins"
 
-	verifiedCoins := w.provider.VerifyCoins(coins)
+	verifiedCoins, err := w.provider.VerifyCoins(ctx, coins)
+	var ambiguous *AmbiguousCoinsError
+	if errors.As(err, &ambiguous) { //ничего не добавляем, пусть клиент уточнит id
+		w.log.Warn(op, "ambiguous coins", ambiguous.Candidates)
+		return err
+	}
+	if err != nil && len(verifiedCoins) == 0 {
+		w.log.Error(op, "failed to verify coins", err)
+		return err
+	}
 
 	if len(verifiedCoins) == 0 {
 		w.log.Warn(op, "no coins to add to the store", ErrNoVerifiedCoins)
 		return ErrNoVerifiedCoins
 	}
 
-	err := w.store.AddObserveredCoins(w.ctx, verifiedCoins)
+	err = w.store.AddObserveredCoins(ctx, verifiedCoins)
 	if err != nil {
 		w.log.Error(op, "failed to add observered coins to store", err)
 		return err
 	}
 
 	w.log.Debug(op, "added observered coins to store", verifiedCoins)
+	if w.cfg.CoinsWatcher.Backfill.Enabled {
+		//бэкфилл живёт дольше запроса на добавление, поэтому отмену запроса он не наследует
+		go w.Backfill(context.WithoutCancel(ctx), verifiedCoins)
+	}
+	if w.cfg.CoinsWatcher.Metadata.Enabled { //описание новых монет не ждёт планового обновления
+		go w.RefreshMetadata(context.WithoutCancel(ctx), verifiedCoins)
+	}
 	return nil
 }
 
-func (w Watcher) GetObserveredCoinsList() ([]string, error) {
+func (w Watcher) GetObserveredCoinsList(ctx context.Context) ([]string, error) {
 	const op = "domain.Watcher.GetObserveredCoinsList"
-	w.log.Debug(op, "started GetObserveredCoinsList")
+	w.log.Debug(op + ": started GetObserveredCoinsList")
 
-	coinsMap, err := w.store.GetObserveredCoinsList(w.ctx)
+	coinsMap, err := w.store.GetObserveredCoinsList(ctx)
 	if err != nil {
 		w.log.Error(op, "failed to get observered coins list", err)
 		return nil, err
@@ -74,39 +135,76 @@ func (w Watcher) GetObserveredCoinsList() ([]string, error) {
 	return coins, nil
 }
 
-func (w Watcher) DeleteObserveredCoins(coins []string) error { //в этой функции я не преобразую []string в []Coin, тк не хочу получить лишний цикл
+func (w Watcher) DeleteObserveredCoins(ctx context.Context, coins []string) error { //в этой функции я не преобразую []string в []Coin, тк не хочу получить лишний цикл
 	const op = "domain.Watcher.DeleteObserveredCoins"
 	w.log.Debug(op, "started DeleteObserveredCoins", coins)
 
-	err := w.store.DeleteObserveredCoins(w.ctx, coins)
+	err := w.store.DeleteObserveredCoins(ctx, coins)
 	if err != nil {
 		w.log.Error(op, "failed to delete observered coins from store", err)
 		return err
 	}
 
-	w.log.Debug(op, "successfully deleted observered coins")
+	w.log.Debug(op + ": successfully deleted observered coins")
 	return nil
 }
 
-func (w Watcher) GetTimePrice(coin string, time time.Time) (decimal.Decimal, string, error) {
+// GetTimePrice цена монеты в валюте currency на момент time, найденная способом lookup.
+// Если передан convertTo, цена пересчитывается в эту валюту по курсу, ближайшему ко времени цены
+func (w Watcher) GetTimePrice(ctx context.Context, coin string, currency string, convertTo string, time time.Time, lookup PriceLookup) (PriceSample, error) {
 	const op = "domain.Watcher.GetLastPrice"
 
-	w.log.Debug(op, "trying to get price for coin: ", coin, "time: ", time)
-	price, time, err := w.store.GetPrice(w.ctx, string(coin), time)
+	err := lookup.Validate()
+	if err != nil {
+		w.log.Debug(op, "invalid lookup", err)
+		return PriceSample{}, err
+	}
+	currency = strings.ToLower(currency)
+	lookup.Tier = w.historyTier(time, func(string) bool { return true })
+	w.log.Debug(op, "trying to get price for coin: ", coin, "currency", currency, "time: ", time, "lookup", lookup)
+	sample, err := w.store.GetPrice(ctx, string(coin), currency, time, lookup)
 	if err != nil {
 		w.log.Error(op, "failed to get price for coin: ", coin, "time: ", time)
-		return decimal.Zero, "", err
+		return PriceSample{}, err
+	}
+	w.log.Debug(op, "got price for coin: ", coin, "time: ", sample.Time)
+
+	convertTo = strings.ToLower(convertTo)
+	if convertTo == "" || convertTo == sample.Currency {
+		return sample, nil
 	}
-	timestamp := strconv.FormatInt(time.Unix(), 10) //Перевод времени в изначальный формат который передавался в запросе
-	w.log.Debug(op, "got price for coin: ", coin, "time: ", timestamp)
-	return price, timestamp, nil
+	return w.convert(ctx, sample, convertTo)
+}
+
+func (w Watcher) CoinListCacheInfo() []CoinListCacheInfo {
+	cacher, ok := w.provider.(CoinListCacher)
+	if !ok {
+		return nil
+	}
+	return cacher.CoinListCacheInfo()
+}
+
+func (w Watcher) ProviderHealth() []ProviderHealth {
+	reporter, ok := w.provider.(HealthReporter)
+	if !ok {
+		return nil
+	}
+	return reporter.ProviderHealth()
+}
+
+func (w Watcher) ThrottleStats() []ThrottleStats {
+	throttler, ok := w.provider.(Throttler)
+	if !ok {
+		return nil
+	}
+	return throttler.ThrottleStats()
 }
 
 // функция которая будет пробегать по монетам записанных в список наблюдения (бд) и записывать их цену+время
-func (w Watcher) ScanPrices() error {
+func (w Watcher) ScanPrices(ctx context.Context) error {
 	const op = "domain.Watcher.ScanPrices"
 
-	coinsMap, err := w.store.GetObserveredCoinsList(w.ctx)
+	coinsMap, err := w.store.GetObserveredCoinsList(ctx)
 	if err != nil {
 		w.log.Error(op, "failed to get observered coins list", err)
 	}
@@ -114,17 +212,40 @@ func (w Watcher) ScanPrices() error {
 		w.log.Info(op, "no observered coins to scan", "0 coins in storage")
 		return nil
 	}
-	w.log.Info(op, "starting ScanPrices for coins: ", coinsMap)
-	coins, err := w.provider.CoinsPrice(coinsMap)
-	if err != nil {
+	w.log.Info(op, "starting ScanPrices for coins: ", extractKeys(coinsMap))
+	coins, err := w.provider.CoinsPrice(ctx, coinsMap)
+	if errors.Is(err, ErrCircuitOpen) { //провайдеры отдыхают, об этом уже сказал предохранитель
+		w.log.Debug(op, "skipping scan", err)
+		return nil
+	}
+	var partial *PartialPricesError
+	if errors.As(err, &partial) { //цены, которые удалось получить, всё равно записываем
+		w.log.Warn(op, "got prices for part of the coins", err)
+	} else if err != nil {
 		w.log.Error(op, "failed to get coins prices", err)
 		return err
 	}
-	err = w.store.AddCoinsPrices(w.ctx, coins)
-	if err != nil {
-		w.log.Error(op, "failed to add coins prices", err)
-		return err
+
+	coins, persisted := withoutPersisted(coins)
+	if persisted > 0 {
+		w.log.Debug(op, "prices stored by the provider itself", persisted)
+	}
+	fresh, stale := w.scans.split(coins)
+	if len(stale) > 0 {
+		w.log.Info(op, "skipping stale quotes, provider has not updated them since the last scan", len(stale))
+	}
+	if len(fresh) > 0 {
+		err = w.store.AddCoinsPrices(ctx, fresh)
+		if err != nil {
+			w.log.Error(op, "failed to add coins prices", err)
+			return err
+		}
 	}
-	w.log.Info(op, "successfully added coins prices: ", extractKeys(coinsMap))
+	w.scans.record(fresh, stale)
+	w.log.Info(op, "successfully added coins prices: ", len(fresh))
 	return nil
 }
+
+func (w Watcher) LastScan() ScanReport {
+	return w.scans.lastReport()
+}
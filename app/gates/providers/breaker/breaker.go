@@ -0,0 +1,213 @@
+package breaker
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Breaker предохранитель вокруг провайдера. После FailureThreshold ошибок подряд он открывается
+// и сразу отказывает, не дожидаясь таймаута. Через OpenTimeout пропускает HalfOpenCalls пробных запросов:
+// удачный закрывает его, неудачный открывает снова
+type Breaker struct {
+	name     string
+	provider domain.Provider
+	cfg      config.Breaker
+	log      *slog.Logger
+	now      func() time.Time //часы, в тестах подменяются
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	trials   int //пробных запросов в полуоткрытом состоянии
+	lastErr  error
+	lastFail time.Time
+	openedAt time.Time
+	retryAt  time.Time
+}
+
+func New(name string, provider domain.Provider, cfg config.Breaker, log *slog.Logger) *Breaker {
+	return &Breaker{
+		name:     name,
+		provider: provider,
+		cfg:      cfg,
+		log:      log,
+		now:      time.Now,
+		state:    domain.CircuitClosed,
+	}
+}
+
+func (b *Breaker) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	prices, err := b.provider.CoinsPrice(ctx, coins)
+	b.done(ctx, err)
+	return prices, err
+}
+
+func (b *Breaker) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	verified, err := b.provider.VerifyCoins(ctx, coins)
+	b.done(ctx, err)
+	return verified, err
+}
+
+func (b *Breaker) CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]domain.PriceSample, error) {
+	history, ok := b.provider.(domain.HistoryProvider)
+	if !ok {
+		return nil, domain.ErrNoHistoryProvider
+	}
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	samples, err := history.CoinHistory(ctx, id, currency, from, to)
+	b.done(ctx, err)
+	return samples, err
+}
+
+func (b *Breaker) FXRates(ctx context.Context, base string, quotes []string) ([]domain.FXRate, error) {
+	source, ok := b.provider.(domain.FXSource)
+	if !ok {
+		return nil, domain.ErrNoFXProvider
+	}
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	rates, err := source.FXRates(ctx, base, quotes)
+	b.done(ctx, err)
+	return rates, err
+}
+
+func (b *Breaker) CoinMetadata(ctx context.Context, id string) (domain.CoinMetadata, error) {
+	provider, ok := b.provider.(domain.MetadataProvider)
+	if !ok {
+		return domain.CoinMetadata{}, domain.ErrNoMetadataProvider
+	}
+	if err := b.allow(); err != nil {
+		return domain.CoinMetadata{}, err
+	}
+	meta, err := provider.CoinMetadata(ctx, id)
+	b.done(ctx, err)
+	return meta, err
+}
+
+func (b *Breaker) CoinListCacheInfo() []domain.CoinListCacheInfo {
+	cacher, ok := b.provider.(domain.CoinListCacher)
+	if !ok {
+		return nil
+	}
+	return cacher.CoinListCacheInfo()
+}
+
+func (b *Breaker) ThrottleStats() []domain.ThrottleStats {
+	throttler, ok := b.provider.(domain.Throttler)
+	if !ok {
+		return nil
+	}
+	return throttler.ThrottleStats()
+}
+
+func (b *Breaker) ProviderHealth() []domain.ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	health := domain.ProviderHealth{
+		Provider: b.name,
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.lastErr != nil {
+		health.LastError = b.lastErr.Error()
+		lastFail := b.lastFail
+		health.LastFailure = &lastFail
+	}
+	if b.state != domain.CircuitClosed {
+		openedAt, retryAt := b.openedAt, b.retryAt
+		health.OpenedAt = &openedAt
+		health.RetryAt = &retryAt
+	}
+	return []domain.ProviderHealth{health}
+}
+
+// решает, пропустить ли запрос к провайдеру
+func (b *Breaker) allow() error {
+	const op = "gates.providers.breaker.allow"
+
+	if b.cfg.FailureThreshold <= 0 { //предохранитель выключен
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == domain.CircuitOpen && b.now().After(b.retryAt) {
+		b.state = domain.CircuitHalfOpen
+		b.trials = 0
+		b.log.Info(op, "circuit half-open, trying provider", b.name)
+	}
+	if b.state == domain.CircuitOpen || (b.state == domain.CircuitHalfOpen && b.trials >= max(b.cfg.HalfOpenCalls, 1)) {
+		return fmt.Errorf("%s: %w", b.name, domain.ErrCircuitOpen)
+	}
+	if b.state == domain.CircuitHalfOpen {
+		b.trials++
+	}
+	return nil
+}
+
+// учитывает результат запроса. Отмена со стороны вызывающего, неоднозначные монеты и то, что провайдер
+// не умеет в принципе (errors.ErrUnsupported), ошибкой провайдера не считаются,
+// а частичный ответ считается удачным: провайдер жив и цены отдаёт
+func (b *Breaker) done(ctx context.Context, err error) {
+	const op = "gates.providers.breaker.done"
+
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+	var ambiguous *domain.AmbiguousCoinsError
+	if ctx.Err() != nil || errors.As(err, &ambiguous) || errors.Is(err, errors.ErrUnsupported) {
+		b.releaseTrial()
+		return
+	}
+	var partial *domain.PartialPricesError
+	if errors.As(err, &partial) {
+		err = nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if b.state != domain.CircuitClosed {
+			b.log.Info(op, "circuit closed, provider recovered", b.name)
+		}
+		b.state = domain.CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	b.lastFail = b.now()
+	if b.state == domain.CircuitHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		if b.state != domain.CircuitOpen {
+			b.openedAt = b.lastFail
+			b.log.Warn(op, "circuit opened", b.name, "failures", b.failures, "retry in", b.cfg.OpenTimeout, "error", err)
+		}
+		b.state = domain.CircuitOpen
+		b.retryAt = b.lastFail.Add(b.cfg.OpenTimeout)
+	}
+}
+
+// пробный запрос ничего не сказал о провайдере, его место отдаётся следующему запросу,
+// иначе предохранитель навсегда останется полуоткрытым
+func (b *Breaker) releaseTrial() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == domain.CircuitHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
@@ -0,0 +1,249 @@
+package breaker
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("provider is down")
+
+// провайдер, который отвечает ошибкой err и считает вызовы
+type stubProvider struct {
+	err   error
+	calls int
+}
+
+func (p *stubProvider) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	p.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, p.err
+}
+
+func (p *stubProvider) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	p.calls++
+	return nil, p.err
+}
+
+// часы, которые двигаются только руками
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(provider domain.Provider, cfg config.Breaker) (*Breaker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := New("stub", provider, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	b.now = clock.Now
+	return b, clock
+}
+
+func call(b *Breaker) error {
+	_, err := b.CoinsPrice(context.Background(), nil)
+	return err
+}
+
+func state(b *Breaker) string {
+	return b.ProviderHealth()[0].State
+}
+
+var testConfig = config.Breaker{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenCalls: 1}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	provider := &stubProvider{err: errDown}
+	b, _ := newTestBreaker(provider, testConfig)
+
+	for i := range testConfig.FailureThreshold {
+		if err := call(b); !errors.Is(err, errDown) {
+			t.Fatalf("call %d: expected the provider error, got %v", i, err)
+		}
+	}
+	if state(b) != domain.CircuitOpen {
+		t.Fatalf("state = %s after %d failures, want open", state(b), testConfig.FailureThreshold)
+	}
+	if err := call(b); !errors.Is(err, domain.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if provider.calls != testConfig.FailureThreshold {
+		t.Errorf("open circuit still called the provider: %d calls", provider.calls)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	provider := &stubProvider{err: errDown}
+	b, _ := newTestBreaker(provider, testConfig)
+
+	call(b)
+	call(b)
+	provider.err = nil
+	call(b)
+	provider.err = errDown
+	call(b)
+	call(b)
+	if state(b) != domain.CircuitClosed {
+		t.Errorf("state = %s, failures are not consecutive", state(b))
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		trial error
+		want  string
+	}{
+		{name: "successful trial closes", trial: nil, want: domain.CircuitClosed},
+		{name: "failed trial opens again", trial: errDown, want: domain.CircuitOpen},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &stubProvider{err: errDown}
+			b, clock := newTestBreaker(provider, testConfig)
+			for range testConfig.FailureThreshold {
+				call(b)
+			}
+
+			clock.advance(testConfig.OpenTimeout - time.Second)
+			if err := call(b); !errors.Is(err, domain.ErrCircuitOpen) {
+				t.Fatalf("before open_timeout expected ErrCircuitOpen, got %v", err)
+			}
+
+			clock.advance(2 * time.Second)
+			provider.err = tc.trial
+			call(b)
+			if state(b) != tc.want {
+				t.Fatalf("state after trial = %s, want %s", state(b), tc.want)
+			}
+			if tc.want != domain.CircuitOpen {
+				return
+			}
+			//повторное открытие отсчитывает open_timeout заново
+			health := b.ProviderHealth()[0]
+			if want := clock.now.Add(testConfig.OpenTimeout); !health.RetryAt.Equal(want) {
+				t.Errorf("retry at %s, want %s", health.RetryAt, want)
+			}
+			if err := call(b); !errors.Is(err, domain.ErrCircuitOpen) {
+				t.Errorf("expected ErrCircuitOpen right after a failed trial, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenCallsLimit(t *testing.T) {
+	cfg := testConfig
+	cfg.HalfOpenCalls = 2
+	b, clock := newTestBreaker(&stubProvider{err: errDown}, cfg)
+	for range cfg.FailureThreshold {
+		call(b)
+	}
+	clock.advance(cfg.OpenTimeout + time.Second)
+
+	//пробные запросы ещё не ответили, поэтому allow без done
+	for i := range cfg.HalfOpenCalls {
+		if err := b.allow(); err != nil {
+			t.Fatalf("trial %d rejected: %v", i, err)
+		}
+	}
+	if state(b) != domain.CircuitHalfOpen {
+		t.Fatalf("state = %s, want half_open", state(b))
+	}
+	if err := b.allow(); !errors.Is(err, domain.ErrCircuitOpen) {
+		t.Errorf("call over half_open_calls should be rejected, got %v", err)
+	}
+
+	b.done(context.Background(), nil)
+	if err := b.allow(); err != nil {
+		t.Errorf("closed circuit rejected a call: %v", err)
+	}
+}
+
+func TestBreakerIgnoresCallerErrors(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{name: "cancelled by caller", ctx: cancelled, err: nil},
+		{name: "ambiguous coins", ctx: context.Background(), err: &domain.AmbiguousCoinsError{Candidates: map[string][]domain.KnownCoin{"eth": nil}}},
+		{name: "partial prices", ctx: context.Background(), err: &domain.PartialPricesError{Missing: []string{"btc"}, Err: errDown}},
+		{name: "unsupported call", ctx: context.Background(), err: fmt.Errorf("stub can't verify coins: %w", errors.ErrUnsupported)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, _ := newTestBreaker(&stubProvider{err: tc.err}, config.Breaker{FailureThreshold: 1, OpenTimeout: time.Minute})
+			for range 3 {
+				b.CoinsPrice(tc.ctx, nil)
+			}
+			health := b.ProviderHealth()[0]
+			if health.State != domain.CircuitClosed || health.Failures != 0 {
+				t.Errorf("breaker counted it as a provider failure: %+v", health)
+			}
+		})
+	}
+}
+
+// пробный запрос, который не считается ни удачей, ни ошибкой, не должен занимать место пробы навсегда
+func TestBreakerHalfOpenReleasesUncountedTrial(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{name: "cancelled by caller", ctx: cancelled},
+		{name: "unsupported call", ctx: context.Background(), err: fmt.Errorf("stream can't verify coins: %w", errors.ErrUnsupported)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &stubProvider{err: errDown}
+			b, clock := newTestBreaker(provider, testConfig)
+			for range testConfig.FailureThreshold {
+				call(b)
+			}
+			clock.advance(testConfig.OpenTimeout + time.Second)
+
+			provider.err = tc.err
+			b.VerifyCoins(tc.ctx, nil)
+			if state(b) != domain.CircuitHalfOpen {
+				t.Fatalf("state = %s, want half_open after an uncounted trial", state(b))
+			}
+
+			provider.err = nil
+			if err := call(b); err != nil {
+				t.Fatalf("next trial rejected: %v", err)
+			}
+			if state(b) != domain.CircuitClosed {
+				t.Errorf("state = %s, want closed after a successful trial", state(b))
+			}
+		})
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	provider := &stubProvider{err: errDown}
+	b, _ := newTestBreaker(provider, config.Breaker{})
+	for range 10 {
+		if err := call(b); !errors.Is(err, errDown) {
+			t.Fatalf("expected the provider error, got %v", err)
+		}
+	}
+	if provider.calls != 10 {
+		t.Errorf("disabled breaker blocked calls: %d of 10 reached the provider", provider.calls)
+	}
+}
@@ -0,0 +1,130 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ошибка одной пачки id, остальные пачки при этом сохраняются
+type ChunkError struct {
+	Platform string //пусто - пачка монет по id, иначе пачка адресов токенов этой сети
+	Ids      []string
+	Err      error
+}
+
+func (e *ChunkError) Error() string {
+	if e.Platform != "" {
+		return fmt.Sprintf("chunk of %d %s tokens (%s...) failed: %v", len(e.Ids), e.Platform, e.Ids[0], e.Err)
+	}
+	return fmt.Sprintf("chunk of %d coins (%s...) failed: %v", len(e.Ids), e.Ids[0], e.Err)
+}
+
+// пачка для одного запроса цен: монеты по id или токены одной сети по адресам
+type priceJob struct {
+	platform string
+	ids      []string
+}
+
+// ключ цены в склеенном ответе: id монеты или сеть:адрес для токена
+func priceKey(coin domain.WatchedCoin) string {
+	if coin.IsContract() {
+		return domain.ContractKey(coin.Platform, coin.Contract)
+	}
+	return coin.Id
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// делит id на пачки, чтобы не упереться в длину url и лимит id в одном запросе
+func chunkIDs(ids []string, size int) [][]string {
+	if size <= 0 {
+		size = len(ids)
+	}
+	chunks := make([][]string, 0, len(ids)/max(size, 1)+1)
+	for start := 0; start < len(ids); start += size {
+		chunks = append(chunks, ids[start:min(start+size, len(ids))])
+	}
+	return chunks
+}
+
+// запрашивает цены пачками через ограниченное число воркеров и склеивает ответы.
+// Ошибки упавших пачек возвращаются вместе (errors.Join), цены удачных пачек при этом не теряются
+func (c Client) fetchPrices(ctx context.Context, coins []domain.WatchedCoin, currencies string) (prices, error) {
+	const op = "gates.providers.coingecko.fetchPrices"
+
+	byPlatform := make(map[string][]string)
+	for _, coin := range coins {
+		if coin.IsContract() {
+			byPlatform[coin.Platform] = append(byPlatform[coin.Platform], coin.Contract)
+		} else {
+			byPlatform[""] = append(byPlatform[""], coin.Id)
+		}
+	}
+	var chunks []priceJob
+	for platform, ids := range byPlatform {
+		for _, chunk := range chunkIDs(ids, c.cfg.CoinGecko.PriceChunkSize) {
+			chunks = append(chunks, priceJob{platform: platform, ids: chunk})
+		}
+	}
+
+	jobs := make(chan priceJob)
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		result   = make(prices, len(coins))
+		chunkErr []error
+	)
+	for i := 0; i < max(1, min(c.cfg.CoinGecko.PriceWorkers, len(chunks))); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				callCtx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
+				chunkPrices, err := c.priceChunk(callCtx, job, currencies)
+				cancel()
+
+				mu.Lock()
+				if err != nil {
+					chunkErr = append(chunkErr, &ChunkError{Platform: job.platform, Ids: job.ids, Err: err})
+				}
+				for id, values := range chunkPrices {
+					result[id] = values
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, chunk := range chunks {
+		jobs <- chunk
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range chunkErr {
+		c.log.Warn(op, "price chunk failed", err)
+	}
+	if len(chunkErr) > 0 {
+		c.log.Warn(op, "failed chunks", len(chunkErr), "of", len(chunks))
+	}
+	return result, errors.Join(chunkErr...)
+}
+
+// монеты берутся из /simple/price, токены - из /simple/token_price/{сеть}, который отвечает по адресам
+func (c Client) priceChunk(ctx context.Context, job priceJob, currencies string) (prices, error) {
+	if job.platform == "" {
+		return c.prices.simplePrice(ctx, strings.Join(job.ids, ","), currencies)
+	}
+
+	tokens, err := c.prices.tokenPrice(ctx, job.platform, strings.Join(job.ids, ","), currencies)
+	byKey := make(prices, len(tokens))
+	for address, values := range tokens {
+		byKey[domain.ContractKey(job.platform, address)] = values
+	}
+	return byKey, err
+}
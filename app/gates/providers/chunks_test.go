@@ -0,0 +1,67 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/fakegecko"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakegecko, у которого падает любая пачка цен с монетой failID
+func failingChunkServer(failID string) http.Handler {
+	gecko := fakegecko.NewServer(fakegecko.ModeDeterministic, 1)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/simple/price" && strings.Contains(r.URL.Query().Get("ids"), failID) {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		gecko.ServeHTTP(w, r)
+	})
+}
+
+func TestCoinsPriceKeepsSucceededChunks(t *testing.T) {
+	client := newTestClient(t, failingChunkServer("dogecoin"))
+	client.cfg.CoinGecko.PriceChunkSize = 1
+	client.cfg.CoinGecko.PriceWorkers = 2
+
+	coins, err := client.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{
+		"btc":  {Id: "bitcoin"},
+		"eth":  {Id: "ethereum"},
+		"doge": {Id: "dogecoin"},
+	})
+	var partial *domain.PartialPricesError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected PartialPricesError, got %v", err)
+	}
+	if len(partial.Missing) != 1 || partial.Missing[0] != "doge" {
+		t.Errorf("missing = %v, want [doge]", partial.Missing)
+	}
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Errorf("expected the failed chunk in the error chain, got %v", err)
+	}
+
+	got := make(map[string]bool, len(coins))
+	for _, coin := range coins {
+		got[coin.Name] = true
+	}
+	if len(coins) != 2 || !got["btc"] || !got["eth"] {
+		t.Errorf("got prices for %v, want btc and eth", got)
+	}
+}
+
+func TestCoinsPriceFailsWhenEveryChunkFails(t *testing.T) {
+	client := newTestClient(t, failingChunkServer("bitcoin"))
+
+	coins, err := client.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}})
+	if err == nil {
+		t.Fatalf("expected an error, got %v", coins)
+	}
+	var partial *domain.PartialPricesError
+	if errors.As(err, &partial) {
+		t.Errorf("nothing was fetched, the error must not be partial: %v", err)
+	}
+}
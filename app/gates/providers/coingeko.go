@@ -6,60 +6,235 @@ import (
 	"cryptoRestTest/internal/config"
 	"fmt"
 	"github.com/JulianToledano/goingecko/v3/api" //ООоочень простой в использовании package специально под coingecko
-	"github.com/shopspring/decimal"
+	"github.com/JulianToledano/goingecko/v3/api/coins"
+	"github.com/JulianToledano/goingecko/v3/api/contract"
+	"github.com/JulianToledano/goingecko/v3/api/exchangeRates"
+	"github.com/JulianToledano/goingecko/v3/api/simple"
+	geckohttp "github.com/JulianToledano/goingecko/v3/http"
 	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
 )
 
 type Client struct {
-	cg  *api.Client
-	cfg *config.Config
-	log *slog.Logger
-	ctx context.Context
+	cg     *api.Client
+	prices *priceAPI //цены читаются своим клиентом, чтобы не терять точность в float64
+	cfg    *config.Config
+	log    *slog.Logger
+	store  CoinListStore
+	cache  *coinListCache
+	stats  *throttleStats
 }
 
-func NewClient(ctx context.Context, cfg *config.Config, log *slog.Logger) *Client {
+func NewClient(cfg *config.Config, log *slog.Logger, store CoinListStore) *Client {
+	const op = "gates.providers.coingecko.NewClient"
+	log.Info(op, "coingecko plan", cfg.CoinGecko.Plan, "api key set", cfg.CoinGecko.APIKey != "", "calls per minute", cfg.CoinGecko.CallsPerMinute)
+
+	stats := &throttleStats{}
+	transport := &limitedTransport{
+		base:       http.DefaultTransport,
+		limiter:    newTokenBucket(cfg.CoinGecko.CallsPerMinute, cfg.CoinGecko.Burst),
+		maxRetries: cfg.CoinGecko.MaxRetries,
+		backoff:    cfg.CoinGecko.Backoff,
+		timeout:    cfg.CoinsWatcher.Timeout,
+		stats:      stats,
+		log:        log,
+	}
+	httpClient := &http.Client{Transport: transport}
 	return &Client{
-		cfg: cfg,
-		log: log,
-		cg:  api.NewDefaultClient(),
-		ctx: ctx,
+		cfg:    cfg,
+		log:    log,
+		cg:     newAPIClient(cfg.CoinGecko, httpClient),
+		prices: newPriceAPI(cfg.CoinGecko, httpClient),
+		store:  store,
+		cache:  &coinListCache{},
+		stats:  stats,
+	}
+}
+
+// адрес api: из конфига или по тарифу, pro ходит на свой адрес
+func apiBaseURL(cfg config.CoinGecko) string {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = api.BaseURL
+		if cfg.Plan == config.PlanPro {
+			baseURL = api.ProBaseURL
+		}
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// api.NewDefaultClient не даёт задать ни адрес, ни http клиент, поэтому клиент собирается вручную.
+// Pro ходит на свой адрес, demo - на публичный, но оба передают ключ в заголовке своего тарифа
+func newAPIClient(cfg config.CoinGecko, httpClient *http.Client) *api.Client {
+	baseURL := apiBaseURL(cfg)
+
+	hc := geckohttp.NewClient(geckohttp.WithHttpClient(httpClient))
+	if header, ok := apiKeyHeaders[cfg.Plan]; ok && cfg.APIKey != "" {
+		key := string(cfg.APIKey)
+		hc = geckohttp.NewClient(geckohttp.WithHttpClient(httpClient), geckohttp.WithApiHeaderFn(func(r *http.Request) {
+			r.Header.Set(header, key)
+		}))
+	}
+	return &api.Client{
+		SimpleClient:        simple.NewClient(hc, baseURL),
+		CoinsClient:         coins.NewClient(hc, baseURL),
+		ContractClient:      contract.NewClient(hc, baseURL),
+		ExchangeRatesClient: exchangeRates.NewClient(hc, baseURL),
 	}
 }
 
-// функция проверяет монету на наличие (существование) на coingecko
-func (c Client) VerifyCoins(coins []string) map[string]string {
+// функция проверяет монету на наличие (существование) на coingecko.
+// Если у символа несколько монет, выбирается монета с наибольшей капитализацией,
+// а если выбрать не получилось - возвращается domain.AmbiguousCoinsError со списком кандидатов.
+// Токены по адресу контракта ищутся через /coins/{сеть}/contract/{адрес}
+func (c Client) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
 	const op = "gates.providers.coingecko.VerifyCoins"
 
-	ctx, cancel := context.WithTimeout(c.ctx, c.cfg.CoinsWatcher.Timeout)
+	c.log.Info(op, "Verifying coins:", coins)
+	var index *coinIndex
+	if slices.ContainsFunc(coins, func(ref domain.CoinRef) bool { return !ref.IsContract() }) { //токенам по контракту список не нужен
+		var err error
+		index, err = c.coinList(ctx)
+		if err != nil {
+			c.log.Error(op, "Coin list is unavailable", err)
+			return nil, err
+		}
+	}
+
+	verifiedCoins := make(map[string]domain.WatchedCoin)
+	toResolve := make(map[string][]domain.KnownCoin)
+	for _, ref := range coins {
+		if ref.IsContract() {
+			token, err := c.verifyContract(ctx, ref)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				c.log.Warn(op, "Token not found by contract:", ref, "error", err)
+				continue
+			}
+			name := ref.Symbol
+			if name == "" {
+				name = domain.ContractKey(ref.Platform, ref.Contract)
+			}
+			verifiedCoins[name] = token
+			c.log.Debug(op, "Token verified by contract:", name, "id", token.Id)
+			continue
+		}
+		if ref.Id != "" { //id передан явно, проверяем только что он существует и совпадает с символом
+			coin, exists := index.byID[ref.Id]
+			if !exists || (ref.Symbol != "" && ref.Symbol != coin.Symbol) {
+				c.log.Warn(op, "Coin id not found in CoinGecko list or symbol mismatch:", ref)
+				continue
+			}
+			verifiedCoins[coin.Symbol] = domain.WatchedCoin{Id: coin.Id}
+			c.log.Debug(op, "Coin verified by id:", ref.Id)
+			continue
+		}
+
+		candidates := index.bySymbol[ref.Symbol]
+		switch len(candidates) {
+		case 0:
+			c.log.Warn(op, "Coin not found in CoinGecko list:", ref.Symbol)
+		case 1:
+			verifiedCoins[ref.Symbol] = domain.WatchedCoin{Id: candidates[0].Id}
+			c.log.Debug(op, "Coin verified:", ref.Symbol)
+		default:
+			toResolve[ref.Symbol] = candidates
+		}
+	}
+
+	ambiguous := make(map[string][]domain.KnownCoin)
+	if len(toResolve) > 0 {
+		resolved := c.resolveByMarketCap(ctx, toResolve)
+		if ctx.Err() != nil { //без капитализаций все символы оказались бы неоднозначными
+			c.log.Warn(op, "Verification cancelled", ctx.Err())
+			return nil, ctx.Err()
+		}
+		for symbol, candidates := range toResolve {
+			if id, ok := resolved[symbol]; ok {
+				verifiedCoins[symbol] = domain.WatchedCoin{Id: id}
+				c.log.Debug(op, "Ambiguous coin resolved by market cap:", symbol, "id", id)
+				continue
+			}
+			ambiguous[symbol] = candidates
+		}
+	}
+
+	c.log.Info(op, "Verified coins:", verifiedCoins)
+	if len(ambiguous) > 0 {
+		return verifiedCoins, &domain.AmbiguousCoinsError{Candidates: ambiguous}
+	}
+	return verifiedCoins, nil
+}
+
+// ищет токен по сети и адресу контракта, адрес хранится в нижнем регистре, как его отдаёт coingecko
+func (c Client) verifyContract(ctx context.Context, ref domain.CoinRef) (domain.WatchedCoin, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
 	defer cancel()
 
-	c.log.Info(op, "Fetching coin list to verify:", coins)
-	list, err := c.cg.CoinsList(ctx)
+	platform, address := strings.ToLower(ref.Platform), strings.ToLower(ref.Contract)
+	info, err := c.cg.ContractInfo(ctx, platform, address)
 	if err != nil {
-		c.log.Error(op, "Error fetching coin list from Coingecko", err)
-		return nil
+		return domain.WatchedCoin{}, err
+	}
+	if info == nil || info.ID == "" {
+		return domain.WatchedCoin{}, ErrCoinDontExist
 	}
+	return domain.WatchedCoin{Id: info.ID, Platform: platform, Contract: address}, nil
+}
+
+// выбирает для каждого символа монету с наибольшей капитализацией.
+// Символ остаётся нерешённым, если капитализации нет ни у одной монеты или у лидеров она одинаковая
+func (c Client) resolveByMarketCap(ctx context.Context, candidates map[string][]domain.KnownCoin) map[string]string {
+	const op = "gates.providers.coingecko.resolveByMarketCap"
 
-	// Преобразуем список монет от CoinGecko в map для ускорения поиска
-	coinMap := make(map[string]string, len(list))
-	for _, coin := range list {
-		coinMap[coin.Symbol] = coin.ID // Используем символы (symbol) для сопоставления
+	ids := make([]string, 0, len(candidates))
+	for _, known := range candidates {
+		for _, coin := range known {
+			ids = append(ids, coin.Id)
+		}
 	}
 
-	verifiedCoins := make(map[string]string)
-	for _, coin := range coins {
-		// Преобразуем входной символ в ID
-		if id, exists := coinMap[coin]; exists {
-			verifiedCoins[coin] = id
-			c.log.Debug(op, "Coin verified:", coin)
-		} else {
-			c.log.Warn(op, "Coin not found in CoinGecko list:", coin)
+	marketCaps := make(map[string]float64, len(ids))
+	for start := 0; start < len(ids); start += marketsPageSize {
+		end := min(start+marketsPageSize, len(ids))
+
+		callCtx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
+		markets, err := c.cg.CoinsMarket(callCtx, c.cfg.CoinsWatcher.Currency.Default(), coins.WithIDs(ids[start:end]), coins.WithPerPage(marketsPageSize))
+		cancel()
+		if err != nil {
+			c.log.Warn(op, "Error getting market caps from coingecko", err)
+			if ctx.Err() != nil { //вызывающий ушёл, остальные страницы уже не нужны
+				break
+			}
+			continue
+		}
+		for _, market := range markets {
+			marketCaps[market.ID] = market.MarketCap
 		}
 	}
 
-	c.log.Info(op, "Verified coins:", verifiedCoins)
-	return verifiedCoins
+	resolved := make(map[string]string, len(candidates))
+	for symbol, known := range candidates {
+		var best string
+		var bestCap, secondCap float64
+		for _, coin := range known {
+			marketCap := marketCaps[coin.Id]
+			if marketCap > bestCap {
+				best, bestCap, secondCap = coin.Id, marketCap, bestCap
+			} else if marketCap > secondCap {
+				secondCap = marketCap
+			}
+		}
+		if bestCap > 0 && bestCap > secondCap {
+			resolved[symbol] = best
+		}
+	}
+	return resolved
 }
 
 /* в конечном итоге не пригодилось
@@ -91,45 +266,46 @@ func (c Client) OneCoinPrice(coin string) (decimal.Decimal, error) {
 */
 
 // получает слайс монет - отдаёт мапу монета-цена
-func (c Client) CoinsPrice(coins map[string]string) ([]domain.Coin, error) {
+func (c Client) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
 	const op = "gates.providers.coingecko.CoinsPrice"
 
-	ctx, cancel := context.WithTimeout(c.ctx, c.cfg.CoinsWatcher.Timeout)
-	defer cancel()
-
 	c.log.Info(op, "trying to get prices for coins:", coins)
-	currency := c.cfg.CoinsWatcher.Currency
-
-	// Собираем значения из мапы coins (id) в строку через запятую
-	coinIDs := make([]string, 0, len(coins))
-	for _, id := range coins {
-		coinIDs = append(coinIDs, id)
-	}
-	coinsQuery := strings.Join(coinIDs, ",")
+	currencies := c.cfg.CoinsWatcher.Currency
 
-	// Получаем цены через API CoinGecko
-	priceMap, err := c.cg.SimplePrice(ctx, coinsQuery, currency, false)
-	if err != nil {
+	// Получаем цены через API CoinGecko пачками сразу во всех валютах, упавшие пачки не мешают остальным
+	priceMap, err := c.fetchPrices(ctx, getMapValues(coins), currencies.String())
+	if err != nil && len(priceMap) == 0 {
 		c.log.Error(op, "Error getting prices from coingecko", err)
 		return nil, err
 	}
 
 	// Формируем результат в формате []domain.Coin
 	var result []domain.Coin
-	for name, id := range coins {
-		if cgPrices, exists := priceMap[id]; exists {
+	var missing []string
+	for name, watched := range coins {
+		id := watched.Id
+		cgPrices, exists := priceMap[priceKey(watched)]
+		if !exists {
+			c.log.Warn(op, "ID not found in CoinGecko price map:", priceKey(watched))
+			missing = append(missing, name)
+			continue
+		}
+		for _, currency := range currencies {
 			if price, ok := cgPrices[currency]; ok {
 				coin := domain.Coin{
-					Name:  name,
-					Id:    id,
-					Price: decimal.NewFromFloat(price),
+					Name:        name,
+					Id:          id,
+					Price:       price,
+					Currency:    currency,
+					MarketCap:   optionalDecimal(cgPrices, currency+"_market_cap"),
+					Volume24h:   optionalDecimal(cgPrices, currency+"_24h_vol"),
+					Change24h:   optionalDecimal(cgPrices, currency+"_24h_change"),
+					LastUpdated: lastUpdated(cgPrices),
 				}
 				result = append(result, coin)
 			} else {
-				c.log.Warn(op, "Price not found for id in the specified currency:", id, currency)
+				c.log.Warn(op, "Price not found for id in the specified currency:", id, "currency", currency)
 			}
-		} else {
-			c.log.Warn(op, "ID not found in CoinGecko price map:", id)
 		}
 	}
 
@@ -139,7 +315,13 @@ func (c Client) CoinsPrice(coins map[string]string) ([]domain.Coin, error) {
 		return nil, err
 	}
 
+	if err != nil && len(missing) > 0 { //часть пачек упала: цены удачных отдаём, а про остальные монеты говорим явно
+		sort.Strings(missing)
+		c.log.Warn(op, "got prices for part of the coins", len(coins)-len(missing), "missing", missing)
+		return result, &domain.PartialPricesError{Missing: missing, Err: err}
+	}
+
 	c.log.Debug(op, "retrieved coin prices:", result)
-	c.log.Info(op, "successfully retrieved prices for coins")
+	c.log.Info(op + ": successfully retrieved prices for coins")
 	return result, nil
 }
@@ -0,0 +1,103 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"github.com/JulianToledano/goingecko/v3/api"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.CoinGecko
+		want string
+	}{
+		{name: "public", cfg: config.CoinGecko{Plan: config.PlanPublic}, want: api.BaseURL},
+		{name: "demo uses the public url", cfg: config.CoinGecko{Plan: config.PlanDemo, APIKey: "key"}, want: api.BaseURL},
+		{name: "pro", cfg: config.CoinGecko{Plan: config.PlanPro, APIKey: "key"}, want: api.ProBaseURL},
+		{name: "explicit url beats the plan", cfg: config.CoinGecko{Plan: config.PlanPro, BaseURL: "http://localhost:8081/api/v3/"}, want: "http://localhost:8081/api/v3"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := apiBaseURL(tc.cfg); got != tc.want {
+				t.Errorf("base url = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// ключ должен уходить в заголовке своего тарифа и в goingecko, и в клиенте цен
+func TestAPIKeyHeaderByPlan(t *testing.T) {
+	tests := []struct {
+		plan   string
+		key    config.Secret
+		header string //пусто - ключ не отправляется
+	}{
+		{plan: config.PlanPublic},
+		{plan: config.PlanDemo, key: "demo-key", header: "x-cg-demo-api-key"},
+		{plan: config.PlanPro, key: "pro-key", header: "x-cg-pro-api-key"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.plan, func(t *testing.T) {
+			var mu sync.Mutex
+			seen := make(map[string]http.Header)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/coins/list", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				seen["coins list"] = r.Header.Clone()
+				mu.Unlock()
+				io.WriteString(w, `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin"}]`)
+			})
+			mux.HandleFunc("/simple/price", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				seen["simple price"] = r.Header.Clone()
+				mu.Unlock()
+				io.WriteString(w, `{"bitcoin":{"usd":100}}`)
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+
+			cfg := &config.Config{}
+			cfg.CoinGecko.BaseURL = srv.URL
+			cfg.CoinGecko.Plan = tc.plan
+			cfg.CoinGecko.APIKey = tc.key
+			cfg.CoinGecko.CallsPerMinute = -1
+			cfg.CoinGecko.PriceChunkSize = 100
+			cfg.CoinGecko.PriceWorkers = 1
+			cfg.CoinsWatcher.Timeout = 5 * time.Second
+			cfg.CoinsWatcher.Currency = config.Currencies{"usd"}
+			client := NewClient(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+
+			if err := client.refreshCoinList(context.Background()); err != nil {
+				t.Fatalf("refreshCoinList: %v", err)
+			}
+			if _, err := client.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}}); err != nil {
+				t.Fatalf("CoinsPrice: %v", err)
+			}
+
+			for _, call := range []string{"coins list", "simple price"} {
+				headers, ok := seen[call]
+				if !ok {
+					t.Fatalf("%s was not requested", call)
+				}
+				for _, header := range apiKeyHeaders {
+					want := ""
+					if header == tc.header {
+						want = string(tc.key)
+					}
+					if got := headers.Get(header); got != want {
+						t.Errorf("%s: %s = %q, want %q", call, header, got, want)
+					}
+				}
+			}
+		})
+	}
+}
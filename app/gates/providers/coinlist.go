@@ -0,0 +1,159 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"sync"
+	"time"
+)
+
+// хранилище, куда сохраняется список монет coingecko, чтобы проверка работала даже если coingecko недоступен
+type CoinListStore interface {
+	SaveKnownCoins(ctx context.Context, coins []domain.KnownCoin) error
+	GetKnownCoins(ctx context.Context) ([]domain.KnownCoin, time.Time, error)
+}
+
+// индекс списка монет, после построения не меняется
+type coinIndex struct {
+	bySymbol map[string][]domain.KnownCoin //у одного символа может быть много монет (обёртки, мосты)
+	byID     map[string]domain.KnownCoin
+}
+
+// кэш /coins/list в памяти
+type coinListCache struct {
+	mu        sync.RWMutex
+	index     *coinIndex
+	count     int
+	updatedAt time.Time
+}
+
+func (c *coinListCache) set(coins []domain.KnownCoin, updatedAt time.Time) {
+	index := &coinIndex{
+		bySymbol: make(map[string][]domain.KnownCoin, len(coins)),
+		byID:     make(map[string]domain.KnownCoin, len(coins)),
+	}
+	for _, coin := range coins {
+		index.bySymbol[coin.Symbol] = append(index.bySymbol[coin.Symbol], coin)
+		index.byID[coin.Id] = coin
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index = index
+	c.count = len(coins)
+	c.updatedAt = updatedAt
+}
+
+func (c *coinListCache) get() (*coinIndex, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.index, c.updatedAt
+}
+
+func (c *coinListCache) info() (int, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.count, c.updatedAt
+}
+
+// загружает список монет из coingecko, кладёт в кэш и сохраняет в хранилище
+func (c Client) refreshCoinList(ctx context.Context) error {
+	const op = "gates.providers.coingecko.refreshCoinList"
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
+	defer cancel()
+
+	list, err := c.cg.CoinsList(ctx)
+	if err != nil {
+		c.log.Error(op, "Error fetching coin list from Coingecko", err)
+		return err
+	}
+	coins := make([]domain.KnownCoin, 0, len(list))
+	for _, coin := range list {
+		coins = append(coins, domain.KnownCoin{Id: coin.ID, Symbol: coin.Symbol, Name: coin.Name})
+	}
+	c.cache.set(coins, time.Now().UTC())
+	c.log.Info(op, "coin list refreshed, coins", len(coins))
+
+	if c.store == nil {
+		return nil
+	}
+	err = c.store.SaveKnownCoins(ctx, coins)
+	if err != nil {
+		c.log.Warn(op, "failed to persist coin list", err)
+	}
+	return nil
+}
+
+// поднимает в кэш список монет, сохранённый ранее
+func (c Client) loadPersistedCoinList(ctx context.Context) error {
+	const op = "gates.providers.coingecko.loadPersistedCoinList"
+
+	if c.store == nil {
+		return ErrCoinListUnavailable
+	}
+	coins, updatedAt, err := c.store.GetKnownCoins(ctx)
+	if err != nil {
+		c.log.Error(op, "failed to load persisted coin list", err)
+		return err
+	}
+	if len(coins) == 0 {
+		return ErrCoinListUnavailable
+	}
+	c.cache.set(coins, updatedAt)
+	c.log.Info(op, "loaded persisted coin list, coins", len(coins), "updated_at", updatedAt)
+	return nil
+}
+
+// отдаёт индекс списка монет из кэша, даже устаревший - его обновляет RunCoinListRefresh,
+// а запрос в coingecko прямо здесь делается только если кэш пуст и в хранилище ничего нет
+func (c Client) coinList(ctx context.Context) (*coinIndex, error) {
+	const op = "gates.providers.coingecko.coinList"
+
+	index, updatedAt := c.cache.get()
+	if index != nil {
+		if time.Since(updatedAt) >= c.cfg.CoinGecko.CoinsListTTL {
+			c.log.Debug(op, "using stale coin list from", updatedAt)
+		}
+		return index, nil
+	}
+
+	if c.loadPersistedCoinList(ctx) == nil {
+		index, _ = c.cache.get()
+		return index, nil
+	}
+	err := c.refreshCoinList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index, _ = c.cache.get()
+	return index, nil
+}
+
+// RunCoinListRefresh держит кэш списка монет свежим, пока не отменён ctx
+func (c Client) RunCoinListRefresh(ctx context.Context) {
+	const op = "gates.providers.coingecko.RunCoinListRefresh"
+
+	_ = c.loadPersistedCoinList(ctx)
+	if _, updatedAt := c.cache.get(); time.Since(updatedAt) >= c.cfg.CoinGecko.CoinsListTTL {
+		_ = c.refreshCoinList(ctx)
+	}
+
+	ticker := time.NewTicker(c.cfg.CoinGecko.CoinsListTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.log.Info(op + ": stopped")
+			return
+		case <-ticker.C:
+			_ = c.refreshCoinList(ctx)
+		}
+	}
+}
+
+// CoinListCacheInfo отдаёт размер и возраст кэша списка монет
+func (c Client) CoinListCacheInfo() []domain.CoinListCacheInfo {
+	count, updatedAt := c.cache.info()
+	return []domain.CoinListCacheInfo{{Coins: count, UpdatedAt: updatedAt}}
+}
@@ -0,0 +1,58 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// /coins/list, который считает обращения
+func countingCoinsList(calls *atomic.Int32) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/coins/list", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.WriteString(w, `[{"id":"bitcoin","symbol":"btc","name":"Bitcoin"}]`)
+	})
+	return mux
+}
+
+func TestCoinListServesStaleCache(t *testing.T) {
+	var calls atomic.Int32
+	client := newTestClient(t, countingCoinsList(&calls))
+	client.cfg.CoinGecko.CoinsListTTL = time.Hour
+	client.cache.set([]domain.KnownCoin{{Id: "ethereum", Symbol: "eth"}}, time.Now().Add(-2*time.Hour))
+
+	index, err := client.coinList(context.Background())
+	if err != nil {
+		t.Fatalf("coinList: %v", err)
+	}
+	if _, ok := index.byID["ethereum"]; !ok {
+		t.Errorf("stale cache was not served: %v", index.byID)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("coinList fetched /coins/list %d times, refreshing is RunCoinListRefresh's job", calls.Load())
+	}
+}
+
+func TestCoinListFetchesWhenEmpty(t *testing.T) {
+	var calls atomic.Int32
+	client := newTestClient(t, countingCoinsList(&calls))
+	client.cfg.CoinGecko.CoinsListTTL = time.Hour
+
+	for range 2 {
+		index, err := client.coinList(context.Background())
+		if err != nil {
+			t.Fatalf("coinList: %v", err)
+		}
+		if _, ok := index.byID["bitcoin"]; !ok {
+			t.Errorf("coin list = %v, want bitcoin", index.byID)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("/coins/list fetched %d times, want once for the empty cache", calls.Load())
+	}
+}
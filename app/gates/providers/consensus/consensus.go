@@ -0,0 +1,178 @@
+package consensus
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/gates/providers/registry"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"github.com/shopspring/decimal"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const providerName = "consensus"
+
+// Aggregator опрашивает всех провайдеров параллельно и сохраняет согласованную цену.
+// Котировки, которые отклоняются от медианы больше чем на MaxDeviation процентов, отбрасываются.
+type Aggregator struct {
+	entries  []registry.Entry
+	verifier *registry.Registry
+	cfg      config.Consensus
+	log      *slog.Logger
+}
+
+func NewAggregator(log *slog.Logger, cfg config.Consensus, entries ...registry.Entry) *Aggregator {
+	return &Aggregator{
+		entries:  entries,
+		verifier: registry.NewRegistry(log, nil, entries...), //цены registry здесь не собирает
+		cfg:      cfg,
+		log:      log,
+	}
+}
+
+// монеты проверяются так же, как в registry: по провайдерам в порядке приоритета
+func (a *Aggregator) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	return a.verifier.VerifyCoins(ctx, coins)
+}
+
+func (a *Aggregator) CoinListCacheInfo() []domain.CoinListCacheInfo {
+	return a.verifier.CoinListCacheInfo()
+}
+
+func (a *Aggregator) ProviderHealth() []domain.ProviderHealth {
+	return a.verifier.ProviderHealth()
+}
+
+func (a *Aggregator) ThrottleStats() []domain.ThrottleStats {
+	return a.verifier.ThrottleStats()
+}
+
+// история не агрегируется, берётся у провайдеров по порядку
+func (a *Aggregator) CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]domain.PriceSample, error) {
+	return a.verifier.CoinHistory(ctx, id, currency, from, to)
+}
+
+func (a *Aggregator) CoinMetadata(ctx context.Context, id string) (domain.CoinMetadata, error) {
+	return a.verifier.CoinMetadata(ctx, id)
+}
+
+// курсы валют тоже не агрегируются
+func (a *Aggregator) FXRates(ctx context.Context, base string, quotes []string) ([]domain.FXRate, error) {
+	return a.verifier.FXRates(ctx, base, quotes)
+}
+
+func (a *Aggregator) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	const op = "gates.providers.consensus.CoinsPrice"
+
+	quotes, updated := a.collectQuotes(ctx, coins)
+	if ctx.Err() != nil { //часть провайдеров могла не успеть ответить, такой консенсус не считаем
+		a.log.Warn(op, "request cancelled", ctx.Err())
+		return nil, ctx.Err()
+	}
+
+	result := make([]domain.Coin, 0, len(quotes))
+	for key, coinQuotes := range quotes {
+		watched, ok := coins[key.name]
+		if !ok {
+			continue
+		}
+		price, used := a.aggregate(coinQuotes)
+		if used == 0 || used < a.cfg.MinQuotes { //без котировок цены нет даже при min_quotes: 0
+			a.log.Warn(op, "not enough agreeing quotes for coin", key.name, "currency", key.currency, "quotes", coinQuotes)
+			continue
+		}
+		result = append(result, domain.Coin{
+			Name:        key.name,
+			Id:          watched.Id,
+			Price:       price,
+			Currency:    key.currency,
+			Provider:    providerName,
+			Quotes:      coinQuotes,
+			LastUpdated: updated[key],
+		})
+	}
+
+	if len(result) == 0 {
+		a.log.Error(op, "error", ErrNoQuotes)
+		return nil, ErrNoQuotes
+	}
+	a.log.Debug(op, "consensus prices", result)
+	return result, nil
+}
+
+// параллельно спрашивает у всех провайдеров цены, результат (монета, валюта) -> провайдер -> цена
+// и самое свежее время обновления котировки у провайдеров
+func (a *Aggregator) collectQuotes(ctx context.Context, coins map[string]domain.WatchedCoin) (map[quoteKey]map[string]decimal.Decimal, map[quoteKey]time.Time) {
+	const op = "gates.providers.consensus.collectQuotes"
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		quotes  = make(map[quoteKey]map[string]decimal.Decimal, len(coins))
+		updated = make(map[quoteKey]time.Time, len(coins))
+	)
+	for _, entry := range a.entries {
+		wg.Add(1)
+		go func(entry registry.Entry) {
+			defer wg.Done()
+			prices, err := entry.Provider.CoinsPrice(ctx, coins)
+			var partial *domain.PartialPricesError
+			if errors.As(err, &partial) { //котировки по остальным монетам провайдера в консенсус идут
+				a.log.Warn(op, "provider returned part of the prices", entry.Name, "error", err)
+			} else if err != nil {
+				a.log.Warn(op, "provider failed", entry.Name, "error", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, coin := range prices {
+				key := quoteKey{name: coin.Name, currency: coin.Currency}
+				if quotes[key] == nil {
+					quotes[key] = make(map[string]decimal.Decimal, len(a.entries))
+				}
+				quotes[key][entry.Name] = coin.Price
+				if coin.LastUpdated.After(updated[key]) {
+					updated[key] = coin.LastUpdated
+				}
+			}
+		}(entry)
+	}
+	wg.Wait()
+	return quotes, updated
+}
+
+// считает согласованную цену, возвращает её и количество котировок, вошедших в расчёт
+func (a *Aggregator) aggregate(quotes map[string]decimal.Decimal) (decimal.Decimal, int) {
+	const op = "gates.providers.consensus.aggregate"
+
+	all := make([]decimal.Decimal, 0, len(quotes))
+	for _, price := range quotes {
+		all = append(all, price)
+	}
+	sortDecimals(all)
+	reference := median(all)
+
+	kept := all
+	if a.cfg.MaxDeviation > 0 {
+		maxDeviation := decimal.NewFromFloat(a.cfg.MaxDeviation)
+		kept = make([]decimal.Decimal, 0, len(all))
+		for provider, price := range quotes {
+			if deviationPercent(price, reference).GreaterThan(maxDeviation) {
+				a.log.Warn(op, "discarding quote", provider, "price", price, "median", reference)
+				continue
+			}
+			kept = append(kept, price)
+		}
+		sortDecimals(kept)
+	}
+	if len(kept) == 0 {
+		return decimal.Zero, 0
+	}
+
+	if a.cfg.Method == MethodTrimmedMean {
+		return trimmedMean(kept, a.cfg.TrimPercent), len(kept)
+	}
+	return median(kept), len(kept)
+}
@@ -0,0 +1,196 @@
+package consensus
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/gates/providers/registry"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"github.com/shopspring/decimal"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func decimals(values ...string) []decimal.Decimal {
+	result := make([]decimal.Decimal, 0, len(values))
+	for _, v := range values {
+		result = append(result, decimal.RequireFromString(v))
+	}
+	return result
+}
+
+func TestMedian(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		sorted []string
+		want   string
+	}{
+		{name: "single", sorted: []string{"100"}, want: "100"},
+		{name: "odd", sorted: []string{"1", "2", "10"}, want: "2"},
+		{name: "even", sorted: []string{"1", "2", "4", "10"}, want: "3"},
+		{name: "even with fraction", sorted: []string{"100", "101"}, want: "100.5"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := median(decimals(tc.sorted...)); !got.Equal(decimal.RequireFromString(tc.want)) {
+				t.Errorf("median = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		sorted []string
+		trim   float64
+		want   string
+	}{
+		{name: "no trim is a plain mean", sorted: []string{"1", "2", "3", "10"}, trim: 0, want: "4"},
+		{name: "odd count without trim", sorted: []string{"1", "2", "6"}, trim: 0, want: "3"},
+		{name: "trim drops one value from each edge", sorted: []string{"1", "2", "3", "4", "100"}, trim: 20, want: "3"},
+		{name: "trim rounds down", sorted: []string{"1", "2", "3", "100"}, trim: 20, want: "26.5"},
+		{name: "even count with trim", sorted: []string{"1", "4", "6", "8", "10", "1000"}, trim: 25, want: "7"},
+		{name: "half trimmed falls back to median, even", sorted: []string{"1", "2", "4", "10"}, trim: 50, want: "3"},
+		{name: "half trimmed falls back to median, odd", sorted: []string{"1", "2", "10"}, trim: 50, want: "2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := trimmedMean(decimals(tc.sorted...), tc.trim)
+			if !got.Equal(decimal.RequireFromString(tc.want)) {
+				t.Errorf("trimmedMean = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cfg    config.Consensus
+		quotes map[string]string
+		price  string
+		used   int
+	}{
+		{
+			name:   "outlier is discarded",
+			cfg:    config.Consensus{Method: MethodMedian, MaxDeviation: 5},
+			quotes: map[string]string{"a": "100", "b": "101", "c": "150"},
+			price:  "100.5",
+			used:   2,
+		},
+		{
+			name:   "trimmed mean of kept quotes",
+			cfg:    config.Consensus{Method: MethodTrimmedMean, MaxDeviation: 5},
+			quotes: map[string]string{"a": "100", "b": "102", "c": "50"},
+			price:  "101",
+			used:   2,
+		},
+		{
+			name:   "no max deviation keeps everything",
+			cfg:    config.Consensus{Method: MethodMedian},
+			quotes: map[string]string{"a": "100", "b": "200", "c": "1000"},
+			price:  "200",
+			used:   3,
+		},
+		{
+			//медиана двух далёких котировок лежит посередине и далеко от обеих
+			name:   "every quote rejected",
+			cfg:    config.Consensus{Method: MethodMedian, MaxDeviation: 5},
+			quotes: map[string]string{"a": "100", "b": "200"},
+			price:  "0",
+			used:   0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAggregator(discardLog, tc.cfg)
+			quotes := make(map[string]decimal.Decimal, len(tc.quotes))
+			for provider, price := range tc.quotes {
+				quotes[provider] = decimal.RequireFromString(price)
+			}
+			price, used := a.aggregate(quotes)
+			if used != tc.used || !price.Equal(decimal.RequireFromString(tc.price)) {
+				t.Errorf("aggregate = %s from %d quotes, want %s from %d", price, used, tc.price, tc.used)
+			}
+		})
+	}
+}
+
+// провайдер с фиксированной ценой для всех монет
+type fixedProvider struct {
+	price decimal.Decimal
+	err   error
+}
+
+func (p fixedProvider) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	var result []domain.Coin
+	for name, coin := range coins {
+		result = append(result, domain.Coin{Name: name, Id: coin.Id, Price: p.price, Currency: "usd"})
+	}
+	return result, nil
+}
+
+func (p fixedProvider) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	return nil, nil
+}
+
+func entries(providers ...domain.Provider) []registry.Entry {
+	result := make([]registry.Entry, 0, len(providers))
+	for i, provider := range providers {
+		result = append(result, registry.Entry{Name: string(rune('a' + i)), Provider: provider})
+	}
+	return result
+}
+
+func TestCoinsPrice(t *testing.T) {
+	down := fixedProvider{err: errors.New("provider is down")}
+	for _, tc := range []struct {
+		name      string
+		cfg       config.Consensus
+		providers []domain.Provider
+		price     string //пусто - цены быть не должно
+	}{
+		{
+			name:      "enough quotes",
+			cfg:       config.Consensus{Method: MethodMedian, MaxDeviation: 5, MinQuotes: 2},
+			providers: []domain.Provider{fixedProvider{price: decimal.NewFromInt(100)}, fixedProvider{price: decimal.NewFromInt(102)}, down},
+			price:     "101",
+		},
+		{
+			name:      "fewer quotes than min_quotes",
+			cfg:       config.Consensus{Method: MethodMedian, MaxDeviation: 5, MinQuotes: 2},
+			providers: []domain.Provider{fixedProvider{price: decimal.NewFromInt(100)}, down},
+		},
+		{
+			name:      "quotes left after max_deviation are fewer than min_quotes",
+			cfg:       config.Consensus{Method: MethodMedian, MaxDeviation: 5, MinQuotes: 2},
+			providers: []domain.Provider{fixedProvider{price: decimal.NewFromInt(100)}, fixedProvider{price: decimal.NewFromInt(101)}, fixedProvider{price: decimal.NewFromInt(150)}, fixedProvider{price: decimal.NewFromInt(200)}},
+		},
+		{
+			name:      "every quote rejected is not a zero price",
+			cfg:       config.Consensus{Method: MethodMedian, MaxDeviation: 5, MinQuotes: 0},
+			providers: []domain.Provider{fixedProvider{price: decimal.NewFromInt(100)}, fixedProvider{price: decimal.NewFromInt(200)}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAggregator(discardLog, tc.cfg, entries(tc.providers...)...)
+			coins, err := a.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}})
+			if tc.price == "" {
+				if !errors.Is(err, ErrNoQuotes) {
+					t.Errorf("expected ErrNoQuotes, got %v, %v", coins, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CoinsPrice: %v", err)
+			}
+			if len(coins) != 1 || !coins[0].Price.Equal(decimal.RequireFromString(tc.price)) {
+				t.Errorf("got %v, want a single price %s", coins, tc.price)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package consensus
+
+import (
+	"errors"
+	"github.com/shopspring/decimal"
+	"sort"
+)
+
+const (
+	MethodMedian      = "median"
+	MethodTrimmedMean = "trimmed_mean"
+)
+
+var ErrNoQuotes = errors.New("no provider returned quotes for the provided coins")
+
+var hundred = decimal.NewFromInt(100)
+
+// котировки сравниваются только внутри одной валюты
+type quoteKey struct {
+	name     string
+	currency string
+}
+
+// медиана по уже отсортированному слайсу
+func median(sorted []decimal.Decimal) decimal.Decimal {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return sorted[n/2-1].Add(sorted[n/2]).Div(decimal.NewFromInt(2))
+}
+
+// среднее после отбрасывания trimPercent процентов значений с каждого края
+func trimmedMean(sorted []decimal.Decimal, trimPercent float64) decimal.Decimal {
+	trim := int(float64(len(sorted)) * trimPercent / 100)
+	if 2*trim >= len(sorted) {
+		return median(sorted)
+	}
+	kept := sorted[trim : len(sorted)-trim]
+	sum := decimal.Zero
+	for _, v := range kept {
+		sum = sum.Add(v)
+	}
+	return sum.Div(decimal.NewFromInt(int64(len(kept))))
+}
+
+func sortDecimals(values []decimal.Decimal) {
+	sort.Slice(values, func(i, j int) bool { return values[i].LessThan(values[j]) })
+}
+
+// отклонение в процентах от опорного значения
+func deviationPercent(value, reference decimal.Decimal) decimal.Decimal {
+	if reference.IsZero() {
+		return decimal.Zero
+	}
+	return value.Sub(reference).Abs().Div(reference.Abs()).Mul(hundred)
+}
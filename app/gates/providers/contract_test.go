@@ -0,0 +1,110 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/fakegecko"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// адреса контрактов из fakegecko, как их пишут в обозревателях блоков (с контрольной суммой)
+const (
+	usdcChecksummed   = "0xA0b86991c6218b36c1D19D4a2e9Eb0cE3606eB48"
+	tetherChecksummed = "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+)
+
+func TestVerifyCoinsByContract(t *testing.T) {
+	client := newTestClient(t, fakegecko.NewServer(fakegecko.ModeDeterministic, 1))
+
+	verified, err := client.VerifyCoins(context.Background(), []domain.CoinRef{
+		{Symbol: "usdc", Platform: "Ethereum", Contract: usdcChecksummed},
+		{Platform: "ethereum", Contract: tetherChecksummed},                                            //без символа монета называется по сети и адресу
+		{Symbol: "fake", Platform: "ethereum", Contract: "0x0000000000000000000000000000000000000001"}, //такого токена нет
+	})
+	if err != nil {
+		t.Fatalf("VerifyCoins: %v", err)
+	}
+
+	want := map[string]domain.WatchedCoin{
+		"usdc": {Id: "usd-coin", Platform: "ethereum", Contract: strings.ToLower(usdcChecksummed)},
+		domain.ContractKey("ethereum", tetherChecksummed): {Id: "tether", Platform: "ethereum", Contract: strings.ToLower(tetherChecksummed)},
+	}
+	if len(verified) != len(want) {
+		t.Fatalf("verified %v, want %v", verified, want)
+	}
+	for name, coin := range want {
+		if verified[name] != coin {
+			t.Errorf("%s = %+v, want %+v", name, verified[name], coin)
+		}
+	}
+}
+
+// цены токенов приходят по адресам, а не по id, и должны вернуться к монете из списка наблюдения
+func TestCoinsPriceMapsTokenAddresses(t *testing.T) {
+	watched := map[string]domain.WatchedCoin{
+		"btc":       {Id: "bitcoin"},
+		"usdc":      {Id: "usd-coin", Platform: "ethereum", Contract: strings.ToLower(usdcChecksummed)},
+		"usdt":      {Id: "tether", Platform: "ethereum", Contract: tetherChecksummed}, //записан до приведения адресов к нижнему регистру
+		"usdt-tron": {Id: "tether", Platform: "tron", Contract: "tr7nhqjekqxgtci8q8zy4pl8otszgjlj6t"},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+	}{
+		{name: "lower case response keys", handler: fakegecko.NewServer(fakegecko.ModeDeterministic, 1)},
+		{name: "checksummed response keys", handler: checksummedTokenPrices(fakegecko.NewServer(fakegecko.ModeDeterministic, 1))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newTestClient(t, tc.handler)
+
+			coins, err := client.CoinsPrice(context.Background(), watched)
+			if err != nil {
+				t.Fatalf("CoinsPrice: %v", err)
+			}
+			got := make(map[string]domain.Coin, len(coins))
+			for _, coin := range coins {
+				got[coin.Name] = coin
+			}
+			for name, coin := range watched {
+				price, ok := got[name]
+				if !ok {
+					t.Errorf("no price for %s", name)
+					continue
+				}
+				if price.Id != coin.Id || !price.Price.IsPositive() {
+					t.Errorf("%s = %+v, want a price of %s", name, price, coin.Id)
+				}
+			}
+		})
+	}
+}
+
+// отдаёт ответ /simple/token_price с адресами в том регистре, в котором их запросили
+func checksummedTokenPrices(gecko http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/simple/token_price/") {
+			gecko.ServeHTTP(w, r)
+			return
+		}
+		rec := &bodyRecorder{ResponseWriter: w}
+		gecko.ServeHTTP(rec, r)
+		body := rec.body.String()
+		for _, address := range []string{usdcChecksummed, tetherChecksummed} {
+			body = strings.ReplaceAll(body, `"`+strings.ToLower(address)+`"`, `"`+address+`"`)
+		}
+		io.WriteString(w, body)
+	})
+}
+
+type bodyRecorder struct {
+	http.ResponseWriter
+	body strings.Builder
+}
+
+func (r *bodyRecorder) Write(p []byte) (int, error) {
+	return r.body.Write(p)
+}
@@ -0,0 +1,50 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"fmt"
+	"time"
+)
+
+var ErrNoFXRate = fmt.Errorf("No exchange rate for this currency")
+
+// знаков после запятой в курсе base -> quote
+const fxPrecision = 16
+
+// FXRates курсы валют через /exchange_rates. Coingecko отдаёт их относительно btc,
+// поэтому курс base -> quote считается как quote/base
+func (c Client) FXRates(ctx context.Context, base string, quotes []string) ([]domain.FXRate, error) {
+	const op = "gates.providers.coingecko.FXRates"
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
+	defer cancel()
+
+	resp, err := c.prices.exchangeRates(ctx)
+	if err != nil {
+		c.log.Error(op, "Error getting exchange rates from coingecko", err)
+		return nil, err
+	}
+
+	baseRate := resp.Rates[base].Value
+	if baseRate.IsZero() {
+		c.log.Error(op, "no exchange rate for base currency", base)
+		return nil, fmt.Errorf("%s: %w", base, ErrNoFXRate)
+	}
+	now := time.Now().UTC() //у /exchange_rates нет времени обновления
+	result := make([]domain.FXRate, 0, len(quotes))
+	for _, quote := range quotes {
+		quoteRate := resp.Rates[quote].Value
+		if quote == base || quoteRate.IsZero() {
+			c.log.Warn(op, "skipping currency", quote, "error", ErrNoFXRate)
+			continue
+		}
+		result = append(result, domain.FXRate{
+			Base:  base,
+			Quote: quote,
+			Rate:  quoteRate.DivRound(baseRate, fxPrecision),
+			Time:  now,
+		})
+	}
+	return result, nil
+}
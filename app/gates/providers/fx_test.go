@@ -0,0 +1,45 @@
+package coingecko
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestFXRatesDivideInDecimal(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/exchange_rates", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"rates":{
+			"btc":{"name":"Bitcoin","unit":"BTC","value":1,"type":"crypto"},
+			"usd":{"name":"US Dollar","unit":"$","value":97000.5,"type":"fiat"},
+			"jpy":{"name":"Japanese Yen","unit":"¥","value":14676175.65,"type":"fiat"},
+			"eur":{"name":"Euro","unit":"€","value":0.000000000000000001,"type":"fiat"},
+			"xau":{"name":"Gold","unit":"XAU","value":0,"type":"commodity"}
+		}}`)
+	})
+	client := newTestClient(t, mux)
+
+	rates, err := client.FXRates(context.Background(), "usd", []string{"jpy", "eur", "usd", "xau", "gbp"})
+	if err != nil {
+		t.Fatalf("FXRates: %v", err)
+	}
+	want := map[string]string{
+		"jpy": "151.3", //14676175.65 / 97000.5 ровно
+		"eur": "0",     //меньше fxPrecision знаков
+	}
+	if len(rates) != len(want) {
+		t.Fatalf("got %d rates, want %d: %v", len(rates), len(want), rates)
+	}
+	for _, rate := range rates {
+		if rate.Base != "usd" || rate.Rate.String() != want[rate.Quote] {
+			t.Errorf("%s -> %s = %s, want %s", rate.Base, rate.Quote, rate.Rate, want[rate.Quote])
+		}
+	}
+
+	_, err = client.FXRates(context.Background(), "gbp", []string{"usd"})
+	if !errors.Is(err, ErrNoFXRate) {
+		t.Errorf("expected ErrNoFXRate for an unknown base, got %v", err)
+	}
+}
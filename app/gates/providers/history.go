@@ -0,0 +1,61 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// CoinHistory отдаёт историю цен монеты за период через /coins/{id}/market_chart/range.
+// Детализация зависит от длины периода: до 90 дней coingecko отдаёт цены по часам, больше - по дням
+func (c Client) CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]domain.PriceSample, error) {
+	const op = "gates.providers.coingecko.CoinHistory"
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
+	defer cancel()
+
+	c.log.Debug(op, "trying to get history for coin", id, "currency", currency, "from", from, "to", to)
+	chart, err := c.prices.marketChartRange(ctx, id, currency, from, to)
+	if err != nil {
+		c.log.Error(op, "Error getting history from coingecko", err)
+		return nil, err
+	}
+
+	marketCaps := chartValues(chart.MarketCaps)
+	volumes := chartValues(chart.TotalVolumes)
+	samples := make([]domain.PriceSample, 0, len(chart.Prices))
+	for _, point := range chart.Prices {
+		if len(point) < 2 {
+			continue
+		}
+		ms := point[0].IntPart()
+		sample := domain.PriceSample{
+			Currency: currency,
+			Price:    point[1],
+			Time:     time.UnixMilli(ms).UTC(),
+		}
+		if marketCap, ok := marketCaps[ms]; ok {
+			sample.MarketCap = &marketCap
+		}
+		if volume, ok := volumes[ms]; ok {
+			sample.Volume24h = &volume
+		}
+		samples = append(samples, sample)
+	}
+
+	c.log.Debug(op, "retrieved history points", len(samples))
+	return samples, nil
+}
+
+// точки графика [время в мс, значение] в мапу по времени
+func chartValues(points [][]decimal.Decimal) map[int64]decimal.Decimal {
+	values := make(map[int64]decimal.Decimal, len(points))
+	for _, point := range points {
+		if len(point) < 2 {
+			continue
+		}
+		values[point[0].IntPart()] = point[1]
+	}
+	return values
+}
@@ -0,0 +1,48 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"github.com/JulianToledano/goingecko/v3/api/coins"
+	"time"
+)
+
+// CoinMetadata описание монеты через /coins/{id}. Тикеры и рыночные данные не нужны и только утяжеляют ответ
+func (c Client) CoinMetadata(ctx context.Context, id string) (domain.CoinMetadata, error) {
+	const op = "gates.providers.coingecko.CoinMetadata"
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.CoinsWatcher.Timeout)
+	defer cancel()
+
+	coin, err := c.cg.CoinsId(ctx, id,
+		coins.WithLocalization(false),
+		coins.WithTickers(false),
+		coins.WithMarketData(false),
+		coins.WithCommunityData(false),
+		coins.WithDeveloperData(false),
+		coins.WithCoinSparkline(false))
+	if err != nil {
+		c.log.Error(op, "Error getting coin details from coingecko", err)
+		return domain.CoinMetadata{}, err
+	}
+	if coin == nil || coin.ID == "" {
+		return domain.CoinMetadata{}, ErrCoinDontExist
+	}
+
+	meta := domain.CoinMetadata{
+		Id:         coin.ID,
+		Symbol:     coin.Symbol,
+		Name:       coin.Name,
+		ImageURL:   coin.Image.Large,
+		Categories: coin.Categories,
+		UpdatedAt:  time.Now().UTC(),
+	}
+	if genesis, err := time.Parse(time.DateOnly, coin.GenesisData); err == nil { //у многих монет даты нет
+		meta.GenesisDate = &genesis
+	}
+	if coin.MarketCapRank > 0 { //0 - монета без ранга
+		rank := coin.MarketCapRank
+		meta.MarketCapRank = &rank
+	}
+	return meta, nil
+}
@@ -1,14 +1,47 @@
 package coingecko
 
 import (
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
 	"fmt"
+	"github.com/shopspring/decimal"
+	"time"
 )
 
+// максимум монет в одном запросе /coins/markets
+const marketsPageSize = 250
+
+// заголовки, в которых тарифы coingecko ждут ключ
+var apiKeyHeaders = map[string]string{
+	config.PlanDemo: "x-cg-demo-api-key",
+	config.PlanPro:  "x-cg-pro-api-key",
+}
+
 var ErrEmptyPriceCurrency = fmt.Errorf("No price found for this currency")
 var ErrCoinDontExist = fmt.Errorf("Could not find this coin")
+var ErrRateLimited = fmt.Errorf("Rate limit would be exceeded before the deadline")
+var ErrBadResponse = fmt.Errorf("Bad response from coingecko")
+var ErrCoinListUnavailable = fmt.Errorf("Coin list is not available neither from coingecko nor from storage")
+
+// дополнительные поля ответа /simple/price (usd_market_cap и т.д.)
+func optionalDecimal(values priceValues, key string) *decimal.Decimal {
+	value, ok := values[key]
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+func lastUpdated(values priceValues) time.Time {
+	ts, ok := values["last_updated_at"]
+	if !ok || !ts.IsPositive() {
+		return time.Time{}
+	}
+	return time.Unix(ts.IntPart(), 0).UTC()
+}
 
-func getMapValues(m map[string]string) []string {
-	values := make([]string, 0, len(m))
+func getMapValues(m map[string]domain.WatchedCoin) []domain.WatchedCoin {
+	values := make([]domain.WatchedCoin, 0, len(m))
 	for _, v := range m {
 		values = append(values, v)
 	}
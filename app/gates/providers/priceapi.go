@@ -0,0 +1,139 @@
+package coingecko
+
+import (
+	"bytes"
+	"context"
+	"cryptoRestTest/internal/config"
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// priceAPI свой тонкий клиент для ручек с ценами. goingecko разбирает числа в float64,
+// а цены в 1e-9 и большие цены btc теряют на этом знаки ещё до записи в NUMERIC.
+// Здесь числа читаются из текста ответа сразу в decimal.Decimal
+type priceAPI struct {
+	http    *http.Client
+	baseURL string
+	header  string //заголовок с ключом по тарифу
+	key     string
+}
+
+func newPriceAPI(cfg config.CoinGecko, httpClient *http.Client) *priceAPI {
+	header, key := apiKeyHeaders[cfg.Plan], string(cfg.APIKey)
+	if key == "" {
+		header = ""
+	}
+	return &priceAPI{http: httpClient, baseURL: apiBaseURL(cfg), header: header, key: key}
+}
+
+// значения одной монеты из /simple/price: "usd", "usd_market_cap", "usd_24h_vol", "usd_24h_change", "last_updated_at"
+type priceValues map[string]decimal.Decimal
+
+// ответ /simple/price (по id) или /simple/token_price (по адресу)
+type prices map[string]priceValues
+
+// null (у coingecko так бывает с капитализацией и изменением за сутки) пропускается, как будто поля нет
+func (v *priceValues) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*v = make(priceValues, len(raw))
+	for key, value := range raw {
+		if bytes.Equal(value, []byte("null")) {
+			continue
+		}
+		d, err := decimal.NewFromString(string(bytes.Trim(value, `"`)))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		(*v)[key] = d
+	}
+	return nil
+}
+
+// ответ /coins/{id}/market_chart/range, точки [время в мс, значение]
+type chartPoints struct {
+	Prices       [][]decimal.Decimal `json:"prices"`
+	MarketCaps   [][]decimal.Decimal `json:"market_caps"`
+	TotalVolumes [][]decimal.Decimal `json:"total_volumes"`
+}
+
+// ответ /exchange_rates, курсы валют относительно btc
+type fxRates struct {
+	Rates map[string]struct {
+		Value decimal.Decimal `json:"value"`
+	} `json:"rates"`
+}
+
+func (a *priceAPI) simplePrice(ctx context.Context, ids string, currencies string) (prices, error) {
+	params := url.Values{}
+	params.Set("ids", ids)
+	params.Set("vs_currencies", currencies)
+	params.Set("include_market_cap", "true")
+	params.Set("include_24hr_vol", "true")
+	params.Set("include_24hr_change", "true")
+	params.Set("include_last_updated_at", "true")
+
+	var result prices
+	err := a.get(ctx, "/simple/price", params, &result)
+	return result, err
+}
+
+func (a *priceAPI) tokenPrice(ctx context.Context, platform string, addresses string, currencies string) (prices, error) {
+	params := url.Values{}
+	params.Set("contract_addresses", addresses)
+	params.Set("vs_currencies", currencies)
+	params.Set("include_market_cap", "true")
+	params.Set("include_24hr_vol", "true")
+	params.Set("include_24hr_change", "true")
+	params.Set("include_last_updated_at", "true")
+
+	var result prices
+	err := a.get(ctx, "/simple/token_price/"+url.PathEscape(platform), params, &result)
+	return result, err
+}
+
+func (a *priceAPI) marketChartRange(ctx context.Context, id string, currency string, from, to time.Time) (chartPoints, error) {
+	params := url.Values{}
+	params.Set("vs_currency", currency)
+	params.Set("from", strconv.FormatInt(from.Unix(), 10))
+	params.Set("to", strconv.FormatInt(to.Unix(), 10))
+
+	var result chartPoints
+	err := a.get(ctx, "/coins/"+url.PathEscape(id)+"/market_chart/range", params, &result)
+	return result, err
+}
+
+func (a *priceAPI) exchangeRates(ctx context.Context) (fxRates, error) {
+	var result fxRates
+	err := a.get(ctx, "/exchange_rates", url.Values{}, &result)
+	return result, err
+}
+
+// ошибочные статусы и повторы обрабатывает limitedTransport, здесь остаётся только разбор ответа
+func (a *priceAPI) get(ctx context.Context, path string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if a.header != "" {
+		req.Header.Set(a.header, a.key)
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest { //на случай транспорта без limitedTransport
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
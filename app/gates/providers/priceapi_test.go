@@ -0,0 +1,152 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// цены, которые float64 не переживает: микро-токены, длинные хвосты и большие значения
+var extremePrices = []struct {
+	name string
+	json string //как число приходит в ответе
+	want string //как оно должно попасть в NUMERIC
+}{
+	{name: "micro cap", json: "0.000000001", want: "0.000000001"},
+	{name: "exponent", json: "1.234e-9", want: "0.000000001234"},
+	{name: "long tail", json: "0.000000000012345678901234567890", want: "0.00000000001234567890123456789"},
+	{name: "btc with many digits", json: "98765.432109876543210987", want: "98765.432109876543210987"},
+	{name: "beyond float range of exact integers", json: "123456789012345678901234567890.123456789", want: "123456789012345678901234567890.123456789"},
+	{name: "quoted", json: `"0.1"`, want: "0.1"},
+}
+
+func TestPriceValuesDecodeExactly(t *testing.T) {
+	for _, tc := range extremePrices {
+		t.Run(tc.name, func(t *testing.T) {
+			var values priceValues
+			err := json.Unmarshal([]byte(`{"usd":`+tc.json+`,"usd_24h_change":null}`), &values)
+			if err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if got := values["usd"].String(); got != tc.want {
+				t.Errorf("price = %s, want %s", got, tc.want)
+			}
+			if _, ok := values["usd_24h_change"]; ok {
+				t.Errorf("null change should be skipped, got %s", values["usd_24h_change"])
+			}
+
+			//в NUMERIC значение уходит через driver.Valuer, текст должен совпасть с исходным
+			stored, err := values["usd"].Value()
+			if err != nil {
+				t.Fatalf("value: %v", err)
+			}
+			if stored != tc.want {
+				t.Errorf("stored value = %v, want %s", stored, tc.want)
+			}
+		})
+	}
+}
+
+func TestPriceValuesRejectGarbage(t *testing.T) {
+	var values priceValues
+	err := json.Unmarshal([]byte(`{"usd":"abc"}`), &values)
+	if err == nil {
+		t.Fatalf("expected error for non numeric price, got %v", values)
+	}
+}
+
+func TestCoinsPriceKeepsExactPrices(t *testing.T) {
+	for _, tc := range extremePrices {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/simple/price", func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, `{"micro":{"usd":`+tc.json+`,"usd_market_cap":`+tc.json+`,"last_updated_at":1736500490}}`)
+			})
+			mux.HandleFunc("/simple/token_price/ethereum", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("contract_addresses") != "0xabc" {
+					t.Errorf("unexpected contract addresses %q", r.URL.Query().Get("contract_addresses"))
+				}
+				io.WriteString(w, `{"0xabc":{"usd":`+tc.json+`}}`)
+			})
+			client := newTestClient(t, mux)
+
+			coins, err := client.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{
+				"micro": {Id: "micro"},
+				"token": {Id: "token", Platform: "ethereum", Contract: "0xabc"},
+			})
+			if err != nil {
+				t.Fatalf("CoinsPrice: %v", err)
+			}
+			if len(coins) != 2 {
+				t.Fatalf("got %d prices, want 2", len(coins))
+			}
+			for _, coin := range coins {
+				if got := coin.Price.String(); got != tc.want {
+					t.Errorf("%s price = %s, want %s", coin.Name, got, tc.want)
+				}
+			}
+			for _, coin := range coins {
+				if coin.Name != "micro" {
+					continue
+				}
+				if coin.MarketCap == nil || coin.MarketCap.String() != tc.want {
+					t.Errorf("market cap = %v, want %s", coin.MarketCap, tc.want)
+				}
+				if want := time.Unix(1736500490, 0).UTC(); !coin.LastUpdated.Equal(want) {
+					t.Errorf("last updated = %s, want %s", coin.LastUpdated, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCoinHistoryKeepsExactPrices(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/coins/micro/market_chart/range", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"prices":[[1736500490000,0.000000000012345678901234567890],[1736504090000,1.234e-9]],
+			"market_caps":[[1736500490000,123456789012345678901234567890.123456789]],"total_volumes":[]}`)
+	})
+	client := newTestClient(t, mux)
+
+	samples, err := client.CoinHistory(context.Background(), "micro", "usd", time.Unix(1736500000, 0), time.Unix(1736510000, 0))
+	if err != nil {
+		t.Fatalf("CoinHistory: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if got := samples[0].Price.String(); got != "0.00000000001234567890123456789" {
+		t.Errorf("first price = %s", got)
+	}
+	if got := samples[1].Price.String(); got != "0.000000001234" {
+		t.Errorf("second price = %s", got)
+	}
+	if samples[0].MarketCap == nil || samples[0].MarketCap.String() != "123456789012345678901234567890.123456789" {
+		t.Errorf("market cap = %v", samples[0].MarketCap)
+	}
+	if want := time.UnixMilli(1736500490000).UTC(); !samples[0].Time.Equal(want) {
+		t.Errorf("time = %s, want %s", samples[0].Time, want)
+	}
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{}
+	cfg.CoinGecko.BaseURL = srv.URL
+	cfg.CoinGecko.CallsPerMinute = -1
+	cfg.CoinGecko.PriceChunkSize = 100
+	cfg.CoinGecko.PriceWorkers = 1
+	cfg.CoinsWatcher.Timeout = 5 * time.Second
+	cfg.CoinsWatcher.Currency = config.Currencies{"usd"}
+	return NewClient(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+}
@@ -0,0 +1,229 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket ограничивает количество запросов в минуту, допуская небольшие всплески
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 //токенов в секунду
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(callsPerMinute, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:     max(float64(callsPerMinute), 0) / 60,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// wait резервирует токен и ждёт, пока он станет доступен. Возвращает время ожидания
+func (b *tokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	if b.rate <= 0 { //лимит выключен
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens-- //токен резервируется сразу, даже если его придётся подождать
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return 0, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		b.mu.Lock()
+		b.tokens++ //всё равно не дождёмся, возвращаем токен
+		b.mu.Unlock()
+		return 0, ErrRateLimited
+	}
+	return delay, sleep(ctx, delay)
+}
+
+type throttleStats struct {
+	mu    sync.Mutex
+	stats domain.ThrottleStats
+}
+
+func (s *throttleStats) update(fn func(stats *domain.ThrottleStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.stats)
+}
+
+func (s *throttleStats) snapshot() domain.ThrottleStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// ThrottleStats отдаёт статистику ограничения запросов к coingecko
+func (c Client) ThrottleStats() []domain.ThrottleStats {
+	return []domain.ThrottleStats{c.stats.snapshot()}
+}
+
+// limitedTransport соблюдает лимит запросов и повторяет запрос при 429 и 5xx
+// с экспоненциальной задержкой и джиттером (или столько, сколько просит Retry-After),
+// пока укладывается в дедлайн контекста запроса
+type limitedTransport struct {
+	base       http.RoundTripper
+	limiter    *tokenBucket
+	maxRetries int
+	backoff    time.Duration
+	timeout    time.Duration //если у запроса нет дедлайна
+	stats      *throttleStats
+	log        *slog.Logger
+}
+
+// запрос без дедлайна получает t.timeout. Контекст с таймаутом отменяется при закрытии тела ответа,
+// а не при выходе из RoundTrip, иначе тело оборвётся посреди чтения
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if _, ok := ctx.Deadline(); ok || t.timeout <= 0 {
+		return t.roundTrip(ctx, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	resp, err := t.roundTrip(ctx, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose отменяет контекст запроса, когда тело ответа дочитано и закрыто
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (t *limitedTransport) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
+	const op = "gates.providers.coingecko.RoundTrip"
+
+	for attempt := 0; ; attempt++ {
+		waited, err := t.limiter.wait(ctx)
+		t.stats.update(func(stats *domain.ThrottleStats) {
+			stats.Requests++
+			if waited > 0 {
+				stats.Throttled++
+				stats.ThrottleWait += waited
+			}
+		})
+		if err != nil {
+			t.stats.update(func(stats *domain.ThrottleStats) { stats.Failed++ })
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(req.Clone(ctx))
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			return resp, nil
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				t.stats.update(func(stats *domain.ThrottleStats) { stats.Failed++ })
+				return nil, err
+			}
+			delay = t.backoffDelay(attempt)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			t.stats.update(func(stats *domain.ThrottleStats) {
+				stats.RateLimited++
+				stats.LastRetryAfter = retryAfter
+			})
+			delay = max(retryAfter, t.backoffDelay(attempt))
+			err = responseError(resp)
+		case resp.StatusCode >= http.StatusInternalServerError:
+			t.stats.update(func(stats *domain.ThrottleStats) { stats.ServerErrors++ })
+			delay = t.backoffDelay(attempt)
+			err = responseError(resp)
+		default: //остальные 4xx повторять бессмысленно
+			t.stats.update(func(stats *domain.ThrottleStats) { stats.Failed++ })
+			return nil, responseError(resp)
+		}
+
+		deadline, ok := ctx.Deadline()
+		if attempt >= t.maxRetries || (ok && time.Until(deadline) < delay) {
+			t.log.Warn(op, "giving up after attempts", attempt+1, "error", err)
+			t.stats.update(func(stats *domain.ThrottleStats) { stats.Failed++ })
+			return nil, err
+		}
+		t.log.Debug(op, "retrying request in", delay, "error", err)
+		t.stats.update(func(stats *domain.ThrottleStats) { stats.Retries++ })
+		if err := sleep(ctx, delay); err != nil {
+			t.stats.update(func(stats *domain.ThrottleStats) { stats.Failed++ })
+			return nil, err
+		}
+	}
+}
+
+// экспоненциальная задержка с джиттером: половина фиксированная, половина случайная
+func (t *limitedTransport) backoffDelay(attempt int) time.Duration {
+	delay := t.backoff << min(attempt, 10)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Retry-After бывает в секундах или в виде даты
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// goingecko не смотрит на статус ответа, поэтому ошибочные ответы превращаются в ошибку здесь
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%w: status %d: %s", ErrBadResponse, resp.StatusCode, body)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
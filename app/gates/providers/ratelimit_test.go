@@ -0,0 +1,265 @@
+package coingecko
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketDisabled(t *testing.T) {
+	bucket := newTokenBucket(0, 1)
+	for range 100 {
+		waited, err := bucket.wait(context.Background())
+		if err != nil || waited != 0 {
+			t.Fatalf("disabled bucket waited %s, err %v", waited, err)
+		}
+	}
+}
+
+func TestTokenBucketBurstThenWait(t *testing.T) {
+	bucket := newTokenBucket(600, 2) //10 токенов в секунду
+	for i := range 2 {
+		waited, err := bucket.wait(context.Background())
+		if err != nil || waited != 0 {
+			t.Fatalf("call %d inside burst waited %s, err %v", i, waited, err)
+		}
+	}
+	waited, err := bucket.wait(context.Background())
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if waited < 80*time.Millisecond || waited > 100*time.Millisecond {
+		t.Errorf("waited %s after the burst, want about 100ms", waited)
+	}
+}
+
+func TestTokenBucketGivesUpBeforeDeadline(t *testing.T) {
+	bucket := newTokenBucket(60, 1) //токен в секунду
+	if _, err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := bucket.wait(ctx)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	//несостоявшийся запрос не должен съедать токен
+	if bucket.tokens < -0.1 {
+		t.Errorf("token was not returned, tokens = %f", bucket.tokens)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	transport := &limitedTransport{backoff: 100 * time.Millisecond}
+	for _, tc := range []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{attempt: 0, ceiling: 100 * time.Millisecond},
+		{attempt: 1, ceiling: 200 * time.Millisecond},
+		{attempt: 3, ceiling: 800 * time.Millisecond},
+		{attempt: 10, ceiling: 100 * time.Millisecond << 10},
+		{attempt: 50, ceiling: 100 * time.Millisecond << 10}, //рост задержки ограничен
+	} {
+		for range 50 {
+			delay := transport.backoffDelay(tc.attempt)
+			if delay < tc.ceiling/2 || delay > tc.ceiling {
+				t.Fatalf("attempt %d: delay %s outside [%s, %s]", tc.attempt, delay, tc.ceiling/2, tc.ceiling)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "empty", value: "", min: 0, max: 0},
+		{name: "seconds", value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{name: "zero seconds", value: "0", min: 0, max: 0},
+		{name: "http date", value: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), min: 8 * time.Second, max: 10 * time.Second},
+		{name: "date in the past", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), min: 0, max: 0},
+		{name: "garbage", value: "soon", min: 0, max: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseRetryAfter(tc.value)
+			if got < tc.min || got > tc.max {
+				t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tc.value, got, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+// сервер отвечает статусами из statuses по очереди, после них - 200
+func statusSequenceServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1)) - 1
+		if call < len(statuses) {
+			if statuses[call] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			http.Error(w, strconv.Itoa(statuses[call]), statuses[call])
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newTestTransport(maxRetries int, timeout time.Duration) *limitedTransport {
+	return &limitedTransport{
+		base:       http.DefaultTransport,
+		limiter:    newTokenBucket(-1, 1),
+		maxRetries: maxRetries,
+		backoff:    time.Millisecond,
+		timeout:    timeout,
+		stats:      &throttleStats{},
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func get(t *testing.T, transport http.RoundTripper, ctx context.Context, url string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestRoundTripRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		retries  int
+		calls    int32
+		wantErr  bool
+		check    func(t *testing.T, transport *limitedTransport)
+	}{
+		{
+			name:     "429 then success",
+			statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests},
+			retries:  3,
+			calls:    3,
+			check: func(t *testing.T, transport *limitedTransport) {
+				stats := transport.stats.snapshot()
+				if stats.RateLimited != 2 || stats.Retries != 2 || stats.Failed != 0 {
+					t.Errorf("stats = %+v", stats)
+				}
+			},
+		},
+		{
+			name:     "5xx then success",
+			statuses: []int{http.StatusBadGateway},
+			retries:  3,
+			calls:    2,
+			check: func(t *testing.T, transport *limitedTransport) {
+				stats := transport.stats.snapshot()
+				if stats.ServerErrors != 1 || stats.Retries != 1 {
+					t.Errorf("stats = %+v", stats)
+				}
+			},
+		},
+		{
+			name:     "gives up after max retries",
+			statuses: []int{500, 500, 500, 500, 500},
+			retries:  2,
+			calls:    3,
+			wantErr:  true,
+			check: func(t *testing.T, transport *limitedTransport) {
+				stats := transport.stats.snapshot()
+				if stats.ServerErrors != 3 || stats.Retries != 2 || stats.Failed != 1 {
+					t.Errorf("stats = %+v", stats)
+				}
+			},
+		},
+		{
+			name:     "other 4xx is not retried",
+			statuses: []int{http.StatusNotFound},
+			retries:  3,
+			calls:    1,
+			wantErr:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, calls := statusSequenceServer(t, tc.statuses...)
+			transport := newTestTransport(tc.retries, 0) //без таймаута и без дедлайна повторы всё равно идут
+
+			body, err := get(t, transport, context.Background(), srv.URL)
+			if tc.wantErr {
+				if !errors.Is(err, ErrBadResponse) {
+					t.Errorf("expected ErrBadResponse, got %v", err)
+				}
+			} else if err != nil || body != "ok" {
+				t.Errorf("got %q, err %v", body, err)
+			}
+			if got := calls.Load(); got != tc.calls {
+				t.Errorf("server got %d calls, want %d", got, tc.calls)
+			}
+			if tc.check != nil {
+				tc.check(t, transport)
+			}
+		})
+	}
+}
+
+func TestRoundTripStopsRetryingAtDeadline(t *testing.T) {
+	srv, calls := statusSequenceServer(t, 500, 500, 500, 500, 500)
+	transport := newTestTransport(5, 0)
+	transport.backoff = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := get(t, transport, ctx, srv.URL)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server got %d calls, the retry does not fit into the deadline", calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("gave up after %s, should not wait for a retry that can't happen", elapsed)
+	}
+}
+
+// таймаут транспорта не должен обрывать тело ответа, которое читается после RoundTrip
+func TestRoundTripTimeoutKeepsBodyReadable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first,")
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "second")
+	}))
+	t.Cleanup(srv.Close)
+	transport := newTestTransport(0, 5*time.Second)
+
+	body, err := get(t, transport, context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if body != "first,second" {
+		t.Errorf("body = %q", body)
+	}
+}
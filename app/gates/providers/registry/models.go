@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"cryptoRestTest/domain"
+	"errors"
+)
+
+var ErrNoProviders = errors.New("no providers configured")
+var ErrNoPrices = errors.New("no provider returned prices for the provided coins")
+
+// Entry провайдер из списка с именем, под которым он указан в конфиге
+type Entry struct {
+	Name     string
+	Provider domain.Provider
+}
+
+func copyMap(m map[string]domain.WatchedCoin) map[string]domain.WatchedCoin {
+	res := make(map[string]domain.WatchedCoin, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+func extractKeys(m map[string]domain.WatchedCoin) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func isVerified(ref domain.CoinRef, verified map[string]domain.WatchedCoin) bool {
+	if ref.Symbol != "" {
+		_, ok := verified[ref.Symbol]
+		return ok
+	}
+	for _, coin := range verified {
+		if ref.IsContract() && domain.ContractKey(coin.Platform, coin.Contract) == domain.ContractKey(ref.Platform, ref.Contract) {
+			return true
+		}
+		if !ref.IsContract() && coin.Id == ref.Id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,319 @@
+package registry
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Registry хранит несколько провайдеров в порядке приоритета и сам является domain.Provider.
+// Если провайдер упал или вернул не все монеты, оставшиеся монеты запрашиваются у следующего.
+type Registry struct {
+	entries    []Entry
+	currencies []string //монета получена, когда пришли цены во всех этих валютах
+	log        *slog.Logger
+}
+
+// currencies - валюты из coins_watcher.currency. Если они не заданы, монета считается полученной
+// вместе со всеми валютами, которые вернул первый ответивший по ней провайдер
+func NewRegistry(log *slog.Logger, currencies []string, entries ...Entry) *Registry {
+	return &Registry{
+		entries:    entries,
+		currencies: currencies,
+		log:        log,
+	}
+}
+
+func (r *Registry) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	const op = "gates.providers.registry.CoinsPrice"
+
+	if len(r.entries) == 0 {
+		r.log.Error(op, "error", ErrNoProviders)
+		return nil, ErrNoProviders
+	}
+
+	remaining := copyMap(coins)
+	received := make(map[string]map[string]bool, len(coins)) //монета -> валюты, в которых цена уже есть
+	result := make([]domain.Coin, 0, len(coins))
+	var lastErr error
+	for _, entry := range r.entries {
+		if len(remaining) == 0 {
+			break
+		}
+		prices, err := entry.Provider.CoinsPrice(ctx, remaining)
+		if ctx.Err() != nil { //вызывающий ушёл, следующих провайдеров не спрашиваем
+			r.log.Warn(op, "request cancelled", ctx.Err())
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, domain.ErrCircuitOpen) { //о том, что провайдер лежит, предохранитель уже написал
+			r.log.Debug(op, "provider skipped", entry.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		var partial *domain.PartialPricesError
+		if errors.As(err, &partial) { //полученные цены оставляем, у следующего провайдера спросим только остальные
+			r.log.Warn(op, "provider returned part of the prices", entry.Name, "error", err)
+			lastErr = err
+		} else if err != nil {
+			r.log.Warn(op, "provider failed, falling through to the next one", entry.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		for _, coin := range prices {
+			if _, ok := remaining[coin.Name]; !ok { //монета уже получена или её не спрашивали
+				continue
+			}
+			if received[coin.Name][coin.Currency] { //эта валюта уже пришла от провайдера с большим приоритетом
+				continue
+			}
+			if coin.Provider == "" {
+				coin.Provider = entry.Name
+			}
+			result = append(result, coin)
+			if received[coin.Name] == nil {
+				received[coin.Name] = make(map[string]bool, len(r.currencies))
+			}
+			received[coin.Name][coin.Currency] = true
+		}
+		//монета убирается только после ответа провайдера целиком, иначе вторая валюта того же ответа потеряется
+		for name := range remaining {
+			if r.complete(received[name]) {
+				delete(remaining, name)
+			}
+		}
+		if len(remaining) > 0 {
+			r.log.Warn(op, "provider returned partial result", entry.Name, "missing", extractKeys(remaining))
+		}
+	}
+
+	if len(result) == 0 {
+		if lastErr == nil {
+			lastErr = ErrNoPrices
+		}
+		if errors.Is(lastErr, domain.ErrCircuitOpen) {
+			r.log.Debug(op, "no provider returned prices", lastErr)
+			return nil, lastErr
+		}
+		r.log.Error(op, "no provider returned prices", lastErr)
+		return nil, lastErr
+	}
+	if len(remaining) > 0 {
+		missing := extractKeys(remaining)
+		sort.Strings(missing)
+		r.log.Warn(op, "no provider returned prices for coins", missing)
+		if lastErr == nil {
+			lastErr = ErrNoPrices
+		}
+		return result, &domain.PartialPricesError{Missing: missing, Err: lastErr}
+	}
+	return result, nil
+}
+
+// все ли нужные валюты монеты уже получены
+func (r *Registry) complete(currencies map[string]bool) bool {
+	if len(r.currencies) == 0 {
+		return len(currencies) > 0
+	}
+	for _, currency := range r.currencies {
+		if !currencies[currency] {
+			return false
+		}
+	}
+	return true
+}
+
+// монета считается решённой, если провайдер её подтвердил или честно сказал, что символ неоднозначный.
+// Неоднозначность не передаётся следующему провайдеру: клиент должен уточнить id
+func (r *Registry) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	const op = "gates.providers.registry.VerifyCoins"
+
+	verified := make(map[string]domain.WatchedCoin, len(coins))
+	ambiguous := make(map[string][]domain.KnownCoin)
+	remaining := coins
+	var lastErr error
+	for _, entry := range r.entries {
+		if len(remaining) == 0 {
+			break
+		}
+		entryVerified, err := entry.Provider.VerifyCoins(ctx, remaining)
+		if ctx.Err() != nil {
+			r.log.Warn(op, "request cancelled", ctx.Err())
+			return nil, ctx.Err()
+		}
+		var entryAmbiguous *domain.AmbiguousCoinsError
+		if errors.As(err, &entryAmbiguous) {
+			for symbol, candidates := range entryAmbiguous.Candidates {
+				ambiguous[symbol] = candidates
+			}
+		} else if errors.Is(err, errors.ErrUnsupported) { //провайдер монеты не проверяет, это делают остальные
+			r.log.Debug(op, "provider can't verify coins", entry.Name, "error", err)
+			lastErr = err
+		} else if err != nil {
+			r.log.Warn(op, "provider failed to verify coins", entry.Name, "error", err)
+			lastErr = err
+		}
+		for name, coin := range entryVerified {
+			verified[name] = coin
+		}
+
+		next := make([]domain.CoinRef, 0, len(remaining))
+		for _, ref := range remaining {
+			if _, ok := ambiguous[ref.Symbol]; ok {
+				continue
+			}
+			if !isVerified(ref, verified) {
+				next = append(next, ref)
+			}
+		}
+		if len(next) > 0 {
+			r.log.Debug(op, "coins not verified, falling through", entry.Name, "coins", next)
+		}
+		remaining = next
+	}
+
+	r.log.Debug(op, "verified coins", verified)
+	if len(ambiguous) > 0 {
+		return verified, &domain.AmbiguousCoinsError{Candidates: ambiguous}
+	}
+	if len(verified) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return verified, nil
+}
+
+// собирает информацию о кэше списка монет у провайдеров, которые его держат
+func (r *Registry) CoinListCacheInfo() []domain.CoinListCacheInfo {
+	var infos []domain.CoinListCacheInfo
+	for _, entry := range r.entries {
+		cacher, ok := entry.Provider.(domain.CoinListCacher)
+		if !ok {
+			continue
+		}
+		for _, info := range cacher.CoinListCacheInfo() {
+			if info.Provider == "" {
+				info.Provider = entry.Name
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// собирает состояние предохранителей провайдеров
+func (r *Registry) ProviderHealth() []domain.ProviderHealth {
+	var health []domain.ProviderHealth
+	for _, entry := range r.entries {
+		reporter, ok := entry.Provider.(domain.HealthReporter)
+		if !ok {
+			continue
+		}
+		for _, item := range reporter.ProviderHealth() {
+			if item.Provider == "" {
+				item.Provider = entry.Name
+			}
+			health = append(health, item)
+		}
+	}
+	return health
+}
+
+// собирает статистику ограничения запросов у провайдеров
+func (r *Registry) ThrottleStats() []domain.ThrottleStats {
+	var stats []domain.ThrottleStats
+	for _, entry := range r.entries {
+		throttler, ok := entry.Provider.(domain.Throttler)
+		if !ok {
+			continue
+		}
+		for _, stat := range throttler.ThrottleStats() {
+			if stat.Provider == "" {
+				stat.Provider = entry.Name
+			}
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+// история берётся у первого провайдера, который умеет её отдавать и не упал
+func (r *Registry) CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]domain.PriceSample, error) {
+	const op = "gates.providers.registry.CoinHistory"
+
+	lastErr := domain.ErrNoHistoryProvider
+	for _, entry := range r.entries {
+		history, ok := entry.Provider.(domain.HistoryProvider)
+		if !ok {
+			continue
+		}
+		samples, err := history.CoinHistory(ctx, id, currency, from, to)
+		if ctx.Err() != nil {
+			r.log.Warn(op, "request cancelled", ctx.Err())
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			r.log.Warn(op, "provider failed to load history, falling through", entry.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		for i := range samples {
+			if samples[i].Provider == "" {
+				samples[i].Provider = entry.Name
+			}
+		}
+		return samples, nil
+	}
+	return nil, lastErr
+}
+
+// курсы валют берутся у первого провайдера, который умеет их отдавать и не упал
+func (r *Registry) FXRates(ctx context.Context, base string, quotes []string) ([]domain.FXRate, error) {
+	const op = "gates.providers.registry.FXRates"
+
+	lastErr := domain.ErrNoFXProvider
+	for _, entry := range r.entries {
+		source, ok := entry.Provider.(domain.FXSource)
+		if !ok {
+			continue
+		}
+		rates, err := source.FXRates(ctx, base, quotes)
+		if ctx.Err() != nil {
+			r.log.Warn(op, "request cancelled", ctx.Err())
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			r.log.Warn(op, "provider failed to load fx rates, falling through", entry.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		return rates, nil
+	}
+	return nil, lastErr
+}
+
+// описание монеты берётся у первого провайдера, который умеет его отдавать и не упал
+func (r *Registry) CoinMetadata(ctx context.Context, id string) (domain.CoinMetadata, error) {
+	const op = "gates.providers.registry.CoinMetadata"
+
+	lastErr := domain.ErrNoMetadataProvider
+	for _, entry := range r.entries {
+		provider, ok := entry.Provider.(domain.MetadataProvider)
+		if !ok {
+			continue
+		}
+		meta, err := provider.CoinMetadata(ctx, id)
+		if ctx.Err() != nil {
+			r.log.Warn(op, "request cancelled", ctx.Err())
+			return domain.CoinMetadata{}, ctx.Err()
+		}
+		if err != nil {
+			r.log.Warn(op, "provider failed to load coin metadata, falling through", entry.Name, "error", err)
+			lastErr = err
+			continue
+		}
+		return meta, nil
+	}
+	return domain.CoinMetadata{}, lastErr
+}
@@ -0,0 +1,209 @@
+package registry
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	coingecko "cryptoRestTest/gates/providers"
+	"cryptoRestTest/gates/providers/breaker"
+	"cryptoRestTest/internal/config"
+	"cryptoRestTest/internal/fakegecko"
+	"errors"
+	"github.com/shopspring/decimal"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// запасной провайдер, отдаёт цену на всё, что спросили, и запоминает, что именно спросили
+type stubProvider struct {
+	asked []string
+}
+
+func (p *stubProvider) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	var result []domain.Coin
+	for name, coin := range coins {
+		p.asked = append(p.asked, name)
+		result = append(result, domain.Coin{Name: name, Id: coin.Id, Price: decimal.NewFromInt(1), Currency: "usd"})
+	}
+	sort.Strings(p.asked)
+	return result, nil
+}
+
+func (p *stubProvider) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	return nil, nil
+}
+
+// coingecko поверх handler с котировками в валютах currencies
+func geckoClient(t *testing.T, handler http.Handler, currencies ...string) *coingecko.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{}
+	cfg.CoinGecko.BaseURL = srv.URL
+	cfg.CoinGecko.CallsPerMinute = -1
+	cfg.CoinGecko.PriceChunkSize = 1
+	cfg.CoinGecko.PriceWorkers = 2
+	cfg.CoinsWatcher.Timeout = 5 * time.Second
+	cfg.CoinsWatcher.Currency = currencies
+	return coingecko.NewClient(cfg, discardLog, nil)
+}
+
+// coingecko поверх fakegecko, у которого падает пачка цен с dogecoin
+func failingChunkGecko(t *testing.T) *coingecko.Client {
+	t.Helper()
+	gecko := fakegecko.NewServer(fakegecko.ModeDeterministic, 1)
+	return geckoClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/simple/price" && strings.Contains(r.URL.Query().Get("ids"), "dogecoin") {
+			http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		gecko.ServeHTTP(w, r)
+	}), "usd")
+}
+
+func TestCoinsPriceFallsThroughOnlyForMissingCoins(t *testing.T) {
+	gecko := breaker.New("coingecko", failingChunkGecko(t), config.Breaker{FailureThreshold: 1, OpenTimeout: time.Minute}, discardLog)
+	fallback := &stubProvider{}
+	r := NewRegistry(discardLog, []string{"usd"}, Entry{Name: "coingecko", Provider: gecko}, Entry{Name: "fallback", Provider: fallback})
+
+	coins, err := r.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{
+		"btc":  {Id: "bitcoin"},
+		"eth":  {Id: "ethereum"},
+		"doge": {Id: "dogecoin"},
+	})
+	if err != nil {
+		t.Fatalf("CoinsPrice: %v", err)
+	}
+
+	providers := make(map[string]string, len(coins))
+	for _, coin := range coins {
+		providers[coin.Name] = coin.Provider
+	}
+	want := map[string]string{"btc": "coingecko", "eth": "coingecko", "doge": "fallback"}
+	for name, provider := range want {
+		if providers[name] != provider {
+			t.Errorf("%s came from %q, want %q", name, providers[name], provider)
+		}
+	}
+	if len(fallback.asked) != 1 || fallback.asked[0] != "doge" {
+		t.Errorf("fallback was asked for %v, want only doge", fallback.asked)
+	}
+
+	//частичный ответ не должен открывать предохранитель даже при пороге в одну ошибку
+	health := gecko.ProviderHealth()[0]
+	if health.State != domain.CircuitClosed || health.Failures != 0 {
+		t.Errorf("breaker counted a partial result as a failure: %+v", health)
+	}
+}
+
+func TestCoinsPriceReportsCoinsNoProviderHad(t *testing.T) {
+	r := NewRegistry(discardLog, []string{"usd"}, Entry{Name: "coingecko", Provider: failingChunkGecko(t)})
+
+	coins, err := r.CoinsPrice(context.Background(), map[string]domain.WatchedCoin{
+		"btc":  {Id: "bitcoin"},
+		"doge": {Id: "dogecoin"},
+	})
+	var partial *domain.PartialPricesError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected PartialPricesError, got %v", err)
+	}
+	if len(partial.Missing) != 1 || partial.Missing[0] != "doge" {
+		t.Errorf("missing = %v, want [doge]", partial.Missing)
+	}
+	if len(coins) != 1 || coins[0].Name != "btc" {
+		t.Errorf("got %v, want the btc price", coins)
+	}
+}
+
+// ключи монета/валюта полученных цен и кто их дал
+func priceSources(coins []domain.Coin) map[string]string {
+	sources := make(map[string]string, len(coins))
+	for _, coin := range coins {
+		sources[coin.Name+"/"+coin.Currency] = coin.Provider
+	}
+	return sources
+}
+
+var multiCurrencyCoins = map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}, "eth": {Id: "ethereum"}}
+
+func TestCoinsPriceKeepsEveryCurrency(t *testing.T) {
+	currencies := []string{"usd", "eur"}
+	gecko := geckoClient(t, fakegecko.NewServer(fakegecko.ModeDeterministic, 1), currencies...)
+
+	for _, tc := range []struct {
+		name    string
+		entries []Entry
+		want    map[string]string
+	}{
+		{
+			name:    "one provider with both currencies",
+			entries: []Entry{{Name: "coingecko", Provider: gecko}},
+			want:    map[string]string{"btc/usd": "coingecko", "btc/eur": "coingecko", "eth/usd": "coingecko", "eth/eur": "coingecko"},
+		},
+		{
+			//как binance_ws перед coingecko: usd от первого, за eur идём к следующему
+			name:    "missing currency falls through",
+			entries: []Entry{{Name: "usd_only", Provider: &stubProvider{}}, {Name: "coingecko", Provider: gecko}},
+			want:    map[string]string{"btc/usd": "usd_only", "btc/eur": "coingecko", "eth/usd": "usd_only", "eth/eur": "coingecko"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry(discardLog, currencies, tc.entries...)
+			coins, err := r.CoinsPrice(context.Background(), multiCurrencyCoins)
+			if err != nil {
+				t.Fatalf("CoinsPrice: %v", err)
+			}
+			if len(coins) != len(tc.want) {
+				t.Errorf("got %d prices, want %d: %v", len(coins), len(tc.want), priceSources(coins))
+			}
+			sources := priceSources(coins)
+			for key, provider := range tc.want {
+				if sources[key] != provider {
+					t.Errorf("%s came from %q, want %q", key, sources[key], provider)
+				}
+			}
+		})
+	}
+}
+
+// хранилище для ScanPrices: список наблюдения и записанные цены
+type scanStore struct {
+	domain.CoinsStore
+	stored []domain.Coin
+}
+
+func (s *scanStore) GetObserveredCoinsList(ctx context.Context) (map[string]domain.WatchedCoin, error) {
+	return multiCurrencyCoins, nil
+}
+
+func (s *scanStore) AddCoinsPrices(ctx context.Context, coins []domain.Coin) error {
+	s.stored = append(s.stored, coins...)
+	return nil
+}
+
+func TestScanPricesStoresEveryCurrency(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.CoinsWatcher.Currency = config.Currencies{"usd", "eur"}
+	gecko := geckoClient(t, fakegecko.NewServer(fakegecko.ModeDeterministic, 1), cfg.CoinsWatcher.Currency...)
+	r := NewRegistry(discardLog, cfg.CoinsWatcher.Currency, Entry{Name: "coingecko", Provider: breaker.New("coingecko", gecko, config.Breaker{}, discardLog)})
+	store := &scanStore{}
+
+	err := domain.NewWatcher(store, discardLog, r, cfg).ScanPrices(context.Background())
+	if err != nil {
+		t.Fatalf("ScanPrices: %v", err)
+	}
+	stored := priceSources(store.stored)
+	for _, key := range []string{"btc/usd", "btc/eur", "eth/usd", "eth/eur"} {
+		if _, ok := stored[key]; !ok {
+			t.Errorf("%s was not stored, got %v", key, stored)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// читает файл целиком. Формат берётся из конфига, а если он не задан - из расширения файла
+func load(path string, format string) ([]record, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "json" || format == "ndjson" {
+			format = FormatJSONL
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []record
+	switch format {
+	case FormatCSV:
+		records, err = readCSV(file)
+	case FormatJSONL:
+		records, err = readJSONL(file)
+	default:
+		return nil, fmt.Errorf("%s: %w", format, ErrUnknownFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrEmptyFile)
+	}
+	return records, nil
+}
+
+// csv с заголовком timestamp,symbol,id,price, колонки могут идти в любом порядке
+func readCSV(r io.Reader) ([]record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"timestamp", "symbol", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header has no %s column", name)
+		}
+	}
+
+	var records []record
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		rec, err := newRecord(row[columns["timestamp"]], row[columns["symbol"]], column(row, columns, "id"), row[columns["price"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func readJSONL(r io.Reader) ([]record, error) {
+	var records []record
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var raw jsonRecord
+		err := json.Unmarshal([]byte(text), &raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rec, err := newRecord(string(raw.Timestamp), raw.Symbol, raw.Id, raw.Price.String())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// без id монета опознаётся по символу
+func newRecord(timestamp, symbol, id, price string) (record, error) {
+	t, err := parseTimestamp(timestamp)
+	if err != nil {
+		return record{}, fmt.Errorf("invalid timestamp %q: %w", timestamp, err)
+	}
+	p, err := decimal.NewFromString(strings.TrimSpace(price))
+	if err != nil {
+		return record{}, fmt.Errorf("invalid price %q: %w", price, err)
+	}
+	symbol = strings.ToLower(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return record{}, fmt.Errorf("empty symbol")
+	}
+	id = strings.TrimSpace(id)
+	if id == "" {
+		id = symbol
+	}
+	return record{Time: t, Symbol: symbol, Id: id, Price: p}, nil
+}
+
+func column(row []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/shopspring/decimal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const providerName = "replay"
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+var ErrEmptyFile = errors.New("replay file has no price records")
+var ErrUnknownFormat = errors.New("unknown replay file format, use csv or jsonl")
+var ErrNoPrices = errors.New("no replayed prices for watched coins")
+var ErrNoContracts = errors.New("replay provider can't verify tokens by contract")
+var ErrUnknownCurrency = errors.New("replay file has prices in another currency")
+
+// одна цена из файла
+type record struct {
+	Time   time.Time
+	Symbol string
+	Id     string
+	Price  decimal.Decimal
+}
+
+// строка JSON lines: {"timestamp":1736500490,"symbol":"btc","id":"bitcoin","price":"97000.5"}
+type jsonRecord struct {
+	Timestamp json.RawMessage `json:"timestamp"` //число или строка, как и в csv
+	Symbol    string          `json:"symbol"`
+	Id        string          `json:"id"`
+	Price     decimal.Decimal `json:"price"`
+}
+
+// время в файле: unix секунды, unix миллисекунды или RFC3339
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if unix > 1e12 { //секунды дойдут до 1e12 только через 30 тысяч лет
+			return time.UnixMilli(unix).UTC(), nil
+		}
+		return time.Unix(unix, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,199 @@
+package replay
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Provider проигрывает цены из файла так, будто они приходят сейчас. Часы файла идут со скоростью Speed
+// от момента запуска, а при Speed 0 каждый скан переходит к следующему моменту файла, что не зависит от времени.
+// Время цены - время из файла, при Loop каждый следующий проход сдвигается на длину файла
+type Provider struct {
+	cfg config.Replay
+	log *slog.Logger
+
+	series  map[string][]record //id -> цены монеты по времени
+	symbols map[string][]string //символ -> id монет с этим символом
+	times   []time.Time         //различные моменты файла по порядку
+	period  time.Duration       //длина одного прохода файла
+
+	mu       sync.Mutex
+	started  time.Time
+	step     int //сколько сканов проиграно при Speed 0
+	finished bool
+}
+
+func NewProvider(cfg config.Replay, log *slog.Logger) (*Provider, error) {
+	const op = "gates.providers.replay.NewProvider"
+
+	records, err := load(cfg.File, cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+
+	p := &Provider{
+		cfg:     cfg,
+		log:     log,
+		series:  make(map[string][]record),
+		symbols: make(map[string][]string),
+		started: time.Now(),
+	}
+	for _, rec := range records {
+		if _, ok := p.series[rec.Id]; !ok {
+			p.symbols[rec.Symbol] = append(p.symbols[rec.Symbol], rec.Id)
+		}
+		p.series[rec.Id] = append(p.series[rec.Id], rec)
+		if len(p.times) == 0 || !p.times[len(p.times)-1].Equal(rec.Time) {
+			p.times = append(p.times, rec.Time)
+		}
+	}
+
+	//шов между проходами такой же, как последний шаг файла
+	gap := time.Second
+	if n := len(p.times); n > 1 {
+		gap = p.times[n-1].Sub(p.times[n-2])
+	}
+	p.period = p.times[len(p.times)-1].Sub(p.times[0]) + gap
+
+	log.Info(op, "replay file loaded", cfg.File, "records", len(records), "coins", len(p.series),
+		"from", p.times[0], "to", p.times[len(p.times)-1], "speed", cfg.Speed, "loop", cfg.Loop)
+	return p, nil
+}
+
+// последние к текущему моменту файла цены монет из списка наблюдения
+func (p *Provider) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	const op = "gates.providers.replay.CoinsPrice"
+
+	at, shift := p.position(true)
+	result := make([]domain.Coin, 0, len(coins))
+	for name, watched := range coins {
+		if watched.IsContract() {
+			continue
+		}
+		points := p.series[watched.Id]
+		i := sort.Search(len(points), func(i int) bool { return points[i].Time.After(at) }) - 1
+		if i < 0 { //монета появляется в файле позже
+			continue
+		}
+		result = append(result, domain.Coin{
+			Name:        name,
+			Id:          watched.Id,
+			Price:       points[i].Price,
+			Currency:    p.cfg.Currency,
+			Provider:    providerName,
+			LastUpdated: points[i].Time.Add(shift),
+		})
+	}
+	if len(result) == 0 {
+		p.log.Warn(op, "error", ErrNoPrices, "file time", at)
+		return nil, ErrNoPrices
+	}
+	return result, nil
+}
+
+// проверяет монеты по списку монет файла. Выбрать между одинаковыми символами не по чему, поэтому
+// такие символы возвращаются в domain.AmbiguousCoinsError
+func (p *Provider) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	const op = "gates.providers.replay.VerifyCoins"
+
+	verified := make(map[string]domain.WatchedCoin, len(coins))
+	ambiguous := make(map[string][]domain.KnownCoin)
+	for _, ref := range coins {
+		switch {
+		case ref.IsContract():
+			p.log.Warn(op, "skipping token", ref, "error", ErrNoContracts)
+		case ref.Id != "":
+			points, ok := p.series[ref.Id]
+			if !ok || (ref.Symbol != "" && ref.Symbol != points[0].Symbol) {
+				p.log.Warn(op, "coin id not found in replay file or symbol mismatch", ref)
+				continue
+			}
+			verified[points[0].Symbol] = domain.WatchedCoin{Id: ref.Id}
+		default:
+			ids := p.symbols[ref.Symbol]
+			switch len(ids) {
+			case 0:
+				p.log.Warn(op, "coin not found in replay file", ref.Symbol)
+			case 1:
+				verified[ref.Symbol] = domain.WatchedCoin{Id: ids[0]}
+			default:
+				for _, id := range ids {
+					ambiguous[ref.Symbol] = append(ambiguous[ref.Symbol], domain.KnownCoin{Id: id, Symbol: ref.Symbol})
+				}
+			}
+		}
+	}
+
+	p.log.Debug(op, "verified coins", verified)
+	if len(ambiguous) > 0 {
+		return verified, &domain.AmbiguousCoinsError{Candidates: ambiguous}
+	}
+	return verified, nil
+}
+
+// история монеты из текущего прохода файла, но не дальше текущего момента: будущее не подсматриваем
+func (p *Provider) CoinHistory(ctx context.Context, id string, currency string, from, to time.Time) ([]domain.PriceSample, error) {
+	if currency != p.cfg.Currency {
+		return nil, fmt.Errorf("%s: %w", currency, ErrUnknownCurrency)
+	}
+
+	at, shift := p.position(false)
+	var samples []domain.PriceSample
+	for _, rec := range p.series[id] {
+		t := rec.Time.Add(shift)
+		if rec.Time.After(at) || t.Before(from) || t.After(to) {
+			continue
+		}
+		samples = append(samples, domain.PriceSample{
+			Currency: currency,
+			Price:    rec.Price,
+			Time:     t,
+			Provider: providerName,
+		})
+	}
+	return samples, nil
+}
+
+// текущий момент файла и сдвиг времени для номера прохода. advance переводит пошаговый режим на следующий момент
+func (p *Provider) position(advance bool) (time.Time, time.Duration) {
+	const op = "gates.providers.replay.position"
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	first, last := p.times[0], p.times[len(p.times)-1]
+	var at time.Time
+	var cycle int64
+	if p.cfg.Speed <= 0 {
+		step := max(p.step-1, 0)
+		if advance {
+			step = p.step
+			p.step++
+		}
+		cycle = int64(step / len(p.times))
+		at = p.times[step%len(p.times)]
+		if !p.cfg.Loop && step >= len(p.times) {
+			cycle, at = 0, last
+		}
+	} else {
+		elapsed := time.Duration(float64(time.Since(p.started)) * p.cfg.Speed)
+		cycle = int64(elapsed / p.period)
+		at = first.Add(elapsed % p.period)
+		if !p.cfg.Loop && elapsed >= p.period {
+			cycle, at = 0, last
+		}
+	}
+
+	if !p.cfg.Loop && !at.Before(last) && !p.finished {
+		p.finished = true
+		p.log.Info(op, "replay file finished, prices will not change anymore", p.cfg.File)
+	}
+	return at, time.Duration(cycle) * p.period
+}
@@ -0,0 +1,242 @@
+package replay
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// в example.csv 24 почасовых момента по трём монетам
+var (
+	exampleFirst  = time.Unix(1736467200, 0).UTC()
+	exampleLast   = exampleFirst.Add(23 * time.Hour)
+	examplePeriod = 24 * time.Hour
+)
+
+func TestReadCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want []record
+	}{
+		{
+			name: "columns in any order",
+			data: "price,id,timestamp,symbol\n97000.5,bitcoin,1736467200,BTC\n",
+			want: []record{{Time: exampleFirst, Symbol: "btc", Id: "bitcoin"}},
+		},
+		{
+			name: "no id column uses the symbol",
+			data: "symbol,timestamp,price\neth,1736467200,3300\n",
+			want: []record{{Time: exampleFirst, Symbol: "eth", Id: "eth"}},
+		},
+		{
+			name: "milliseconds, seconds and RFC3339",
+			data: "timestamp,symbol,id,price\n1736467200000,btc,,1\n1736467201,btc,,2\n2025-01-10T00:00:02Z,btc,,3\n",
+			want: []record{
+				{Time: exampleFirst, Symbol: "btc", Id: "btc"},
+				{Time: exampleFirst.Add(time.Second), Symbol: "btc", Id: "btc"},
+				{Time: exampleFirst.Add(2 * time.Second), Symbol: "btc", Id: "btc"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := readCSV(strings.NewReader(tc.data))
+			if err != nil {
+				t.Fatalf("readCSV: %v", err)
+			}
+			checkRecords(t, records, tc.want)
+		})
+	}
+}
+
+func TestReadCSVBadRows(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want string //часть текста ошибки
+	}{
+		{name: "missing price column", data: "timestamp,symbol\n1,btc\n", want: "no price column"},
+		{name: "bad price", data: "timestamp,symbol,price\n1736467200,btc,1\n1736467200,eth,abc\n", want: "line 3"},
+		{name: "bad timestamp", data: "timestamp,symbol,price\nyesterday,btc,1\n", want: "invalid timestamp"},
+		{name: "empty symbol", data: "timestamp,symbol,price\n1736467200, ,1\n", want: "empty symbol"},
+		{name: "short row", data: "timestamp,symbol,price\n1736467200,btc\n", want: "wrong number of fields"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readCSV(strings.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	data := `{"timestamp":1736467200,"symbol":"BTC","id":"bitcoin","price":"97000.5"}
+
+{"timestamp":"1736467200000","symbol":"eth","price":3300}
+{"timestamp":"2025-01-10T00:00:02Z","symbol":"usdt","id":"tether","price":1}
+`
+	records, err := readJSONL(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("readJSONL: %v", err)
+	}
+	checkRecords(t, records, []record{
+		{Time: exampleFirst, Symbol: "btc", Id: "bitcoin"},
+		{Time: exampleFirst, Symbol: "eth", Id: "eth"},
+		{Time: exampleFirst.Add(2 * time.Second), Symbol: "usdt", Id: "tether"},
+	})
+	if records[0].Price.String() != "97000.5" {
+		t.Errorf("price = %s, want 97000.5", records[0].Price)
+	}
+
+	for _, bad := range []string{
+		"{\"timestamp\":1,\"symbol\":\"btc\",\"price\":1}\n{not json}\n",
+		"{\"timestamp\":1,\"symbol\":\"btc\",\"price\":1}\n{\"timestamp\":\"soon\",\"symbol\":\"btc\",\"price\":1}\n",
+	} {
+		if _, err := readJSONL(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("err = %v, want an error on line 2", err)
+		}
+	}
+}
+
+func checkRecords(t *testing.T, got, want []record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Symbol != want[i].Symbol || got[i].Id != want[i].Id {
+			t.Errorf("record %d = %s %s @ %s, want %s %s @ %s", i, got[i].Symbol, got[i].Id, got[i].Time, want[i].Symbol, want[i].Id, want[i].Time)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	records, err := load("example.csv", "")
+	if err != nil {
+		t.Fatalf("load example.csv: %v", err)
+	}
+	if len(records) != 72 {
+		t.Errorf("got %d records from example.csv, want 72", len(records))
+	}
+
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	if _, err = load(write("prices.ndjson", `{"timestamp":1,"symbol":"btc","price":1}`), ""); err != nil {
+		t.Errorf("ndjson by extension: %v", err)
+	}
+	if _, err = load(write("prices.txt", "timestamp,symbol,price\n1,btc,1\n"), FormatCSV); err != nil {
+		t.Errorf("format from config: %v", err)
+	}
+	if _, err = load(write("prices.xml", "<prices/>"), ""); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+	if _, err = load(write("empty.csv", "timestamp,symbol,price\n"), ""); !errors.Is(err, ErrEmptyFile) {
+		t.Errorf("expected ErrEmptyFile, got %v", err)
+	}
+}
+
+func newExampleProvider(t *testing.T, speed float64, loop bool) *Provider {
+	t.Helper()
+	p, err := NewProvider(config.Replay{File: "example.csv", Speed: speed, Loop: loop, Currency: "usd"}, discardLog)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return p
+}
+
+func TestPositionStepMode(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		loop  bool
+		steps int //сколько сканов сделать до проверки
+		at    time.Time
+		shift time.Duration
+	}{
+		{name: "first scan plays the first moment", steps: 1, at: exampleFirst},
+		{name: "each scan moves one moment", steps: 5, at: exampleFirst.Add(4 * time.Hour)},
+		{name: "last moment", steps: 24, at: exampleLast},
+		{name: "without loop stays at the end", steps: 30, at: exampleLast},
+		{name: "loop starts over with shifted time", loop: true, steps: 26, at: exampleFirst.Add(time.Hour), shift: examplePeriod},
+		{name: "third pass", loop: true, steps: 49, at: exampleFirst, shift: 2 * examplePeriod},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newExampleProvider(t, 0, tc.loop)
+			var at time.Time
+			var shift time.Duration
+			for range tc.steps {
+				at, shift = p.position(true)
+			}
+			if !at.Equal(tc.at) || shift != tc.shift {
+				t.Errorf("position = %s + %s, want %s + %s", at, shift, tc.at, tc.shift)
+			}
+			//без advance отдаётся последний проигранный момент
+			peekAt, peekShift := p.position(false)
+			if !peekAt.Equal(at) || peekShift != shift {
+				t.Errorf("peek = %s + %s, want %s + %s", peekAt, peekShift, at, shift)
+			}
+		})
+	}
+}
+
+func TestPositionSpeed(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		speed   float64
+		loop    bool
+		elapsed time.Duration //сколько реального времени прошло с запуска
+		at      time.Time
+		shift   time.Duration
+	}{
+		{name: "real time", speed: 1, elapsed: 90 * time.Minute, at: exampleFirst.Add(90 * time.Minute)},
+		{name: "sped up", speed: 60, elapsed: 10 * time.Minute, at: exampleFirst.Add(10 * time.Hour)},
+		{name: "without loop stops at the end", speed: 60, elapsed: 25 * time.Minute, at: exampleLast},
+		{name: "loop shifts the second pass", speed: 60, loop: true, elapsed: 25 * time.Minute, at: exampleFirst.Add(time.Hour), shift: examplePeriod},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newExampleProvider(t, tc.speed, tc.loop)
+			p.started = time.Now().Add(-tc.elapsed)
+			at, shift := p.position(true)
+			//пока идёт тест, часы файла успевают немного уйти вперёд
+			if at.Before(tc.at) || at.Sub(tc.at) > time.Duration(tc.speed*float64(time.Second)) || shift != tc.shift {
+				t.Errorf("position = %s + %s, want %s + %s", at, shift, tc.at, tc.shift)
+			}
+		})
+	}
+}
+
+func TestCoinsPriceReplaysFile(t *testing.T) {
+	p := newExampleProvider(t, 0, true)
+	coins := map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}, "doge": {Id: "dogecoin"}}
+
+	var first []domain.Coin
+	for range 25 { //второй проход начинается снова с первого момента
+		var err error
+		first, err = p.CoinsPrice(context.Background(), coins)
+		if err != nil {
+			t.Fatalf("CoinsPrice: %v", err)
+		}
+	}
+	if len(first) != 1 || first[0].Name != "btc" || first[0].Price.String() != "94500" {
+		t.Fatalf("got %v, want the first btc price", first)
+	}
+	if want := exampleFirst.Add(examplePeriod); !first[0].LastUpdated.Equal(want) {
+		t.Errorf("last updated = %s, want %s", first[0].LastUpdated, want)
+	}
+}
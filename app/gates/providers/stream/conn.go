@@ -0,0 +1,126 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"time"
+)
+
+// session живёт одно соединение: подписывается на монеты из списка наблюдения, читает тикеры
+// и донастраивает подписку, когда список меняется. Возвращает, успело ли соединение поработать
+func (p *Provider) session(ctx context.Context) (bool, error) {
+	const op = "gates.providers.stream.session"
+
+	wsCfg, err := websocket.NewConfig(p.cfg.URL, "http://localhost/")
+	if err != nil {
+		return false, err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, p.cfg.MaxAge)
+	ws, err := wsCfg.DialContext(dialCtx)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() { //чтение не знает про ctx, поэтому при отмене соединение просто закрывается
+		<-ctx.Done()
+		ws.Close()
+	}()
+
+	p.mu.Lock()
+	p.subscribed = make(map[string]bool)
+	p.mu.Unlock()
+	err = p.syncSubscriptions(ctx, ws)
+	if err != nil {
+		return false, err
+	}
+	p.log.Info(op, "stream connected", p.cfg.URL)
+
+	go func() {
+		ticker := time.NewTicker(p.cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.syncSubscriptions(ctx, ws); err != nil {
+					p.log.Warn(op, "failed to update subscriptions", err)
+					stop()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		deadline := time.Time{}
+		p.mu.Lock()
+		if len(p.subscribed) > 0 { //без подписок биржа молчит, и это нормально
+			deadline = time.Now().Add(p.cfg.MaxAge)
+		}
+		p.mu.Unlock()
+		_ = ws.SetReadDeadline(deadline)
+
+		var msg message
+		err = websocket.JSON.Receive(ws, &msg)
+		if err != nil {
+			return true, err
+		}
+		if msg.ID != nil {
+			p.log.Debug(op, "command acknowledged", *msg.ID)
+			continue
+		}
+		if msg.Event == "24hrTicker" {
+			p.update(msg)
+		}
+	}
+}
+
+// сверяет подписки соединения со списком наблюдения и досылает SUBSCRIBE/UNSUBSCRIBE
+func (p *Provider) syncSubscriptions(ctx context.Context, ws *websocket.Conn) error {
+	const op = "gates.providers.stream.syncSubscriptions"
+
+	watched, err := p.store.GetObserveredCoinsList(ctx)
+	if err != nil {
+		p.log.Warn(op, "failed to get watchlist, keeping current subscriptions", err)
+		return nil
+	}
+
+	p.mu.Lock()
+	p.watched = watched
+	var subscribe, unsubscribe []string
+	for name, coin := range watched {
+		if !p.subscribed[name] && !coin.IsContract() {
+			subscribe = append(subscribe, p.streamName(name))
+			p.subscribed[name] = true
+		}
+	}
+	for name := range p.subscribed {
+		if _, ok := watched[name]; !ok {
+			unsubscribe = append(unsubscribe, p.streamName(name))
+			delete(p.subscribed, name)
+		}
+	}
+	p.mu.Unlock()
+
+	for method, params := range map[string][]string{"SUBSCRIBE": subscribe, "UNSUBSCRIBE": unsubscribe} {
+		if len(params) == 0 {
+			continue
+		}
+		p.log.Debug(op, method, params)
+		err = websocket.JSON.Send(ws, command{Method: method, Params: params, ID: time.Now().UnixNano()})
+		if err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// btc -> btcusdt@ticker
+func (p *Provider) streamName(name string) string {
+	return name + p.cfg.QuoteAsset + "@ticker"
+}
@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const providerName = "binance_ws"
+
+var ErrNotVerifier = fmt.Errorf("stream provider can't verify coins, add coingecko to providers.order: %w", errors.ErrUnsupported)
+var ErrNoFreshQuotes = errors.New("no fresh quotes in stream")
+
+// Store то, что стриму нужно от хранилища: список наблюдения и запись цен
+type Store interface {
+	GetObserveredCoinsList(ctx context.Context) (map[string]domain.WatchedCoin, error)
+	AddCoinsPrices(ctx context.Context, coins []domain.Coin) error
+}
+
+// последняя котировка монеты из стрима
+type quote struct {
+	price     decimal.Decimal
+	change24h *decimal.Decimal
+	volume24h *decimal.Decimal
+	time      time.Time       //время события на бирже
+	flushed   decimal.Decimal //последняя записанная в бд цена
+	dirty     bool            //цена менялась после последней записи
+}
+
+// команда подписки в формате Binance
+type command struct {
+	Method string   `json:"method"` //SUBSCRIBE, UNSUBSCRIBE
+	Params []string `json:"params"`
+	ID     int64    `json:"id"`
+}
+
+// сообщение из стрима: либо ответ на команду ({"result":null,"id":1}), либо событие 24hrTicker
+type message struct {
+	ID        *int64 `json:"id"`
+	Event     string `json:"e"`
+	EventTime int64  `json:"E"` //мс
+	Symbol    string `json:"s"` //BTCUSDT
+	Price     string `json:"c"` //последняя цена
+	Change    string `json:"P"` //изменение за 24 часа в процентах
+	Volume    string `json:"q"` //объём за 24 часа в валюте котировки
+}
+
+func optionalDecimal(value string) *decimal.Decimal {
+	if value == "" {
+		return nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return nil
+	}
+	return &d
+}
+
+var hundred = decimal.NewFromInt(100)
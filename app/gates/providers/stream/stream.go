@@ -0,0 +1,202 @@
+package stream
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider держит открытой подписку на тикеры биржи для монет из списка наблюдения.
+// Последние цены лежат в памяти и пишутся в бд раз в FlushInterval
+// или сразу, если цена ушла от последней записанной больше чем на ChangeThreshold процентов.
+// Записью котировок стрима владеет только он сам: CoinsPrice помечает их domain.Coin.Persisted,
+// чтобы ScanPrices не записал ту же цену ещё раз
+type Provider struct {
+	cfg     config.Stream
+	log     *slog.Logger
+	store   Store
+	persist bool //false - котировки не пишутся, их записывает тот, кто спрашивает CoinsPrice
+
+	mu         sync.Mutex
+	quotes     map[string]*quote             //символ монеты -> последняя котировка
+	watched    map[string]domain.WatchedCoin //символ монеты -> монета из списка наблюдения
+	subscribed map[string]bool               //символы, на которые подписано текущее соединение
+	urgent     chan struct{}
+}
+
+func NewProvider(cfg config.Stream, log *slog.Logger, store Store) *Provider {
+	return &Provider{
+		cfg:        cfg,
+		log:        log,
+		store:      store,
+		persist:    true,
+		quotes:     make(map[string]*quote),
+		watched:    make(map[string]domain.WatchedCoin),
+		subscribed: make(map[string]bool),
+		urgent:     make(chan struct{}, 1),
+	}
+}
+
+// DisableFlush выключает собственную запись котировок, например когда из них считается консенсус
+// и в бд должна попасть только согласованная цена. Вызывается до Run
+func (p *Provider) DisableFlush() {
+	p.persist = false
+}
+
+// Run держит соединение со стримом и пишет цены в бд, пока не отменён ctx.
+// Упавшее соединение переподключается с экспоненциальной задержкой
+func (p *Provider) Run(ctx context.Context) {
+	const op = "gates.providers.stream.Run"
+
+	if p.persist {
+		go p.flushLoop(ctx)
+	}
+
+	backoff := p.cfg.ReconnectBackoff
+	for {
+		connected, err := p.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected { //соединение успело поработать, начинаем задержки заново
+			backoff = p.cfg.ReconnectBackoff
+		}
+		p.log.Warn(op, "stream disconnected, reconnecting", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, p.cfg.MaxBackoff)
+	}
+}
+
+// котировки из памяти, устаревшие не отдаются, чтобы registry спросил следующего провайдера
+func (p *Provider) CoinsPrice(ctx context.Context, coins map[string]domain.WatchedCoin) ([]domain.Coin, error) {
+	const op = "gates.providers.stream.CoinsPrice"
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := make([]domain.Coin, 0, len(coins))
+	for name, watched := range coins {
+		q, ok := p.quotes[name]
+		if !ok || watched.IsContract() || time.Since(q.time) > p.cfg.MaxAge { //у токенов по контракту символ пары на бирже неизвестен
+			continue
+		}
+		coin := p.toCoin(name, watched.Id, q)
+		coin.Persisted = p.persist
+		result = append(result, coin)
+	}
+	if len(result) == 0 {
+		p.log.Warn(op, "error", ErrNoFreshQuotes)
+		return nil, ErrNoFreshQuotes
+	}
+	return result, nil
+}
+
+// биржа не знает id coingecko, поэтому монеты подтверждают другие провайдеры из списка.
+// ErrNotVerifier оборачивает errors.ErrUnsupported: предохранитель и registry не считают это падением провайдера
+func (p *Provider) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	return nil, ErrNotVerifier
+}
+
+// пишет в бд изменившиеся котировки по таймеру или по сигналу о большом изменении цены
+func (p *Provider) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.urgent:
+		}
+		p.flush(ctx)
+	}
+}
+
+func (p *Provider) flush(ctx context.Context) {
+	const op = "gates.providers.stream.flush"
+
+	p.mu.Lock()
+	var coins []domain.Coin
+	for name, q := range p.quotes {
+		watched, ok := p.watched[name]
+		if !ok || watched.IsContract() || !q.dirty {
+			continue
+		}
+		coins = append(coins, p.toCoin(name, watched.Id, q))
+	}
+	p.mu.Unlock()
+	if len(coins) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.FlushInterval)
+	defer cancel()
+	err := p.store.AddCoinsPrices(ctx, coins)
+	if err != nil {
+		p.log.Error(op, "failed to flush stream prices", err)
+		return
+	}
+
+	p.mu.Lock()
+	for _, coin := range coins {
+		q := p.quotes[coin.Name]
+		q.flushed = coin.Price
+		q.dirty = !q.price.Equal(coin.Price) //пока писали, могла прийти новая цена
+	}
+	p.mu.Unlock()
+	p.log.Debug(op, "flushed stream prices", len(coins))
+}
+
+// обновляет котировку и просит немедленной записи, если цена ушла дальше порога
+func (p *Provider) update(msg message) {
+	const op = "gates.providers.stream.update"
+
+	price := optionalDecimal(msg.Price)
+	name := strings.TrimSuffix(strings.ToLower(msg.Symbol), p.cfg.QuoteAsset)
+	if price == nil || name == "" {
+		p.log.Debug(op, "skipping ticker", msg.Symbol)
+		return
+	}
+
+	p.mu.Lock()
+	q, ok := p.quotes[name]
+	if !ok {
+		q = &quote{}
+		p.quotes[name] = q
+	}
+	q.price = *price
+	q.change24h = optionalDecimal(msg.Change)
+	q.volume24h = optionalDecimal(msg.Volume)
+	q.time = time.UnixMilli(msg.EventTime).UTC()
+	q.dirty = true
+	urgent := p.persist && p.cfg.ChangeThreshold > 0 && (q.flushed.IsZero() ||
+		q.price.Sub(q.flushed).Div(q.flushed).Abs().Mul(hundred).InexactFloat64() >= p.cfg.ChangeThreshold)
+	p.mu.Unlock()
+
+	if urgent {
+		select {
+		case p.urgent <- struct{}{}:
+		default: //запись уже запрошена
+		}
+	}
+}
+
+func (p *Provider) toCoin(name, id string, q *quote) domain.Coin {
+	return domain.Coin{
+		Name:        name,
+		Id:          id,
+		Price:       q.price,
+		Currency:    p.cfg.Currency,
+		Provider:    providerName,
+		Volume24h:   q.volume24h,
+		Change24h:   q.change24h,
+		LastUpdated: q.time,
+	}
+}
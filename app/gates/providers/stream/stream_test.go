@@ -0,0 +1,147 @@
+package stream
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"cryptoRestTest/internal/fakeexchange"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// хранилище в памяти: фиксированный список наблюдения и все записанные цены
+type memStore struct {
+	watched map[string]domain.WatchedCoin
+
+	mu     sync.Mutex
+	stored []domain.Coin
+}
+
+func (s *memStore) GetObserveredCoinsList(ctx context.Context) (map[string]domain.WatchedCoin, error) {
+	return s.watched, nil
+}
+
+func (s *memStore) AddCoinsPrices(ctx context.Context, coins []domain.Coin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored = append(s.stored, coins...)
+	return nil
+}
+
+func (s *memStore) snapshot() []domain.Coin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]domain.Coin(nil), s.stored...)
+}
+
+var watchlist = map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}, "eth": {Id: "ethereum"}}
+
+// провайдер, подключённый к фейковой бирже, которая шлёт тикеры каждые 10мс
+func runTestProvider(t *testing.T, persist bool) (*Provider, *memStore) {
+	t.Helper()
+	srv := httptest.NewServer(fakeexchange.NewServer(10*time.Millisecond, 0, 1))
+	t.Cleanup(srv.Close)
+
+	store := &memStore{watched: watchlist}
+	p := NewProvider(config.Stream{
+		URL:              "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws",
+		QuoteAsset:       "usdt",
+		Currency:         "usd",
+		FlushInterval:    50 * time.Millisecond,
+		MaxAge:           5 * time.Second,
+		ReconnectBackoff: 10 * time.Millisecond,
+		MaxBackoff:       100 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)), store)
+	if !persist {
+		p.DisableFlush()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return p, store
+}
+
+// ждёт, пока у стрима появятся котировки всех монет списка наблюдения
+func waitForQuotes(t *testing.T, p *Provider) []domain.Coin {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		coins, err := p.CoinsPrice(context.Background(), watchlist)
+		if err == nil && len(coins) == len(watchlist) {
+			return coins
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no quotes from the fake exchange")
+	return nil
+}
+
+func TestStreamOwnsItsWrites(t *testing.T) {
+	p, store := runTestProvider(t, true)
+
+	for _, coin := range waitForQuotes(t, p) {
+		if !coin.Persisted {
+			t.Errorf("%s is not marked as persisted, ScanPrices would store it again", coin.Name)
+		}
+		if coin.Provider != providerName || coin.Currency != "usd" || coin.LastUpdated.IsZero() {
+			t.Errorf("unexpected quote %+v", coin)
+		}
+	}
+
+	time.Sleep(200 * time.Millisecond) //несколько циклов записи
+	stored := store.snapshot()
+	seen := make(map[string]bool, len(stored))
+	names := make(map[string]bool)
+	for _, coin := range stored {
+		key := coin.Name + "@" + coin.LastUpdated.String()
+		if seen[key] {
+			t.Errorf("quote %s was written twice", key)
+		}
+		seen[key] = true
+		names[coin.Name] = true
+	}
+	for name := range watchlist {
+		if !names[name] {
+			t.Errorf("stream never flushed %s", name)
+		}
+	}
+}
+
+func TestStreamWithoutFlush(t *testing.T) {
+	p, store := runTestProvider(t, false)
+
+	for _, coin := range waitForQuotes(t, p) {
+		if coin.Persisted {
+			t.Errorf("%s is marked as persisted, but the stream does not write it", coin.Name)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if stored := store.snapshot(); len(stored) > 0 {
+		t.Errorf("stream with flush disabled wrote %d prices", len(stored))
+	}
+}
+
+func TestStreamVerifyCoins(t *testing.T) {
+	p := NewProvider(config.Stream{}, slog.New(slog.NewTextHandler(io.Discard, nil)), &memStore{})
+	verified, err := p.VerifyCoins(context.Background(), []domain.CoinRef{{Symbol: "btc"}})
+	if !errors.Is(err, ErrNotVerifier) || !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected ErrNotVerifier wrapping errors.ErrUnsupported, got %v", err)
+	}
+	if verified != nil {
+		t.Errorf("verified = %v, want nil", verified)
+	}
+}
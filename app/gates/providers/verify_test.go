@@ -0,0 +1,148 @@
+package coingecko
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// /coins/list с несколькими монетами на одном символе и /coins/markets с капитализациями marketCaps
+func verifyHandler(t *testing.T, marketCaps map[string]float64, listCalls *atomic.Int32) http.Handler {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/coins/list", func(w http.ResponseWriter, r *http.Request) {
+		listCalls.Add(1)
+		json.NewEncoder(w).Encode([]map[string]string{
+			{"id": "bitcoin", "symbol": "btc", "name": "Bitcoin"},
+			{"id": "ethereum", "symbol": "eth", "name": "Ethereum"},
+			{"id": "ethereum-wormhole", "symbol": "eth", "name": "Ethereum (Wormhole)"},
+			{"id": "usd-coin", "symbol": "usdc", "name": "USDC"},
+			{"id": "bridged-usdc", "symbol": "usdc", "name": "Bridged USDC"},
+			{"id": "usdc-clone", "symbol": "usdc", "name": "USDC Clone"},
+		})
+	})
+	mux.HandleFunc("/coins/markets", func(w http.ResponseWriter, r *http.Request) {
+		var markets []map[string]any
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if marketCap, ok := marketCaps[id]; ok {
+				markets = append(markets, map[string]any{"id": id, "market_cap": marketCap})
+			}
+		}
+		json.NewEncoder(w).Encode(markets)
+	})
+	mux.HandleFunc("/coins/{platform}/contract/{address}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("platform") != "ethereum" || r.PathValue("address") != "0xa0b8" {
+			http.Error(w, `{"error":"coin not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "usd-coin", "symbol": "usdc"})
+	})
+	return mux
+}
+
+func TestVerifyCoinsResolvesSymbols(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		refs       []domain.CoinRef
+		marketCaps map[string]float64
+		verified   map[string]string //символ -> id
+		ambiguous  map[string][]string
+	}{
+		{
+			name:     "unique symbol",
+			refs:     []domain.CoinRef{{Symbol: "btc"}},
+			verified: map[string]string{"btc": "bitcoin"},
+		},
+		{
+			name:       "largest market cap wins",
+			refs:       []domain.CoinRef{{Symbol: "eth"}},
+			marketCaps: map[string]float64{"ethereum": 400e9, "ethereum-wormhole": 1e6},
+			verified:   map[string]string{"eth": "ethereum"},
+		},
+		{
+			name:       "tie between leaders stays ambiguous",
+			refs:       []domain.CoinRef{{Symbol: "usdc"}, {Symbol: "btc"}},
+			marketCaps: map[string]float64{"usd-coin": 5e9, "bridged-usdc": 5e9, "usdc-clone": 1},
+			verified:   map[string]string{"btc": "bitcoin"},
+			ambiguous:  map[string][]string{"usdc": {"bridged-usdc", "usd-coin", "usdc-clone"}},
+		},
+		{
+			name:      "no market caps at all",
+			refs:      []domain.CoinRef{{Symbol: "eth"}},
+			verified:  map[string]string{},
+			ambiguous: map[string][]string{"eth": {"ethereum", "ethereum-wormhole"}},
+		},
+		{
+			name:     "explicit id skips market caps",
+			refs:     []domain.CoinRef{{Symbol: "eth", Id: "ethereum-wormhole"}},
+			verified: map[string]string{"eth": "ethereum-wormhole"},
+		},
+		{
+			name:     "id that does not match the symbol",
+			refs:     []domain.CoinRef{{Symbol: "btc", Id: "ethereum"}, {Id: "no-such-coin"}},
+			verified: map[string]string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var listCalls atomic.Int32
+			client := newTestClient(t, verifyHandler(t, tc.marketCaps, &listCalls))
+
+			verified, err := client.VerifyCoins(context.Background(), tc.refs)
+			var ambiguous *domain.AmbiguousCoinsError
+			if tc.ambiguous == nil && err != nil {
+				t.Fatalf("VerifyCoins: %v", err)
+			}
+			if tc.ambiguous != nil {
+				if !errors.As(err, &ambiguous) {
+					t.Fatalf("expected AmbiguousCoinsError, got %v", err)
+				}
+				for symbol, want := range tc.ambiguous {
+					var got []string
+					for _, coin := range ambiguous.Candidates[symbol] {
+						got = append(got, coin.Id)
+					}
+					sort.Strings(got)
+					if strings.Join(got, ",") != strings.Join(want, ",") {
+						t.Errorf("%s candidates = %v, want %v", symbol, got, want)
+					}
+				}
+			}
+			if len(verified) != len(tc.verified) {
+				t.Errorf("verified %v, want %v", verified, tc.verified)
+			}
+			for symbol, id := range tc.verified {
+				if verified[symbol].Id != id {
+					t.Errorf("%s verified as %q, want %q", symbol, verified[symbol].Id, id)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCoinsByContractDoesNotNeedCoinList(t *testing.T) {
+	var listCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/coins/list", func(w http.ResponseWriter, r *http.Request) {
+		listCalls.Add(1)
+		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+	})
+	mux.Handle("/coins/{platform}/contract/{address}", verifyHandler(t, nil, &listCalls))
+	client := newTestClient(t, mux)
+
+	verified, err := client.VerifyCoins(context.Background(), []domain.CoinRef{{Symbol: "usdc", Platform: "ethereum", Contract: "0xA0B8"}})
+	if err != nil {
+		t.Fatalf("VerifyCoins: %v", err)
+	}
+	if coin := verified["usdc"]; coin.Id != "usd-coin" || coin.Contract != "0xa0b8" {
+		t.Errorf("verified %+v, want usd-coin by 0xa0b8", verified)
+	}
+	if listCalls.Load() != 0 {
+		t.Errorf("contract-only verification fetched /coins/list %d times", listCalls.Load())
+	}
+}
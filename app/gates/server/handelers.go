@@ -5,6 +5,7 @@ import (
 	"cryptoRestTest/gates/storage"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,13 +15,16 @@ import (
 // AddCurrencyHandler handles the addition of observed currencies.
 //
 // @Summary Add Observed Currencies
-// @Description Adds a list of currencies to the observed list.
+// @Description Adds a list of currencies to the observed list. Coins may be passed as "btc,eth" or as a list
+// @Description of symbols and {"symbol":"eth","id":"ethereum"} objects to pin an exact CoinGecko id.
+// @Description Tokens may be added by {"platform":"ethereum","contract":"0x..."}, prices are then fetched by contract.
 // @Tags Currencies
 // @Accept json
 // @Produce json
 // @Param request body addCoinsReq true "Request body with coins to add"
 // @Success 200 {string} string "Successfully added coins"
 // @Failure 400 {string} string "Invalid input or validation error"
+// @Failure 409 {object} ambiguousCoinsResponse "Symbol matches several coins, candidates are listed"
 // @Failure 500 {string} string "Internal server error"
 // @Router /currency/add [post]
 func (s *Server) AddCurrencyHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,10 +37,15 @@ func (s *Server) AddCurrencyHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	coinsStr := req.Coins
-	s.log.Info("op", "connected to AddCurrencyHandler, trying to add currency id: ", coinsStr)
-	coins := strings.Split(coinsStr, ",")
-	err = s.coinSrv.AddObserveredCoins(coins)
+	coins := req.Coins.toDomain()
+	s.log.Info(op, "connected to AddCurrencyHandler, trying to add currency id: ", coins)
+	err = s.coinSrv.AddObserveredCoins(r.Context(), coins)
+	var ambiguous *domain.AmbiguousCoinsError
+	if errors.As(err, &ambiguous) { //символ неоднозначный, отдаём кандидатов чтобы клиент выбрал id
+		s.log.Debug(op, "ambiguous coins: ", err)
+		s.writeAmbiguousCoins(w, ambiguous)
+		return
+	}
 	if err == domain.ErrNoVerifiedCoins { //не прошло verify coin (нет такой у coingecko)
 		s.log.Debug(op, "tried to add not existing coin: ", err)
 		http.Error(w, "No coin passed verification, (probably this coins don't exist?)", http.StatusBadRequest)
@@ -53,24 +62,57 @@ func (s *Server) AddCurrencyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.log.Info(op, ": added coins")
+	s.log.Info(op + ": added coins")
 	w.WriteHeader(http.StatusOK)
 }
 
+func (s *Server) writeAmbiguousCoins(w http.ResponseWriter, ambiguous *domain.AmbiguousCoinsError) {
+	const op = "gates.Server.writeAmbiguousCoins"
+
+	resp := ambiguousCoinsResponse{
+		Error:      ambiguous.Error(),
+		Candidates: make(map[string][]candidateCoin, len(ambiguous.Candidates)),
+	}
+	for symbol, coins := range ambiguous.Candidates {
+		for _, coin := range coins {
+			resp.Candidates[symbol] = append(resp.Candidates[symbol], candidateCoin{Id: coin.Id, Name: coin.Name})
+		}
+	}
+	response, err := json.Marshal(resp)
+	if err != nil {
+		s.log.Error(op, "Failed to marshal response", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	w.Write(response)
+}
+
 // getList returns the list of currently observed currencies.
 //
 // @Summary Get Observed Currencies
-// @Description Retrieves a list of all observed currencies.
+// @Description Retrieves a list of all observed currencies. With include=details the list holds watchlistEntryResponse
+// @Description objects: id, contract and metadata (name, image, categories, genesis date, market cap rank) once it is loaded.
 // @Tags Currencies
 // @Produce json
+// @Param include query string false "Pass 'details' to return coin metadata instead of bare symbols"
 // @Success 200 {object} []string "List of observed currencies"
 // @Failure 500 {string} string "Internal server error"
 // @Router /currency/watchlist [get]
 func (s *Server) getList(w http.ResponseWriter, r *http.Request) {
 	const op = "gates.Server.getList"
-	s.log.Info("op", "connected to getList")
+	s.log.Info(op + ": connected to getList")
 
-	coins, err := s.coinSrv.GetObserveredCoinsList()
+	var coins any
+	var err error
+	if includes(r, "details") {
+		var entries []domain.WatchlistEntry
+		entries, err = s.coinSrv.GetWatchlistDetails(r.Context())
+		coins = newWatchlistEntries(entries)
+	} else {
+		coins, err = s.coinSrv.GetObserveredCoinsList(r.Context())
+	}
 	if err != nil {
 		s.log.Error(op, ": error getting observered coins: ", err)
 		http.Error(w, "Error getting observered coins", http.StatusInternalServerError)
@@ -99,8 +141,14 @@ func (s *Server) getList(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param coin query string true "Currency symbol (e.g., BTC)"
 // @Param timestamp query string true "Timestamp in Unix format"
+// @Param vs query string false "Quote currency (e.g., usd), defaults to the first configured currency"
+// @Param include query string false "Pass 'market' to also return market cap, 24h volume, 24h change and last update time"
+// @Param convert_to query string false "Fiat currency to convert the stored price to (e.g., eur), using the fx rate nearest to the price time"
+// @Param mode query string false "Lookup mode: nearest (default), at_or_before, at_or_after or interpolate (linear between neighbouring samples)"
+// @Param max_distance query string false "Maximum distance between the timestamp and a sample used, as seconds or a duration (e.g., 90s, 1h)"
 // @Success 200 {object} coinPriceTimeResponse "Price and timestamp of the requested currency"
-// @Failure 400 {string} string "Invalid input or validation error"
+// @Failure 400 {string} string "Invalid input, validation error or no fx rate for convert_to"
+// @Failure 404 {string} string "No sample within max_distance"
 // @Failure 500 {string} string "Internal server error"
 // @Router /currency/price [get]
 func (s *Server) CurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
@@ -109,9 +157,15 @@ func (s *Server) CurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
 	// Извлекаем параметры из строки запроса
 	coin := r.URL.Query().Get("coin")
 	timestampStr := r.URL.Query().Get("timestamp")
+	vs := strings.ToLower(r.URL.Query().Get("vs"))
+	if vs == "" {
+		vs = s.cfg.CoinsWatcher.Currency.Default()
+	}
+	convertTo := strings.ToLower(r.URL.Query().Get("convert_to"))
+	lookup := domain.PriceLookup{Mode: strings.ToLower(r.URL.Query().Get("mode"))}
 
 	if coin == "" || timestampStr == "" {
-		s.log.Error(op, "Missing required query parameters")
+		s.log.Error(op + ": Missing required query parameters")
 		http.Error(w, "Missing required query parameters", http.StatusBadRequest)
 		return
 	}
@@ -125,11 +179,34 @@ func (s *Server) CurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	timestamp := time.Unix(timestampInt, 0).UTC()
 
+	lookup.MaxDistance, err = parseMaxDistance(r.URL.Query().Get("max_distance"))
+	if err != nil {
+		s.log.Error(op, "Invalid max_distance format", err)
+		http.Error(w, "Invalid max_distance format", http.StatusBadRequest)
+		return
+	}
+	err = lookup.Validate()
+	if err != nil {
+		s.log.Debug(op, "invalid lookup", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Получаем цену
-	price, time, err := s.coinSrv.GetTimePrice(coin, timestamp)
+	sample, err := s.coinSrv.GetTimePrice(r.Context(), coin, vs, convertTo, timestamp, lookup)
 	if err == sql.ErrNoRows {
 		s.log.Error(op, ": error getting time price: ", err)
-		http.Error(w, "No price found for this coin, perhaps we don't track this coin or it doesn't exist?", http.StatusBadRequest)
+		http.Error(w, "No price found for this coin, perhaps we don't track this coin (or this currency) or it doesn't exist?", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, domain.ErrNoSampleInTolerance) { //цены есть, но дальше max_distance
+		s.log.Debug(op, "no sample within max distance", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, domain.ErrNoFXRate) { //курсы не записывались (fx.enabled) или такой валюты нет в fx.currencies
+		s.log.Debug(op, "no fx rate to convert price", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if err != nil {
@@ -140,9 +217,15 @@ func (s *Server) CurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Формируем ответ
 	resp := coinPriceTimeResponse{
-		Coin:      coin,
-		Timestamp: time,
-		Price:     price,
+		Coin:       coin,
+		Timestamp:  strconv.FormatInt(sample.Time.Unix(), 10), //Перевод времени в изначальный формат который передавался в запросе
+		Price:      sample.Price,
+		Currency:   sample.Currency,
+		Conversion: newConversionData(sample.Conversion),
+		Lookup:     newLookupData(sample.Match),
+	}
+	if includes(r, "market") {
+		resp.Market = newMarketData(sample)
 	}
 
 	response, err := json.Marshal(resp)
@@ -152,12 +235,109 @@ func (s *Server) CurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.log.Info(op, "Retrieved time price:", price, "for timestamp:", time)
+	s.log.Info(op, "Retrieved time price:", sample.Price, "for timestamp:", resp.Timestamp)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(response)
 }
 
+// CurrencyHistoryHandler streams the price history of a currency bucketed into intervals.
+//
+// @Summary Get Currency Price History
+// @Description Returns prices of a currency between from (inclusive) and to (exclusive), bucketed into intervals. Intervals shorter than a day are counted from the unix epoch, whole days start at midnight in tz and weeks start on Monday. The array is streamed as it is read from the database, so long ranges are not buffered in memory.
+// @Tags Currencies
+// @Produce json
+// @Param coin query string true "Currency symbol (e.g., btc)"
+// @Param from query string true "Start of the range in Unix format"
+// @Param to query string true "End of the range in Unix format"
+// @Param interval query string false "Bucket size: a number with unit s, m, h, d or w (e.g., 1m, 1h, 1d), defaults to 1h"
+// @Param agg query string false "Aggregation per bucket: last (default), avg or ohlc"
+// @Param tz query string false "IANA timezone for daily and weekly buckets (e.g., Europe/Berlin), defaults to UTC"
+// @Param vs query string false "Quote currency (e.g., usd), defaults to the first configured currency"
+// @Success 200 {array} historyPointResponse "Buckets in ascending time order, empty buckets are skipped"
+// @Failure 400 {string} string "Invalid input or validation error"
+// @Failure 500 {string} string "Internal server error"
+// @Router /currency/history [get]
+func (s *Server) CurrencyHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CurrencyHistoryHandler"
+
+	query, err := parseHistoryQuery(r, s.cfg.CoinsWatcher.Currency.Default(), "1h")
+	if err == nil && query.Aggregation == "" {
+		query.Aggregation = domain.AggregateLast
+	}
+	if err == nil {
+		err = query.Validate()
+	}
+	if err != nil {
+		s.log.Debug(op, "invalid history query", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, err := streamArray(w, func(emit func(v any) error) error {
+		return s.coinSrv.PriceHistory(r.Context(), query, func(bucket domain.PriceBucket) error {
+			return emit(newHistoryPoint(bucket, query.Aggregation))
+		})
+	})
+	if err != nil && points == 0 {
+		s.log.Error(op, "Failed to get price history", err)
+		http.Error(w, "Failed to get price history", http.StatusInternalServerError)
+		return
+	}
+	if err != nil { //ответ уже начат, клиент получит оборванный массив
+		s.log.Error(op, "price history stream interrupted after points", points, "error", err)
+		return
+	}
+	s.log.Info(op, "streamed price history points", points, "coin", query.Coin)
+}
+
+// CurrencyCandlesHandler streams OHLC candles of a currency.
+//
+// @Summary Get Currency Candles
+// @Description Returns open, high, low and close prices and the number of samples per interval between from (inclusive) and to (exclusive). Intervals shorter than a day are counted from the unix epoch, daily candles start at midnight in tz and weekly candles start on Monday in tz. Times are unix seconds and prices are JSON numbers, so the array can be passed to charting libraries as is. Intervals without samples are skipped.
+// @Tags Currencies
+// @Produce json
+// @Param coin query string true "Currency symbol (e.g., btc)"
+// @Param from query string true "Start of the range in Unix format"
+// @Param to query string true "End of the range in Unix format"
+// @Param interval query string false "Candle size: a number with unit s, m, h, d or w (e.g., 15m, 4h, 1d, 1w), defaults to 1d"
+// @Param tz query string false "IANA timezone for daily and weekly candles (e.g., America/New_York), defaults to UTC"
+// @Param vs query string false "Quote currency (e.g., usd), defaults to the first configured currency"
+// @Success 200 {array} candleResponse "Candles in ascending time order"
+// @Failure 400 {string} string "Invalid input or validation error"
+// @Failure 500 {string} string "Internal server error"
+// @Router /currency/candles [get]
+func (s *Server) CurrencyCandlesHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CurrencyCandlesHandler"
+
+	query, err := parseHistoryQuery(r, s.cfg.CoinsWatcher.Currency.Default(), "1d")
+	query.Aggregation = domain.AggregateOHLC
+	if err == nil {
+		err = query.Validate()
+	}
+	if err != nil {
+		s.log.Debug(op, "invalid candles query", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	candles, err := streamArray(w, func(emit func(v any) error) error {
+		return s.coinSrv.PriceHistory(r.Context(), query, func(bucket domain.PriceBucket) error {
+			return emit(newCandle(bucket))
+		})
+	})
+	if err != nil && candles == 0 {
+		s.log.Error(op, "Failed to get candles", err)
+		http.Error(w, "Failed to get candles", http.StatusInternalServerError)
+		return
+	}
+	if err != nil { //ответ уже начат, клиент получит оборванный массив
+		s.log.Error(op, "candles stream interrupted after candles", candles, "error", err)
+		return
+	}
+	s.log.Info(op, "streamed candles", candles, "coin", query.Coin, "tz", query.Location)
+}
+
 // DeleteCurrencyHandler handles the deletion of observed currencies.
 //
 // @Summary Delete Observed Currencies
@@ -184,11 +364,11 @@ func (s *Server) DeleteCurrencyHandler(w http.ResponseWriter, r *http.Request) {
 
 	coins := strings.Split(req.Coin, ",")
 	if len(coins) == 0 {
-		s.log.Error(op, "no coins to delete")
+		s.log.Error(op + ": no coins to delete")
 		http.Error(w, "No coins to delete", http.StatusBadRequest)
 		return
 	}
-	err = s.coinSrv.DeleteObserveredCoins(coins)
+	err = s.coinSrv.DeleteObserveredCoins(r.Context(), coins)
 	if err == storage.ErrNoRowsAffected {
 		s.log.Debug(op, "no rows affected, probably wasn't it storage: ", err)
 		http.Error(w, "Nothing happend, perhaps it wasn't in our tracking list?", http.StatusBadRequest)
@@ -204,3 +384,232 @@ func (s *Server) DeleteCurrencyHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Successfully deleted coins"))
 }
+
+// CoinListCacheHandler reports how old the cached provider coin list is.
+//
+// @Summary Get Coin List Cache Status
+// @Description Returns size and age of the coin list cache used to verify coins, per provider.
+// @Tags Providers
+// @Produce json
+// @Success 200 {object} []coinListCacheResponse "Coin list cache status per provider"
+// @Failure 500 {string} string "Internal server error"
+// @Router /provider/coins-cache [get]
+func (s *Server) CoinListCacheHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CoinListCacheHandler"
+
+	infos := s.coinSrv.CoinListCacheInfo()
+	resp := make([]coinListCacheResponse, 0, len(infos))
+	for _, info := range infos {
+		item := coinListCacheResponse{
+			Provider: info.Provider,
+			Coins:    info.Coins,
+		}
+		if !info.UpdatedAt.IsZero() {
+			age := int64(time.Since(info.UpdatedAt).Seconds())
+			item.UpdatedAt = strconv.FormatInt(info.UpdatedAt.Unix(), 10)
+			item.AgeSeconds = &age
+		}
+		resp = append(resp, item)
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		s.log.Error(op, "Failed to marshal response", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Debug(op, "coin list cache info", resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// ThrottleStatsHandler reports request throttling statistics of the providers.
+//
+// @Summary Get Provider Throttling Statistics
+// @Description Returns rate limiter, retry and error counters per provider, useful to size the API plan.
+// @Tags Providers
+// @Produce json
+// @Success 200 {object} []throttleStatsResponse "Throttling statistics per provider"
+// @Failure 500 {string} string "Internal server error"
+// @Router /provider/throttling [get]
+func (s *Server) ThrottleStatsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.ThrottleStatsHandler"
+
+	stats := s.coinSrv.ThrottleStats()
+	resp := make([]throttleStatsResponse, 0, len(stats))
+	for _, stat := range stats {
+		resp = append(resp, throttleStatsResponse{
+			Provider:              stat.Provider,
+			Requests:              stat.Requests,
+			Throttled:             stat.Throttled,
+			ThrottleWaitSeconds:   stat.ThrottleWait.Seconds(),
+			RateLimited:           stat.RateLimited,
+			ServerErrors:          stat.ServerErrors,
+			Retries:               stat.Retries,
+			Failed:                stat.Failed,
+			LastRetryAfterSeconds: stat.LastRetryAfter.Seconds(),
+		})
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		s.log.Error(op, "Failed to marshal response", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Debug(op, "throttle stats", resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// ProviderHealthHandler reports circuit breaker state of the providers.
+//
+// @Summary Get Provider Health
+// @Description Returns circuit breaker state per provider. Responds with 503 when every provider circuit is open.
+// @Tags Providers
+// @Produce json
+// @Success 200 {object} []providerHealthResponse "Circuit breaker state per provider"
+// @Failure 503 {object} []providerHealthResponse "All provider circuits are open"
+// @Failure 500 {string} string "Internal server error"
+// @Router /provider/health [get]
+func (s *Server) ProviderHealthHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.ProviderHealthHandler"
+
+	health := s.coinSrv.ProviderHealth()
+	resp := make([]providerHealthResponse, 0, len(health))
+	status := http.StatusOK
+	if len(health) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	for _, item := range health {
+		if item.State != domain.CircuitOpen {
+			status = http.StatusOK
+		}
+		resp = append(resp, providerHealthResponse{
+			Provider:    item.Provider,
+			State:       item.State,
+			Failures:    item.Failures,
+			LastError:   item.LastError,
+			LastFailure: unixString(item.LastFailure),
+			OpenedAt:    unixString(item.OpenedAt),
+			RetryAt:     unixString(item.RetryAt),
+		})
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		s.log.Error(op, "Failed to marshal response", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Debug(op, "provider health", resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// BackfillStatusHandler reports progress of the price history backfill for a coin.
+//
+// @Summary Get Backfill Status
+// @Description Returns progress of loading historical prices for a coin added to the watchlist.
+// @Tags Currencies
+// @Produce json
+// @Param coin query string true "Currency symbol (e.g., btc)"
+// @Success 200 {object} backfillStatusResponse "Backfill progress"
+// @Failure 400 {string} string "Invalid input or validation error"
+// @Failure 404 {string} string "No backfill for this coin"
+// @Failure 500 {string} string "Internal server error"
+// @Router /currency/backfill [get]
+func (s *Server) BackfillStatusHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.BackfillStatusHandler"
+
+	coin := r.URL.Query().Get("coin")
+	if coin == "" {
+		s.log.Error(op + ": Missing required query parameters")
+		http.Error(w, "Missing required query parameters", http.StatusBadRequest)
+		return
+	}
+
+	status, err := s.coinSrv.GetBackfillStatus(r.Context(), coin)
+	if err == sql.ErrNoRows {
+		s.log.Debug(op, "no backfill for coin", coin)
+		http.Error(w, "No backfill for this coin, perhaps backfill is disabled or the coin was added before?", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.log.Error(op, "Failed to get backfill status", err)
+		http.Error(w, "Failed to get backfill status", http.StatusInternalServerError)
+		return
+	}
+
+	resp := backfillStatusResponse{
+		Coin:       status.Coin,
+		Status:     status.Status,
+		Done:       status.Done,
+		Total:      status.Total,
+		Samples:    status.Samples,
+		StartedAt:  strconv.FormatInt(status.StartedAt.Unix(), 10),
+		FinishedAt: unixString(status.FinishedAt),
+		Error:      status.Error,
+	}
+	if status.Total > 0 {
+		resp.Progress = float64(status.Done) / float64(status.Total) * 100
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		s.log.Error(op, "Failed to marshal response", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Debug(op, "backfill status", resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// ScanReportHandler reports the result of the last price scan.
+//
+// @Summary Get Last Scan Result
+// @Description Returns how many quotes the last scan stored and which were skipped as stale, because the provider had not updated them since the previous scan.
+// @Tags Currencies
+// @Produce json
+// @Success 200 {object} scanReportResponse "Last scan result"
+// @Failure 500 {string} string "Internal server error"
+// @Router /currency/scan [get]
+func (s *Server) ScanReportHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.ScanReportHandler"
+
+	report := s.coinSrv.LastScan()
+	resp := scanReportResponse{
+		Stored:      report.Stored,
+		Stale:       report.Stale,
+		StaleCoins:  report.StaleCoins,
+		TotalStored: report.TotalStored,
+		TotalStale:  report.TotalStale,
+	}
+	if !report.Time.IsZero() {
+		resp.Time = strconv.FormatInt(report.Time.Unix(), 10)
+	}
+	if resp.StaleCoins == nil {
+		resp.StaleCoins = []string{}
+	}
+
+	response, err := json.Marshal(resp)
+	if err != nil {
+		s.log.Error(op, "Failed to marshal response", err)
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Debug(op, "last scan", resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
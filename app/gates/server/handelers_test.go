@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"cryptoRestTest/internal/config"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// провайдер, у которого проверка монет всегда заканчивается ошибкой verifyErr
+type verifyProvider struct {
+	domain.Provider
+	verifyErr error
+}
+
+func (p verifyProvider) VerifyCoins(ctx context.Context, coins []domain.CoinRef) (map[string]domain.WatchedCoin, error) {
+	return nil, p.verifyErr
+}
+
+func TestAddCurrencyAmbiguousCoins(t *testing.T) {
+	provider := verifyProvider{verifyErr: &domain.AmbiguousCoinsError{Candidates: map[string][]domain.KnownCoin{
+		"usdc": {{Id: "usd-coin", Symbol: "usdc", Name: "USDC"}, {Id: "bridged-usdc", Symbol: "usdc", Name: "Bridged USDC"}},
+	}}}
+	s := &Server{log: discardLog, coinSrv: domain.NewWatcher(nil, discardLog, provider, &config.Config{})}
+
+	rec := httptest.NewRecorder()
+	s.AddCurrencyHandler(rec, httptest.NewRequest(http.MethodPost, "/currency/add", strings.NewReader(`{"coins":"usdc"}`)))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type = %q", ct)
+	}
+	var resp ambiguousCoinsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body %s: %v", rec.Body, err)
+	}
+	if !strings.Contains(resp.Error, "usdc") {
+		t.Errorf("error = %q, want it to name the symbol", resp.Error)
+	}
+	want := []candidateCoin{{Id: "usd-coin", Name: "USDC"}, {Id: "bridged-usdc", Name: "Bridged USDC"}}
+	got := resp.Candidates["usdc"]
+	if len(got) != len(want) || len(resp.Candidates) != 1 {
+		t.Fatalf("candidates = %v, want usdc: %v", resp.Candidates, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("candidate %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// хранилище с фиксированным списком наблюдения и описаниями монет
+type watchlistStore struct {
+	domain.CoinsStore
+	watched  map[string]domain.WatchedCoin
+	metadata map[string]domain.CoinMetadata
+}
+
+func (s watchlistStore) GetObserveredCoinsList(ctx context.Context) (map[string]domain.WatchedCoin, error) {
+	return s.watched, nil
+}
+
+func (s watchlistStore) GetCoinMetadata(ctx context.Context, ids []string) (map[string]domain.CoinMetadata, error) {
+	return s.metadata, nil
+}
+
+func TestGetListDetails(t *testing.T) {
+	genesis := time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)
+	rank := 1
+	updated := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	store := watchlistStore{
+		watched: map[string]domain.WatchedCoin{
+			"btc":  {Id: "bitcoin"},
+			"usdc": {Id: "usd-coin", Platform: "ethereum", Contract: "0xa0b8"},
+		},
+		metadata: map[string]domain.CoinMetadata{
+			"bitcoin": {Id: "bitcoin", Name: "Bitcoin", Categories: []string{"Layer 1"}, GenesisDate: &genesis, MarketCapRank: &rank, UpdatedAt: updated},
+		},
+	}
+	s := &Server{log: discardLog, coinSrv: domain.NewWatcher(store, discardLog, nil, &config.Config{})}
+
+	rec := httptest.NewRecorder()
+	s.getList(rec, httptest.NewRequest(http.MethodGet, "/currency/watchlist?include=details", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp []watchlistEntryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body %s: %v", rec.Body, err)
+	}
+	if len(resp) != 2 || resp[0].Coin != "btc" || resp[1].Coin != "usdc" {
+		t.Fatalf("entries = %+v, want btc and usdc in order", resp)
+	}
+	btc := resp[0]
+	if btc.Id != "bitcoin" || btc.Name != "Bitcoin" || len(btc.Categories) != 1 || btc.MarketCapRank == nil || *btc.MarketCapRank != 1 {
+		t.Errorf("btc = %+v", btc)
+	}
+	if btc.GenesisDate == nil || *btc.GenesisDate != "2009-01-03" || btc.UpdatedAt != "1736467200" {
+		t.Errorf("btc dates = %v, %q", btc.GenesisDate, btc.UpdatedAt)
+	}
+	//описание ещё не загружено: монета есть, полей описания нет
+	usdc := resp[1]
+	if usdc.Id != "usd-coin" || usdc.Platform != "ethereum" || usdc.Contract != "0xa0b8" || usdc.Name != "" || usdc.UpdatedAt != "" {
+		t.Errorf("usdc = %+v", usdc)
+	}
+	if strings.Contains(rec.Body.String(), `"genesis_date":null`) {
+		t.Errorf("empty fields should be omitted: %s", rec.Body)
+	}
+}
+
+func TestGetListWithoutDetails(t *testing.T) {
+	store := watchlistStore{watched: map[string]domain.WatchedCoin{"btc": {Id: "bitcoin"}}}
+	s := &Server{log: discardLog, coinSrv: domain.NewWatcher(store, discardLog, nil, &config.Config{})}
+
+	rec := httptest.NewRecorder()
+	s.getList(rec, httptest.NewRequest(http.MethodGet, "/currency/watchlist", nil))
+
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `["btc"]` {
+		t.Errorf("response %d %s, want the bare symbols", rec.Code, rec.Body)
+	}
+}
@@ -1,12 +1,130 @@
 package server
 
 import (
+	"cryptoRestTest/domain"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/shopspring/decimal"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type addCoinsReq struct {
-	Coins string `json:"coins"`
+	Coins coinRefs `json:"coins"`
+}
+
+type coinRef struct {
+	Symbol   string `json:"symbol" example:"eth"`
+	Id       string `json:"id,omitempty" example:"ethereum"`                                         //явный id coingecko, если символ неоднозначный
+	Platform string `json:"platform,omitempty" example:"ethereum"`                                   //сеть токена, вместе с contract
+	Contract string `json:"contract,omitempty" example:"0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"` //адрес контракта токена
+}
+
+// coinRefs принимает как старый формат "btc,usdt,eth", так и список ["btc", {"symbol":"eth","id":"ethereum"}]
+type coinRefs []coinRef
+
+func (c *coinRefs) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*c = nil
+		for _, symbol := range strings.Split(str, ",") {
+			*c = append(*c, coinRef{Symbol: strings.TrimSpace(symbol)})
+		}
+		return nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		var ref coinRef //одиночный объект {"symbol":"eth","id":"ethereum"}
+		if err := json.Unmarshal(data, &ref); err != nil {
+			return fmt.Errorf("coins must be a string, an object or a list: %w", err)
+		}
+		*c = coinRefs{ref}
+		return nil
+	}
+	*c = make(coinRefs, 0, len(items))
+	for _, item := range items {
+		var ref coinRef
+		if err := json.Unmarshal(item, &ref.Symbol); err != nil {
+			if err := json.Unmarshal(item, &ref); err != nil {
+				return fmt.Errorf("invalid coin %s: %w", item, err)
+			}
+		}
+		*c = append(*c, ref)
+	}
+	return nil
+}
+
+func (c coinRefs) toDomain() []domain.CoinRef {
+	refs := make([]domain.CoinRef, 0, len(c))
+	for _, ref := range c {
+		if ref.Symbol == "" && ref.Id == "" && ref.Contract == "" {
+			continue
+		}
+		refs = append(refs, domain.CoinRef{
+			Symbol:   ref.Symbol,
+			Id:       ref.Id,
+			Platform: strings.TrimSpace(ref.Platform),
+			Contract: strings.TrimSpace(ref.Contract),
+		})
+	}
+	return refs
+}
+
+type throttleStatsResponse struct {
+	Provider              string  `json:"provider"`
+	Requests              int64   `json:"requests"`
+	Throttled             int64   `json:"throttled"`
+	ThrottleWaitSeconds   float64 `json:"throttle_wait_seconds"`
+	RateLimited           int64   `json:"rate_limited"`
+	ServerErrors          int64   `json:"server_errors"`
+	Retries               int64   `json:"retries"`
+	Failed                int64   `json:"failed"`
+	LastRetryAfterSeconds float64 `json:"last_retry_after_seconds"`
+}
+
+type scanReportResponse struct {
+	Time        string   `json:"time"`
+	Stored      int      `json:"stored"`
+	Stale       int      `json:"stale"`
+	StaleCoins  []string `json:"stale_coins" example:"btc/usd"`
+	TotalStored int64    `json:"total_stored"`
+	TotalStale  int64    `json:"total_stale"`
+}
+
+type providerHealthResponse struct {
+	Provider    string `json:"provider"`
+	State       string `json:"state" example:"closed"` //closed, open, half_open
+	Failures    int    `json:"failures"`               //ошибок подряд
+	LastError   string `json:"last_error,omitempty"`
+	LastFailure string `json:"last_failure,omitempty"`
+	OpenedAt    string `json:"opened_at,omitempty"`
+	RetryAt     string `json:"retry_at,omitempty"`
+}
+
+type backfillStatusResponse struct {
+	Coin       string  `json:"coin"`
+	Status     string  `json:"status" example:"running"` //pending, running, done, failed
+	Done       int     `json:"done"`
+	Total      int     `json:"total"`
+	Progress   float64 `json:"progress"` //в процентах
+	Samples    int64   `json:"samples"`
+	StartedAt  string  `json:"started_at"`
+	FinishedAt string  `json:"finished_at,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type candidateCoin struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ambiguousCoinsResponse struct {
+	Error      string                     `json:"error"`
+	Candidates map[string][]candidateCoin `json:"candidates"` //символ -> подходящие монеты
 }
 
 type coinPriceTimeRequest struct {
@@ -25,11 +143,288 @@ func (r *coinPriceTimeRequest) Validate() error {
 }
 
 type coinPriceTimeResponse struct {
-	Coin      string          `json:"coin"`
-	Price     decimal.Decimal `json:"price"`
-	Timestamp string          `json:"timestamp"`
+	Coin       string          `json:"coin"`
+	Price      decimal.Decimal `json:"price"`
+	Currency   string          `json:"currency"`
+	Timestamp  string          `json:"timestamp"`
+	Market     *marketData     `json:"market,omitempty"`     //только при include=market
+	Conversion *conversionData `json:"conversion,omitempty"` //только при convert_to
+	Lookup     *lookupData     `json:"lookup,omitempty"`
+}
+
+// как цена найдена относительно запрошенного времени
+type lookupData struct {
+	Mode            string  `json:"mode" example:"nearest"`
+	DistanceSeconds float64 `json:"distance_seconds" example:"42"` //от запрошенного времени до сэмпла, при интерполяции - до дальнего соседа
+	Interpolated    bool    `json:"interpolated"`
+	BeforeTimestamp string  `json:"before_timestamp,omitempty"` //unix timestamp соседей, только при интерполяции
+	AfterTimestamp  string  `json:"after_timestamp,omitempty"`
+	Tier            string  `json:"tier" example:"raw"` //уровень истории: raw, 1m, 1h или 1d
+}
+
+func newLookupData(match *domain.PriceMatch) *lookupData {
+	if match == nil {
+		return nil
+	}
+	lookup := &lookupData{
+		Mode:            match.Mode,
+		DistanceSeconds: match.Distance.Seconds(),
+		Interpolated:    match.Interpolated,
+		Tier:            match.Tier,
+	}
+	if match.Before != nil && match.After != nil {
+		lookup.BeforeTimestamp = strconv.FormatInt(match.Before.Unix(), 10)
+		lookup.AfterTimestamp = strconv.FormatInt(match.After.Unix(), 10)
+	}
+	return lookup
+}
+
+type watchlistEntryResponse struct {
+	Coin          string   `json:"coin" example:"btc"`
+	Id            string   `json:"id" example:"bitcoin"`
+	Platform      string   `json:"platform,omitempty"`
+	Contract      string   `json:"contract,omitempty"`
+	Name          string   `json:"name,omitempty" example:"Bitcoin"`
+	ImageURL      string   `json:"image_url,omitempty"`
+	Categories    []string `json:"categories,omitempty"`
+	GenesisDate   *string  `json:"genesis_date,omitempty" example:"2009-01-03"`
+	MarketCapRank *int     `json:"market_cap_rank,omitempty" example:"1"`
+	UpdatedAt     string   `json:"metadata_updated_at,omitempty"` //unix timestamp, пусто - описание ещё не загружено
+}
+
+func newWatchlistEntries(entries []domain.WatchlistEntry) []watchlistEntryResponse {
+	resp := make([]watchlistEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		item := watchlistEntryResponse{
+			Coin:     entry.Coin,
+			Id:       entry.Id,
+			Platform: entry.Platform,
+			Contract: entry.Contract,
+		}
+		if meta := entry.Metadata; meta != nil {
+			item.Name = meta.Name
+			item.ImageURL = meta.ImageURL
+			item.Categories = meta.Categories
+			item.MarketCapRank = meta.MarketCapRank
+			item.UpdatedAt = unixString(&meta.UpdatedAt)
+			if meta.GenesisDate != nil {
+				genesis := meta.GenesisDate.Format(time.DateOnly)
+				item.GenesisDate = &genesis
+			}
+		}
+		resp = append(resp, item)
+	}
+	return resp
+}
+
+type conversionData struct {
+	From          string          `json:"from" example:"usd"`
+	Rate          decimal.Decimal `json:"rate"`
+	RateTimestamp string          `json:"rate_timestamp"` //unix timestamp использованного курса
+}
+
+func newConversionData(conversion *domain.Conversion) *conversionData {
+	if conversion == nil {
+		return nil
+	}
+	return &conversionData{
+		From:          conversion.From,
+		Rate:          conversion.Rate,
+		RateTimestamp: strconv.FormatInt(conversion.RateTime.Unix(), 10),
+	}
+}
+
+type marketData struct {
+	MarketCap     *decimal.Decimal `json:"market_cap"`
+	Volume24h     *decimal.Decimal `json:"volume_24h"`
+	Change24h     *decimal.Decimal `json:"change_24h"`
+	LastUpdatedAt *string          `json:"last_updated_at"` //unix timestamp цены у провайдера
+}
+
+func newMarketData(sample domain.PriceSample) *marketData {
+	market := &marketData{
+		MarketCap: sample.MarketCap,
+		Volume24h: sample.Volume24h,
+		Change24h: sample.Change24h,
+	}
+	if sample.LastUpdated != nil {
+		lastUpdated := strconv.FormatInt(sample.LastUpdated.Unix(), 10)
+		market.LastUpdatedAt = &lastUpdated
+	}
+	return market
+}
+
+// проверяет, есть ли значение в параметре include (include=market,quotes)
+func includes(r *http.Request, value string) bool {
+	for _, include := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(include) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// точка истории: price при agg=last и agg=avg, open/high/low/close при agg=ohlc
+type historyPointResponse struct {
+	Timestamp string           `json:"timestamp" example:"1736499600"` //unix timestamp начала интервала
+	Price     *decimal.Decimal `json:"price,omitempty"`
+	Open      *decimal.Decimal `json:"open,omitempty"`
+	High      *decimal.Decimal `json:"high,omitempty"`
+	Low       *decimal.Decimal `json:"low,omitempty"`
+	Close     *decimal.Decimal `json:"close,omitempty"`
+	Samples   int64            `json:"samples" example:"60"` //сколько цен попало в интервал
+}
+
+func newHistoryPoint(bucket domain.PriceBucket, aggregation string) historyPointResponse {
+	point := historyPointResponse{
+		Timestamp: strconv.FormatInt(bucket.Time.Unix(), 10),
+		Samples:   bucket.Samples,
+	}
+	switch aggregation {
+	case domain.AggregateLast:
+		point.Price = bucket.Close
+	case domain.AggregateAvg:
+		point.Price = bucket.Avg
+	case domain.AggregateOHLC:
+		point.Open, point.High, point.Low, point.Close = bucket.Open, bucket.High, bucket.Low, bucket.Close
+	}
+	return point
+}
+
+// свеча в формате графических библиотек: время - unix timestamp числом, цены - числами
+type candleResponse struct {
+	Time  int64       `json:"time" example:"1736467200"` //начало свечи
+	Open  json.Number `json:"open" swaggertype:"number" example:"94250.5"`
+	High  json.Number `json:"high" swaggertype:"number" example:"95120"`
+	Low   json.Number `json:"low" swaggertype:"number" example:"93800.25"`
+	Close json.Number `json:"close" swaggertype:"number" example:"94990.1"`
+	Count int64       `json:"count" example:"1440"` //сколько цен попало в свечу
+}
+
+// цены отдаются json.Number, чтобы не терять точность decimal и не превращать их в строки
+func newCandle(bucket domain.PriceBucket) candleResponse {
+	number := func(d *decimal.Decimal) json.Number {
+		if d == nil {
+			return ""
+		}
+		return json.Number(d.String())
+	}
+	return candleResponse{
+		Time:  bucket.Time.Unix(),
+		Open:  number(bucket.Open),
+		High:  number(bucket.High),
+		Low:   number(bucket.Low),
+		Close: number(bucket.Close),
+		Count: bucket.Samples,
+	}
+}
+
+// общие параметры /currency/history и /currency/candles: coin, from, to, interval, agg, tz и vs
+func parseHistoryQuery(r *http.Request, defaultCurrency string, defaultInterval string) (domain.HistoryQuery, error) {
+	params := r.URL.Query()
+	query := domain.HistoryQuery{
+		Coin:        params.Get("coin"),
+		Currency:    strings.ToLower(params.Get("vs")),
+		Aggregation: strings.ToLower(params.Get("agg")),
+	}
+	if query.Currency == "" {
+		query.Currency = defaultCurrency
+	}
+	if query.Coin == "" || params.Get("from") == "" || params.Get("to") == "" {
+		return query, errors.New("missing required query parameters coin, from or to")
+	}
+
+	from, err := strconv.ParseInt(params.Get("from"), 10, 64)
+	if err != nil {
+		return query, errors.New("invalid from format, expected unix timestamp")
+	}
+	to, err := strconv.ParseInt(params.Get("to"), 10, 64)
+	if err != nil {
+		return query, errors.New("invalid to format, expected unix timestamp")
+	}
+	query.From, query.To = time.Unix(from, 0).UTC(), time.Unix(to, 0).UTC()
+
+	interval := params.Get("interval")
+	if interval == "" {
+		interval = defaultInterval
+	}
+	query.Interval, err = domain.ParseInterval(interval)
+	if err != nil {
+		return query, err
+	}
+	query.Location, err = domain.LoadTimezone(params.Get("tz"))
+	if err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// streamArray пишет JSON-массив по мере того, как read отдаёт элементы в emit, и периодически досылает его клиенту.
+// Заголовок пишется с первым элементом, поэтому ошибку до начала ответа ещё можно вернуть кодом 500.
+// Возвращает, сколько элементов отправлено
+func streamArray(w http.ResponseWriter, read func(emit func(v any) error) error) (int, error) {
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	err := read(func(v any) error {
+		item, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("["))
+		} else {
+			w.Write([]byte(","))
+		}
+		w.Write(item)
+		count++
+		if flusher != nil && count%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if count == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("["))
+	}
+	w.Write([]byte("]"))
+	return count, nil
+}
+
+// через сколько элементов потоковый ответ досылается клиенту
+const streamFlushEvery = 500
+
+// max_distance: длительность Go (90s, 1h30m) или число секунд, пусто - без ограничения
+func parseMaxDistance(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
 }
 
 type deleteCoinsReq struct {
 	Coin string `json:"coins"`
 }
+
+type coinListCacheResponse struct {
+	Provider   string `json:"provider"`
+	Coins      int    `json:"coins"`
+	UpdatedAt  string `json:"updated_at,omitempty"`  //unix timestamp, пусто если список ещё не загружен
+	AgeSeconds *int64 `json:"age_seconds,omitempty"` //возраст кэша
+}
+
+// время в unix секундах строкой, пустая строка если времени нет
+func unixString(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
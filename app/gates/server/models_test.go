@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// read, который отдаёт items, а после них возвращает failAfter
+func emitItems(items []any, failAfter error) func(emit func(v any) error) error {
+	return func(emit func(v any) error) error {
+		for _, item := range items {
+			if err := emit(item); err != nil {
+				return err
+			}
+		}
+		return failAfter
+	}
+}
+
+func TestStreamArray(t *testing.T) {
+	errRead := errors.New("read failed")
+	for _, tc := range []struct {
+		name    string
+		items   []any
+		err     error
+		body    string
+		written bool //записан ли уже заголовок ответа
+	}{
+		{name: "empty", items: nil, body: "[]", written: true},
+		{name: "single", items: []any{1}, body: "[1]", written: true},
+		{name: "several", items: []any{map[string]int{"a": 1}, "b", 2.5}, body: `[{"a":1},"b",2.5]`, written: true},
+		//до первого элемента ничего не записано, обработчик ещё может ответить ошибкой
+		{name: "error before the first item", items: nil, err: errRead, body: "", written: false},
+		//после первого элемента ответ уже ушёл, массив остаётся незакрытым, чтобы клиент увидел обрыв
+		{name: "error after items", items: []any{1, 2}, err: errRead, body: "[1,2", written: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			count, err := streamArray(rec, emitItems(tc.items, tc.err))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("err = %v, want %v", err, tc.err)
+			}
+			if count != len(tc.items) {
+				t.Errorf("count = %d, want %d", count, len(tc.items))
+			}
+			if got := rec.Body.String(); got != tc.body {
+				t.Errorf("body = %q, want %q", got, tc.body)
+			}
+			if rec.Code != http.StatusOK && tc.written {
+				t.Errorf("status = %d", rec.Code)
+			}
+			contentType := rec.Header().Get("Content-Type")
+			if tc.written != (contentType == "application/json") {
+				t.Errorf("content type = %q, header written %t", contentType, tc.written)
+			}
+		})
+	}
+}
+
+func TestStreamArrayMarshalError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	count, err := streamArray(rec, emitItems([]any{1, make(chan int)}, nil))
+	if err == nil {
+		t.Fatal("expected a marshal error")
+	}
+	if count != 1 || rec.Body.String() != "[1" {
+		t.Errorf("count %d, body %q", count, rec.Body.String())
+	}
+}
+
+func TestStreamArrayFlushes(t *testing.T) {
+	items := make([]any, streamFlushEvery+1)
+	for i := range items {
+		items[i] = i
+	}
+	rec := httptest.NewRecorder()
+	if _, err := streamArray(rec, emitItems(items, nil)); err != nil {
+		t.Fatalf("streamArray: %v", err)
+	}
+	if !rec.Flushed {
+		t.Error("long stream was never flushed")
+	}
+	if !strings.HasPrefix(rec.Body.String(), "[0,1,") || !strings.HasSuffix(rec.Body.String(), ",500]") {
+		t.Errorf("unexpected body edges: %q...%q", rec.Body.String()[:10], rec.Body.String()[rec.Body.Len()-10:])
+	}
+}
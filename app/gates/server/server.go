@@ -1,7 +1,6 @@
 package server
 
 import (
-	"context"
 	_ "cryptoRestTest/docs"
 	"cryptoRestTest/domain"
 	"cryptoRestTest/gates/storage"
@@ -13,7 +12,6 @@ import (
 
 type Server struct {
 	db      *storage.Store
-	ctx     context.Context
 	log     *slog.Logger
 	cfg     *config.Config
 	coinSrv *domain.Watcher
@@ -23,7 +21,6 @@ func NewServer(r *chi.Mux, db *storage.Store, log *slog.Logger, conf *config.Con
 	const op = "gates.Server.NewServer"
 	server := &Server{
 		db:      db,
-		ctx:     context.Background(),
 		log:     log,
 		cfg:     conf,
 		coinSrv: watcher,
@@ -33,13 +30,20 @@ func NewServer(r *chi.Mux, db *storage.Store, log *slog.Logger, conf *config.Con
 	r.Post("/currency/add", server.AddCurrencyHandler)
 	r.Delete("/currency/remove", server.DeleteCurrencyHandler)
 	r.Get("/currency/price", server.CurrencyPriceHandler)
+	r.Get("/currency/history", server.CurrencyHistoryHandler)
+	r.Get("/currency/candles", server.CurrencyCandlesHandler)
 	r.Get("/currency/watchlist", server.getList)
+	r.Get("/currency/backfill", server.BackfillStatusHandler)
+	r.Get("/currency/scan", server.ScanReportHandler)
+	r.Get("/provider/coins-cache", server.CoinListCacheHandler)
+	r.Get("/provider/throttling", server.ThrottleStatsHandler)
+	r.Get("/provider/health", server.ProviderHealthHandler)
 
 	// Настройка Swagger UI
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"), // Указываем путь к документации
 	))
 
-	server.log.Info(op, "router configured")
+	server.log.Info(op + ": router configured")
 	return server
 }
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"time"
+)
+
+func (s *Store) SaveBackfillStatus(ctx context.Context, status domain.BackfillStatus) error {
+	const op = "gates.storage.SaveBackfillStatus"
+	s.log.Debug(op, "trying to save backfill status", status)
+
+	var finishedAt sql.NullTime
+	if status.FinishedAt != nil {
+		finishedAt = nullTime(*status.FinishedAt)
+	}
+	qry, args, err := s.sq.Insert("backfill_jobs").
+		Columns("coin", "status", "done", "total", "samples", "started_at", "finished_at", "error").
+		Values(status.Coin, status.Status, status.Done, status.Total, status.Samples, status.StartedAt, finishedAt, status.Error).
+		Suffix(`ON CONFLICT (coin) DO UPDATE SET status = EXCLUDED.status, done = EXCLUDED.done, total = EXCLUDED.total,
+			samples = EXCLUDED.samples, started_at = EXCLUDED.started_at, finished_at = EXCLUDED.finished_at, error = EXCLUDED.error`).
+		ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetBackfillStatus(ctx context.Context, coin string) (domain.BackfillStatus, error) {
+	const op = "gates.storage.GetBackfillStatus"
+	s.log.Debug(op, "trying to get backfill status for coin", coin)
+
+	qry, args, err := s.sq.Select("coin", "status", "done", "total", "samples", "started_at", "finished_at", "error").
+		From("backfill_jobs").
+		Where(sq.Eq{"coin": coin}).
+		ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return domain.BackfillStatus{}, err
+	}
+
+	var r struct {
+		Coin       string       `db:"coin"`
+		Status     string       `db:"status"`
+		Done       int          `db:"done"`
+		Total      int          `db:"total"`
+		Samples    int64        `db:"samples"`
+		StartedAt  time.Time    `db:"started_at"`
+		FinishedAt sql.NullTime `db:"finished_at"`
+		Error      string       `db:"error"`
+	}
+	err = s.db.GetContext(ctx, &r, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return domain.BackfillStatus{}, err
+	}
+
+	status := domain.BackfillStatus{
+		Coin:      r.Coin,
+		Status:    r.Status,
+		Done:      r.Done,
+		Total:     r.Total,
+		Samples:   r.Samples,
+		StartedAt: r.StartedAt,
+		Error:     r.Error,
+	}
+	if r.FinishedAt.Valid {
+		status.FinishedAt = &r.FinishedAt.Time
+	}
+	return status, nil
+}
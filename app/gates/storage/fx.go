@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// AddFXRates записывает курсы валют, уже записанные точки пропускаются
+func (s *Store) AddFXRates(ctx context.Context, rates []domain.FXRate) error {
+	const op = "gates.storage.AddFXRates"
+	s.log.Debug(op, "trying to add fx rates, count", len(rates))
+
+	query := s.sq.Insert("fx_rates").
+		Columns("base", "quote", "rate", "time").
+		Suffix("ON CONFLICT DO NOTHING")
+	for _, rate := range rates {
+		query = query.Values(rate.Base, rate.Quote, rate.Rate, rate.Time)
+	}
+
+	qry, args, err := query.ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return err
+	}
+	return nil
+}
+
+// GetFXRate курс base -> quote, ближайший ко времени timestamp.
+// Если курс ни разу не записывался, возвращает domain.ErrNoFXRate
+func (s *Store) GetFXRate(ctx context.Context, base string, quote string, timestamp time.Time) (domain.FXRate, error) {
+	const op = "gates.storage.GetFXRate"
+	s.log.Debug(op+": trying to get fx rate", "base", base, "quote", quote, "time", timestamp)
+
+	columns := []string{"base", "quote", "rate", "time"}
+	key := sq.Eq{"base": base, "quote": quote}
+	qry, args, err := unionQuery(probeBefore("fx_rates", columns, key, timestamp), probeAfter("fx_rates", columns, key, timestamp))
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return domain.FXRate{}, err
+	}
+
+	var rows []fxRateRow
+	err = s.db.SelectContext(ctx, &rows, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return domain.FXRate{}, err
+	}
+	//курс выбирается так же, как цена в режиме nearest
+	before, after := neighbours(rows, timestamp, func(r fxRateRow) domain.PriceSample {
+		return domain.PriceSample{Price: r.Rate, Time: r.Time}
+	})
+	nearest, err := domain.PriceLookup{Mode: domain.LookupNearest}.Resolve(timestamp, before, after)
+	if errors.Is(err, domain.ErrNoSampleInTolerance) {
+		return domain.FXRate{}, domain.ErrNoFXRate
+	}
+	if err != nil {
+		return domain.FXRate{}, err
+	}
+	return domain.FXRate{Base: base, Quote: quote, Rate: nearest.Price, Time: nearest.Time}, nil
+}
+
+// строка fx_rates
+type fxRateRow struct {
+	Base  string          `db:"base"`
+	Quote string          `db:"quote"`
+	Rate  decimal.Decimal `db:"rate"`
+	Time  time.Time       `db:"time"`
+}
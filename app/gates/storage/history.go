@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"strings"
+	"time"
+)
+
+// сколько цен вставляется одним запросом
+const priceSamplesBatchSize = 1000
+
+// AddPriceSamples добавляет готовые цены со своим временем (например, загруженную историю).
+// Уже существующие точки пропускаются, возвращается сколько строк реально добавлено
+func (s *Store) AddPriceSamples(ctx context.Context, samples []domain.PriceSample) (int64, error) {
+	const op = "gates.storage.AddPriceSamples"
+	s.log.Debug(op, "trying to add price samples, count", len(samples))
+
+	var added int64
+	for start := 0; start < len(samples); start += priceSamplesBatchSize {
+		end := min(start+priceSamplesBatchSize, len(samples))
+
+		query := s.sq.Insert("price_history").
+			Columns("coin", "currency", "price", "time", "provider", "market_cap", "volume_24h").
+			Suffix("ON CONFLICT DO NOTHING")
+		for _, sample := range samples[start:end] {
+			query = query.Values(sample.Coin, sample.Currency, sample.Price, sample.Time, sample.Provider,
+				sample.MarketCap, sample.Volume24h)
+		}
+
+		qry, args, err := query.ToSql()
+		if err != nil {
+			s.log.Error(op, "failed to build query", err)
+			return added, err
+		}
+		rows, err := s.db.ExecContext(ctx, qry, args...)
+		if err != nil {
+			s.log.Error(op, "failed to execute query", err)
+			return added, err
+		}
+		affected, _ := rows.RowsAffected()
+		added += affected
+	}
+
+	s.log.Debug(op, "successfully added price samples", added)
+	return added, nil
+}
+
+// агрегаты интервала для способа свёртки, samples считается всегда
+func (a tierAggregates) columns(aggregation string) []string {
+	columns := []string{a.samples + " AS samples"}
+	switch aggregation {
+	case domain.AggregateLast:
+		columns = append(columns, a.close+" AS close")
+	case domain.AggregateAvg:
+		columns = append(columns, a.avg+" AS avg")
+	case domain.AggregateOHLC:
+		columns = append(columns, a.open+" AS open", a.high+" AS high", a.low+" AS low", a.close+" AS close")
+	}
+	return columns
+}
+
+// GetPriceHistory сворачивает цены монеты за [From, To) из уровня query.Tier в интервалы
+// и отдаёт их в fn по одному, по мере чтения из бд
+func (s *Store) GetPriceHistory(ctx context.Context, query domain.HistoryQuery, fn func(domain.PriceBucket) error) error {
+	const op = "gates.storage.GetPriceHistory"
+	s.log.Debug(op, "trying to get price history", query)
+
+	qry, args, err := historyQuery(query)
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return err
+	}
+
+	rows, err := s.db.QueryxContext(ctx, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return err
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var r priceBucketRow
+		err = rows.StructScan(&r)
+		if err != nil {
+			s.log.Error(op, "failed to scan bucket", err)
+			return err
+		}
+		err = fn(r.toDomain())
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		s.log.Error(op, "failed to read buckets", err)
+		return err
+	}
+	s.log.Debug(op, "price history buckets", count)
+	return nil
+}
+
+// запрос интервалов ряда. Если уровень свёрнут не до конца периода (query.TierEnd), строки уровня склеиваются
+// через UNION ALL с сырыми ценами после TierEnd в виде строк уровня: open = high = low = close = avg = price, samples = 1
+func historyQuery(query domain.HistoryQuery) (string, []interface{}, error) {
+	table, err := tierTable(query.Tier)
+	if err != nil {
+		return "", nil, err
+	}
+	key := sq.Eq{"coin": query.Coin, "currency": query.Currency}
+	if query.TierEnd.IsZero() || table == tierTables[domain.TierRaw] {
+		return sq.Select().
+			Column(bucketColumn(query)).
+			Columns(aggregatesFor(query.Tier).columns(query.Aggregation)...).
+			From(table).
+			Where(key).
+			Where(sq.GtOrEq{"time": query.From}).
+			Where(sq.Lt{"time": query.To}).
+			GroupBy("bucket").
+			OrderBy("bucket").
+			PlaceholderFormat(sq.Dollar).
+			ToSql()
+	}
+
+	rolled := sq.Select("time", "open", "high", "low", "close", "avg", "samples").
+		From(table).
+		Where(key).
+		Where(sq.GtOrEq{"time": query.From}).
+		Where(sq.Lt{"time": minTime(query.To, query.TierEnd)})
+	tail := sq.Select("time", "price AS open", "price AS high", "price AS low", "price AS close", "price AS avg", "1 AS samples").
+		From(tierTables[domain.TierRaw]).
+		Where(key).
+		Where(sq.GtOrEq{"time": maxTime(query.From, query.TierEnd)}).
+		Where(sq.Lt{"time": query.To})
+	var rows []string
+	var rowsArgs []interface{}
+	for _, part := range []sq.SelectBuilder{rolled, tail} {
+		partQry, partArgs, err := part.ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+		rows = append(rows, "("+partQry+")")
+		rowsArgs = append(rowsArgs, partArgs...)
+	}
+
+	//плейсхолдеры интервала идут в тексте раньше подзапроса, поэтому и аргументы раньше
+	qry, args, err := sq.Select().
+		Column(bucketColumn(query)).
+		Columns(rolledAggregates.columns(query.Aggregation)...).
+		From("(" + strings.Join(rows, " UNION ALL ") + ") AS history").
+		GroupBy("bucket").
+		OrderBy("bucket").
+		ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	qry, err = sq.Dollar.ReplacePlaceholders(qry)
+	if err != nil {
+		return "", nil, err
+	}
+	return qry, append(args, rowsArgs...), nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// начало интервала для строки. Короткие интервалы отсчитываются от начала unix-времени,
+// сутки и недели - по местному времени query.Location: время переводится в местное, режется по полуночи
+// (для недель - от понедельника 2000-01-03) и переводится обратно
+func bucketColumn(query domain.HistoryQuery) sq.Sqlizer {
+	interval := fmt.Sprintf("%d seconds", int64(query.Interval/time.Second))
+	if !query.Calendar() {
+		return sq.Expr("date_bin(?::interval, time, ?) AS bucket", interval, time.Unix(0, 0).UTC())
+	}
+	timezone := query.Location.String()
+	return sq.Expr("date_bin(?::interval, time AT TIME ZONE ?::text, TIMESTAMP '2000-01-03') AT TIME ZONE ?::text AS bucket",
+		interval, timezone, timezone)
+}
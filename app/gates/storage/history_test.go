@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"cryptoRestTest/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryQueryFillsTailFromRaw(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := domain.HistoryQuery{
+		Coin:        "btc",
+		Currency:    "usd",
+		From:        from,
+		To:          from.Add(48 * time.Hour),
+		Interval:    time.Hour,
+		Aggregation: domain.AggregateOHLC,
+		Location:    time.UTC,
+		Tier:        domain.TierHour,
+	}
+
+	qry, args, err := historyQuery(query)
+	if err != nil {
+		t.Fatalf("historyQuery: %v", err)
+	}
+	if strings.Contains(qry, "UNION") || !strings.Contains(qry, "FROM price_rollup_1h") {
+		t.Errorf("fully rolled up period should read only the tier: %s", qry)
+	}
+	if len(args) != 6 {
+		t.Errorf("got %d args, want 6: %v", len(args), args)
+	}
+
+	query.TierEnd = from.Add(47 * time.Hour)
+	qry, args, err = historyQuery(query)
+	if err != nil {
+		t.Fatalf("historyQuery: %v", err)
+	}
+	for _, part := range []string{"FROM price_rollup_1h", "UNION ALL", "FROM price_history", "1 AS samples", "$10"} {
+		if !strings.Contains(qry, part) {
+			t.Errorf("query has no %q: %s", part, qry)
+		}
+	}
+	if strings.Contains(qry, "?") || strings.Contains(qry, "$11") {
+		t.Errorf("placeholders are not numbered once: %s", qry)
+	}
+	//аргументы интервала, потом уровень [From, TierEnd), потом сырые цены [TierEnd, To)
+	want := []interface{}{"3600 seconds", time.Unix(0, 0).UTC(), "btc", "usd", from, query.TierEnd, "btc", "usd", query.TierEnd, query.To}
+	if len(args) != len(want) {
+		t.Fatalf("got %d args, want %d: %v", len(args), len(want), args)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("arg %d = %v, want %v", i, args[i], want[i])
+		}
+	}
+}
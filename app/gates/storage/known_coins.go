@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"time"
+)
+
+// сколько строк вставляется одним запросом (у postgres ограничение в 65535 параметров)
+const knownCoinsBatchSize = 5000
+
+// SaveKnownCoins полностью заменяет сохранённый список монет провайдера
+func (s *Store) SaveKnownCoins(ctx context.Context, coins []domain.KnownCoin) error {
+	const op = "gates.storage.SaveKnownCoins"
+	s.log.Debug(op, "trying to save known coins, count", len(coins))
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		s.log.Error(op, "failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM known_coins")
+	if err != nil {
+		s.log.Error(op, "failed to clear known coins", err)
+		return err
+	}
+
+	now := time.Now().UTC()
+	for start := 0; start < len(coins); start += knownCoinsBatchSize {
+		end := min(start+knownCoinsBatchSize, len(coins))
+
+		query := s.sq.Insert("known_coins").
+			Columns("id", "symbol", "name", "updated_at").
+			Suffix("ON CONFLICT DO NOTHING")
+		for _, coin := range coins[start:end] {
+			query = query.Values(coin.Id, coin.Symbol, coin.Name, now)
+		}
+
+		qry, args, err := query.ToSql()
+		if err != nil {
+			s.log.Error(op, "failed to build query", err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qry, args...)
+		if err != nil {
+			s.log.Error(op, "failed to execute query", err)
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		s.log.Error(op, "failed to commit transaction", err)
+		return err
+	}
+	s.log.Debug(op, "successfully saved known coins, count", len(coins))
+	return nil
+}
+
+// GetKnownCoins отдаёт сохранённый список монет и время его последнего обновления
+func (s *Store) GetKnownCoins(ctx context.Context) ([]domain.KnownCoin, time.Time, error) {
+	const op = "gates.storage.GetKnownCoins"
+	s.log.Debug(op + ": trying to get known coins")
+
+	qry, args, err := s.sq.Select("id", "symbol", "name", "updated_at").
+		From("known_coins").
+		ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return nil, time.Time{}, err
+	}
+
+	var rows []struct {
+		ID        string    `db:"id"`
+		Symbol    string    `db:"symbol"`
+		Name      string    `db:"name"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	err = s.db.SelectContext(ctx, &rows, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return nil, time.Time{}, err
+	}
+
+	coins := make([]domain.KnownCoin, 0, len(rows))
+	var updatedAt time.Time
+	for _, row := range rows {
+		coins = append(coins, domain.KnownCoin{Id: row.ID, Symbol: row.Symbol, Name: row.Name})
+		if row.UpdatedAt.After(updatedAt) {
+			updatedAt = row.UpdatedAt
+		}
+	}
+
+	s.log.Debug(op, "successfully retrieved known coins, count", len(coins))
+	return coins, updatedAt, nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"time"
+)
+
+// SaveCoinMetadata сохраняет описание монет, старое описание заменяется
+func (s *Store) SaveCoinMetadata(ctx context.Context, metadata []domain.CoinMetadata) error {
+	const op = "gates.storage.SaveCoinMetadata"
+	s.log.Debug(op, "trying to save coin metadata, count", len(metadata))
+
+	query := s.sq.Insert("coin_metadata").
+		Columns("id", "symbol", "name", "image_url", "categories", "genesis_date", "market_cap_rank", "updated_at").
+		Suffix(`ON CONFLICT (id) DO UPDATE SET symbol = EXCLUDED.symbol, name = EXCLUDED.name,
+			image_url = EXCLUDED.image_url, categories = EXCLUDED.categories, genesis_date = EXCLUDED.genesis_date,
+			market_cap_rank = EXCLUDED.market_cap_rank, updated_at = EXCLUDED.updated_at`)
+	for _, meta := range metadata {
+		categories := pq.StringArray(meta.Categories)
+		if categories == nil { //nil записался бы как NULL
+			categories = pq.StringArray{}
+		}
+		query = query.Values(meta.Id, meta.Symbol, meta.Name, meta.ImageURL, categories,
+			meta.GenesisDate, meta.MarketCapRank, meta.UpdatedAt)
+	}
+
+	qry, args, err := query.ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return err
+	}
+	return nil
+}
+
+// GetCoinMetadata описание монет по id, монеты без описания в ответ не попадают
+func (s *Store) GetCoinMetadata(ctx context.Context, ids []string) (map[string]domain.CoinMetadata, error) {
+	const op = "gates.storage.GetCoinMetadata"
+	s.log.Debug(op, "trying to get coin metadata, count", len(ids))
+
+	if len(ids) == 0 {
+		return map[string]domain.CoinMetadata{}, nil
+	}
+	qry, args, err := s.sq.Select("id", "symbol", "name", "image_url", "categories", "genesis_date", "market_cap_rank", "updated_at").
+		From("coin_metadata").
+		Where(sq.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return nil, err
+	}
+
+	var rows []struct {
+		Id            string         `db:"id"`
+		Symbol        string         `db:"symbol"`
+		Name          string         `db:"name"`
+		ImageURL      string         `db:"image_url"`
+		Categories    pq.StringArray `db:"categories"`
+		GenesisDate   sql.NullTime   `db:"genesis_date"`
+		MarketCapRank sql.NullInt64  `db:"market_cap_rank"`
+		UpdatedAt     time.Time      `db:"updated_at"`
+	}
+	err = s.db.SelectContext(ctx, &rows, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return nil, err
+	}
+
+	metadata := make(map[string]domain.CoinMetadata, len(rows))
+	for _, row := range rows {
+		meta := domain.CoinMetadata{
+			Id:         row.Id,
+			Symbol:     row.Symbol,
+			Name:       row.Name,
+			ImageURL:   row.ImageURL,
+			Categories: row.Categories,
+			UpdatedAt:  row.UpdatedAt,
+		}
+		if row.GenesisDate.Valid {
+			meta.GenesisDate = &row.GenesisDate.Time
+		}
+		if row.MarketCapRank.Valid {
+			rank := int(row.MarketCapRank.Int64)
+			meta.MarketCapRank = &rank
+		}
+		metadata[row.Id] = meta
+	}
+	return metadata, nil
+}
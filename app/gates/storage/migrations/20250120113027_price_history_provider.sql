@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS provider VARCHAR(255);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE price_history DROP COLUMN IF EXISTS provider;
+-- +goose StatementEnd
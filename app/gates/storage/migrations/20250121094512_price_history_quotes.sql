@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS quotes JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE price_history DROP COLUMN IF EXISTS quotes;
+-- +goose StatementEnd
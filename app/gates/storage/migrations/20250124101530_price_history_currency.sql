@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose ENVSUB ON
+-- +goose StatementBegin
+-- до этой миграции цены хранились в одной валюте - coins_watcher.currency, её передаёт main через MIGRATIONS_CURRENCY
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS currency VARCHAR(16) NOT NULL DEFAULT '${MIGRATIONS_CURRENCY:-usd}';
+ALTER TABLE price_history DROP CONSTRAINT IF EXISTS price_history_pkey;
+ALTER TABLE price_history ADD PRIMARY KEY (coin, currency, time);
+-- +goose StatementEnd
+-- +goose ENVSUB OFF
+
+-- +goose Down
+-- +goose ENVSUB ON
+-- +goose StatementBegin
+-- в старой схеме у монеты одна цена на момент времени, остаются только цены в основной валюте
+DELETE FROM price_history WHERE currency <> '${MIGRATIONS_CURRENCY:-usd}';
+ALTER TABLE price_history DROP CONSTRAINT IF EXISTS price_history_pkey;
+ALTER TABLE price_history ADD PRIMARY KEY (coin, time);
+ALTER TABLE price_history DROP COLUMN IF EXISTS currency;
+-- +goose StatementEnd
+-- +goose ENVSUB OFF
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE price_history
+    ADD COLUMN IF NOT EXISTS market_cap NUMERIC,
+    ADD COLUMN IF NOT EXISTS volume_24h NUMERIC,
+    ADD COLUMN IF NOT EXISTS change_24h NUMERIC,
+    ADD COLUMN IF NOT EXISTS last_updated_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE price_history
+    DROP COLUMN IF EXISTS market_cap,
+    DROP COLUMN IF EXISTS volume_24h,
+    DROP COLUMN IF EXISTS change_24h,
+    DROP COLUMN IF EXISTS last_updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE observered_coins
+    ADD COLUMN IF NOT EXISTS platform VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS contract_address VARCHAR(255) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE observered_coins
+    DROP COLUMN IF EXISTS contract_address,
+    DROP COLUMN IF EXISTS platform;
+-- +goose StatementEnd
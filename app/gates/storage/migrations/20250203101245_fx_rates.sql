@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS fx_rates(
+    base VARCHAR(16) NOT NULL,
+    quote VARCHAR(16) NOT NULL,
+    rate NUMERIC NOT NULL,
+    time TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (base, quote, time)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS fx_rates;
+-- +goose StatementEnd
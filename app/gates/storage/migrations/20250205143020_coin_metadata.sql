@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS coin_metadata(
+    id VARCHAR(255) PRIMARY KEY,
+    symbol VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    image_url TEXT NOT NULL DEFAULT '',
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    genesis_date DATE,
+    market_cap_rank INTEGER,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS coin_metadata;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- свёрнутая история: строка - интервал, время - его начало. avg и samples нужны, чтобы сворачивать дальше
+CREATE TABLE IF NOT EXISTS price_rollup_1m(
+    coin VARCHAR(255) NOT NULL,
+    currency VARCHAR(16) NOT NULL,
+    time TIMESTAMP WITH TIME ZONE NOT NULL,
+    open NUMERIC NOT NULL,
+    high NUMERIC NOT NULL,
+    low NUMERIC NOT NULL,
+    close NUMERIC NOT NULL,
+    avg NUMERIC NOT NULL,
+    samples BIGINT NOT NULL,
+    PRIMARY KEY (coin, currency, time)
+);
+CREATE TABLE IF NOT EXISTS price_rollup_1h (LIKE price_rollup_1m INCLUDING ALL);
+CREATE TABLE IF NOT EXISTS price_rollup_1d (LIKE price_rollup_1m INCLUDING ALL);
+-- свёртка и очистка идут по времени сразу по всем монетам
+CREATE INDEX IF NOT EXISTS price_history_time_idx ON price_history (time);
+CREATE INDEX IF NOT EXISTS price_rollup_1m_time_idx ON price_rollup_1m (time);
+CREATE INDEX IF NOT EXISTS price_rollup_1h_time_idx ON price_rollup_1h (time);
+CREATE INDEX IF NOT EXISTS price_rollup_1d_time_idx ON price_rollup_1d (time);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS price_history_time_idx;
+DROP TABLE IF EXISTS price_rollup_1d;
+DROP TABLE IF EXISTS price_rollup_1h;
+DROP TABLE IF EXISTS price_rollup_1m;
+-- +goose StatementEnd
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"cryptoRestTest/domain"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/bool64/sqluct"
@@ -19,16 +22,94 @@ type Store struct {
 
 var ErrNoRowsAffected = errors.New("no rows affected")
 
-// Функция для вычисления абсолютной разницы во времени
-func absDuration(t1, t2 time.Time) time.Duration {
-	if t1.Before(t2) {
-		return t2.Sub(t1)
+// сырые котировки провайдеров сохраняются в jsonb, пустые - как NULL
+func marshalQuotes(quotes map[string]decimal.Decimal) (sql.NullString, error) {
+	if len(quotes) == 0 {
+		return sql.NullString{}, nil
 	}
-	return t1.Sub(t2)
+	raw, err := json.Marshal(quotes)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+// нулевое время сохраняется как NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+var priceSampleColumns = []string{"coin", "currency", "price", "time", "provider",
+	"market_cap", "volume_24h", "change_24h", "last_updated_at"}
+
+// свёрнутый интервал как цена: цена открытия на начало интервала, рыночных данных нет
+var rollupSampleColumns = []string{"coin", "currency", "open AS price", "time", "NULL AS provider",
+	"NULL AS market_cap", "NULL AS volume_24h", "NULL AS change_24h", "NULL AS last_updated_at"}
+
+// строка price_history
+type priceSampleRow struct {
+	Coin        string              `db:"coin"`
+	Currency    string              `db:"currency"`
+	Price       decimal.Decimal     `db:"price"`
+	Time        time.Time           `db:"time"`
+	Provider    sql.NullString      `db:"provider"`
+	MarketCap   decimal.NullDecimal `db:"market_cap"`
+	Volume24h   decimal.NullDecimal `db:"volume_24h"`
+	Change24h   decimal.NullDecimal `db:"change_24h"`
+	LastUpdated sql.NullTime        `db:"last_updated_at"`
+}
+
+func (r priceSampleRow) toDomain() domain.PriceSample {
+	sample := domain.PriceSample{
+		Coin:      r.Coin,
+		Currency:  r.Currency,
+		Price:     r.Price,
+		Time:      r.Time,
+		Provider:  r.Provider.String,
+		MarketCap: nullDecimalPtr(r.MarketCap),
+		Volume24h: nullDecimalPtr(r.Volume24h),
+		Change24h: nullDecimalPtr(r.Change24h),
+	}
+	if r.LastUpdated.Valid {
+		sample.LastUpdated = &r.LastUpdated.Time
+	}
+	return sample
+}
+
+func nullDecimalPtr(d decimal.NullDecimal) *decimal.Decimal {
+	if !d.Valid {
+		return nil
+	}
+	return &d.Decimal
+}
+
+// строка свёрнутой истории, незапрошенные агрегаты остаются пустыми
+type priceBucketRow struct {
+	Time    time.Time           `db:"bucket"`
+	Samples int64               `db:"samples"`
+	Open    decimal.NullDecimal `db:"open"`
+	High    decimal.NullDecimal `db:"high"`
+	Low     decimal.NullDecimal `db:"low"`
+	Close   decimal.NullDecimal `db:"close"`
+	Avg     decimal.NullDecimal `db:"avg"`
 }
 
-// структура для получения цены\времени
-type priceTime struct {
-	Price decimal.Decimal `db:"price"`
-	Time  time.Time       `db:"time"`
+func (r priceBucketRow) toDomain() domain.PriceBucket {
+	return domain.PriceBucket{
+		Time:    r.Time.UTC(),
+		Open:    nullDecimalPtr(r.Open),
+		High:    nullDecimalPtr(r.High),
+		Low:     nullDecimalPtr(r.Low),
+		Close:   nullDecimalPtr(r.Close),
+		Avg:     nullDecimalPtr(r.Avg),
+		Samples: r.Samples,
+	}
+}
+
+// время сэмпла: когда провайдер обновил котировку, а если он этого не сообщил - время записи
+func sampleTime(coin domain.Coin) time.Time {
+	if coin.LastUpdated.IsZero() {
+		return time.Now().UTC()
+	}
+	return coin.LastUpdated.UTC()
 }
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"cryptoRestTest/domain"
+	sq "github.com/Masterminds/squirrel"
+	"strings"
+	"time"
+)
+
+// Соседи момента timestamp ищутся пробами по индексу (key..., time): последняя строка не позже timestamp
+// и первая строка не раньше него. Каждая проба читает одну запись индекса, поэтому запрос не замедляется
+// с ростом истории, в отличие от сортировки всех строк по расстоянию до timestamp.
+// При точном попадании обе пробы находят одну и ту же строку, выбор между соседями делает domain.PriceLookup
+
+// последняя строка не позже timestamp
+func probeBefore(table string, columns []string, key sq.Eq, timestamp time.Time) sq.SelectBuilder {
+	return sq.Select(columns...).
+		From(table).
+		Where(key).
+		Where(sq.LtOrEq{"time": timestamp}).
+		OrderBy("time DESC").
+		Limit(1)
+}
+
+// первая строка не раньше timestamp
+func probeAfter(table string, columns []string, key sq.Eq, timestamp time.Time) sq.SelectBuilder {
+	return sq.Select(columns...).
+		From(table).
+		Where(key).
+		Where(sq.GtOrEq{"time": timestamp}).
+		OrderBy("time ASC").
+		Limit(1)
+}
+
+// склеивает пробы через UNION ALL: squirrel не умеет UNION, поэтому плейсхолдеры нумеруются уже после склейки
+func unionQuery(probes ...sq.SelectBuilder) (string, []interface{}, error) {
+	parts := make([]string, 0, len(probes))
+	var args []interface{}
+	for _, probe := range probes {
+		qry, probeArgs, err := probe.ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "("+qry+")")
+		args = append(args, probeArgs...)
+	}
+	qry, err := sq.Dollar.ReplacePlaceholders(strings.Join(parts, " UNION ALL "))
+	if err != nil {
+		return "", nil, err
+	}
+	return qry, args, nil
+}
+
+// раскладывает строки проб на соседей timestamp для domain.PriceLookup.Resolve
+func neighbours[T any](rows []T, timestamp time.Time, toSample func(T) domain.PriceSample) (before, after *domain.PriceSample) {
+	for _, row := range rows {
+		sample := toSample(row)
+		if !sample.Time.After(timestamp) {
+			before = &sample
+		}
+		if !sample.Time.Before(timestamp) {
+			after = &sample
+		}
+	}
+	return before, after
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"cryptoRestTest/domain"
+	"testing"
+	"time"
+)
+
+func TestNeighbours(t *testing.T) {
+	at := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	toSample := func(at time.Time) domain.PriceSample { return domain.PriceSample{Time: at} }
+
+	for _, tc := range []struct {
+		name          string
+		rows          []time.Time
+		before, after time.Time //нулевое время - соседа нет
+	}{
+		{name: "both sides", rows: []time.Time{at.Add(-time.Minute), at.Add(time.Hour)}, before: at.Add(-time.Minute), after: at.Add(time.Hour)},
+		{name: "exact hit is both neighbours", rows: []time.Time{at, at}, before: at, after: at},
+		{name: "only earlier", rows: []time.Time{at.Add(-time.Minute)}, before: at.Add(-time.Minute)},
+		{name: "only later", rows: []time.Time{at.Add(time.Minute)}, after: at.Add(time.Minute)},
+		{name: "no rows"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before, after := neighbours(tc.rows, at, toSample)
+			for _, side := range []struct {
+				name string
+				got  *domain.PriceSample
+				want time.Time
+			}{{"before", before, tc.before}, {"after", after, tc.after}} {
+				if side.want.IsZero() != (side.got == nil) || (side.got != nil && !side.got.Time.Equal(side.want)) {
+					t.Errorf("%s = %v, want %s", side.name, side.got, side.want)
+				}
+			}
+		})
+	}
+}
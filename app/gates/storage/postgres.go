@@ -3,10 +3,10 @@ package storage
 import (
 	"context"
 	"cryptoRestTest/domain"
+	"database/sql"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/bool64/sqluct"
 	"github.com/jmoiron/sqlx"
-	"github.com/shopspring/decimal"
 	"log/slog"
 	"time"
 )
@@ -20,16 +20,16 @@ func NewDB(db *sqlx.DB, log *slog.Logger) *Store {
 	}
 }
 
-func (s *Store) AddObserveredCoins(ctx context.Context, coins map[string]string) error {
+func (s *Store) AddObserveredCoins(ctx context.Context, coins map[string]domain.WatchedCoin) error {
 	const op = "gates.storage.AddObserveredCoins"
 	s.log.Debug(op, "trying to add coins:", coins)
 
 	query := s.sq.Insert("observered_coins").
-		Columns("coin", "id").
+		Columns("coin", "id", "platform", "contract_address").
 		Suffix("ON CONFLICT DO NOTHING")
 
-	for coin, id := range coins {
-		query = query.Values(coin, id)
+	for coin, watched := range coins {
+		query = query.Values(coin, watched.Id, watched.Platform, watched.Contract)
 	}
 
 	qry, args, err := query.ToSql()
@@ -82,11 +82,11 @@ func (s *Store) DeleteObserveredCoins(ctx context.Context, coins []string) error
 	return nil
 }
 
-func (s *Store) GetObserveredCoinsList(ctx context.Context) (map[string]string, error) {
+func (s *Store) GetObserveredCoinsList(ctx context.Context) (map[string]domain.WatchedCoin, error) {
 	const op = "gates.storage.GetObserveredCoinsList"
-	s.log.Debug(op, "trying to get observered coins list")
+	s.log.Debug(op + ": trying to get observered coins list")
 
-	query := s.sq.Select("coin", "id").
+	query := s.sq.Select("coin", "id", "platform", "contract_address").
 		From("observered_coins")
 	qry, args, err := query.ToSql()
 	s.log.Debug(op, "query: ", qry, "args: ", args)
@@ -96,8 +96,10 @@ func (s *Store) GetObserveredCoinsList(ctx context.Context) (map[string]string,
 	}
 
 	type coinRow struct {
-		Coin string `db:"coin"`
-		ID   string `db:"id"`
+		Coin     string `db:"coin"`
+		ID       string `db:"id"`
+		Platform string `db:"platform"`
+		Contract string `db:"contract_address"`
 	}
 
 	var rows []coinRow
@@ -108,26 +110,33 @@ func (s *Store) GetObserveredCoinsList(ctx context.Context) (map[string]string,
 	}
 
 	// Перегоняем в мапу
-	coins := make(map[string]string, len(rows))
+	coins := make(map[string]domain.WatchedCoin, len(rows))
 	for _, row := range rows {
-		coins[row.Coin] = row.ID
+		coins[row.Coin] = domain.WatchedCoin{Id: row.ID, Platform: row.Platform, Contract: row.Contract}
 	}
 
-	s.log.Debug(op, "successfully retrieved observered coins list")
+	s.log.Debug(op + ": successfully retrieved observered coins list")
 	return coins, nil
 }
 
 func (s *Store) AddCoinsPrices(ctx context.Context, coins []domain.Coin) error {
 	const op = "gates.storage.AddCoinsPrices"
-	s.log.Debug(op, "trying to add coin prices")
+	s.log.Debug(op + ": trying to add coin prices")
 
 	// Начинаем построение запроса
 	query := s.sq.Insert("price_history").
-		Columns("coin", "price", "time").
+		Columns("coin", "currency", "price", "time", "provider", "quotes",
+			"market_cap", "volume_24h", "change_24h", "last_updated_at").
 		Suffix("ON CONFLICT DO NOTHING")
 
 	for _, coin := range coins {
-		query = query.Values(coin.Name, coin.Price, time.Now().UTC())
+		quotes, err := marshalQuotes(coin.Quotes)
+		if err != nil {
+			s.log.Error(op, "failed to marshal quotes", err)
+			return err
+		}
+		query = query.Values(coin.Name, coin.Currency, coin.Price, sampleTime(coin), coin.Provider, quotes,
+			coin.MarketCap, coin.Volume24h, coin.Change24h, nullTime(coin.LastUpdated))
 	}
 
 	// Генерируем SQL-запрос
@@ -144,50 +153,66 @@ func (s *Store) AddCoinsPrices(ctx context.Context, coins []domain.Coin) error {
 		return err
 	}
 
-	// Проверяем, были ли затронуты строки
-	if rowsAffected, _ := rows.RowsAffected(); rowsAffected == 0 {
-		s.log.Error(op, "no rows affected")
-		return ErrNoRowsAffected
+	// время сэмпла берётся у провайдера, поэтому повтор той же котировки (например после рестарта) просто пропускается
+	if rowsAffected, _ := rows.RowsAffected(); rowsAffected < int64(len(coins)) {
+		s.log.Debug(op, "samples already stored", int64(len(coins))-rowsAffected)
 	}
 
-	s.log.Debug(op, "successfully added coin prices")
+	s.log.Debug(op + ": successfully added coin prices")
 	return nil
 }
 
-func (s *Store) GetPrice(ctx context.Context, coin string, timestamp time.Time) (decimal.Decimal, time.Time, error) {
+// GetPrice цена монеты на момент timestamp из уровня lookup.Tier. Пробами по индексу читаются только соседи, нужные режиму lookup,
+// выбор и интерполяцию делает lookup.Resolve. Если у монеты нет ни одного нужного соседа - sql.ErrNoRows
+func (s *Store) GetPrice(ctx context.Context, coin string, currency string, timestamp time.Time, lookup domain.PriceLookup) (domain.PriceSample, error) {
 	const op = "gates.storage.GetPrice"
-	s.log.Debug(op, "trying to get price for coin", "coin", coin, "time", timestamp)
+	s.log.Debug(op+": trying to get price for coin", "coin", coin, "currency", currency, "time", timestamp, "mode", lookup.Mode)
 
-	query := s.sq.Select("price, time").
-		From("price_history").
-		Where(sq.Eq{"coin": coin}).
-		OrderBy("ABS(EXTRACT(EPOCH FROM (time - ?)))"). // Используем значение времени для сортировки
-		Limit(1)
-
-	qry, args, err := query.ToSql()
+	table, err := tierTable(lookup.Tier)
+	if err != nil {
+		return domain.PriceSample{}, err
+	}
+	columns := priceSampleColumns
+	if table != tierTables[domain.TierRaw] {
+		columns = rollupSampleColumns
+	}
+	key := sq.Eq{"coin": coin, "currency": currency}
+	var probes []sq.SelectBuilder
+	if lookup.NeedsBefore() {
+		probes = append(probes, probeBefore(table, columns, key, timestamp))
+	}
+	if lookup.NeedsAfter() {
+		probes = append(probes, probeAfter(table, columns, key, timestamp))
+	}
+	qry, args, err := unionQuery(probes...)
 	s.log.Debug(op, "query: ", qry, "args: ", args)
 	if err != nil {
 		s.log.Error(op, "failed to build query", err)
-		return decimal.Zero, time.Time{}, err
+		return domain.PriceSample{}, err
 	}
 
-	// Порядок аргументов: сначала coin, затем timestamp
-	args = append(args, timestamp)
-
-	var r struct {
-		Price decimal.Decimal `db:"price"`
-		Time  time.Time       `db:"time"`
-	}
-	err = s.db.GetContext(ctx, &r, qry, args...)
+	var rows []priceSampleRow
+	err = s.db.SelectContext(ctx, &rows, qry, args...)
 	if err != nil {
 		s.log.Error(op, "failed to execute query", err)
-		return decimal.Zero, time.Time{}, err
+		return domain.PriceSample{}, err
+	}
+	if len(rows) == 0 {
+		s.log.Debug(op, "no price for coin", coin, "currency", currency)
+		return domain.PriceSample{}, sql.ErrNoRows
+	}
+
+	before, after := neighbours(rows, timestamp, priceSampleRow.toDomain)
+	sample, err := lookup.Resolve(timestamp, before, after)
+	if err != nil {
+		s.log.Debug(op, "no price within lookup", err)
+		return domain.PriceSample{}, err
 	}
 
-	s.log.Debug(op, "successfully retrieved price",
+	s.log.Debug(op+": successfully retrieved price",
 		"coin", coin,
 		"request_timestamp", timestamp,
-		"found_timestamp", r.Time,
-		"price", r.Price)
-	return r.Price, r.Time, nil
+		"found_timestamp", sample.Time,
+		"price", sample.Price)
+	return sample, nil
 }
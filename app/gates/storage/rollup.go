@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"cryptoRestTest/domain"
+	"database/sql"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"time"
+)
+
+// таблица каждого уровня истории
+var tierTables = map[string]string{
+	domain.TierRaw:    "price_history",
+	domain.TierMinute: "price_rollup_1m",
+	domain.TierHour:   "price_rollup_1h",
+	domain.TierDay:    "price_rollup_1d",
+}
+
+// агрегаты интервала: из сырых цен или из строк более подробного уровня
+type tierAggregates struct {
+	open, high, low, close, avg, samples string
+}
+
+var (
+	rawAggregates = tierAggregates{
+		open:    "(array_agg(price ORDER BY time))[1]",
+		high:    "MAX(price)",
+		low:     "MIN(price)",
+		close:   "(array_agg(price ORDER BY time DESC))[1]",
+		avg:     "AVG(price)",
+		samples: "COUNT(*)",
+	}
+	rolledAggregates = tierAggregates{
+		open:    "(array_agg(open ORDER BY time))[1]",
+		high:    "MAX(high)",
+		low:     "MIN(low)",
+		close:   "(array_agg(close ORDER BY time DESC))[1]",
+		avg:     "SUM(avg * samples) / SUM(samples)",
+		samples: "SUM(samples)",
+	}
+)
+
+func aggregatesFor(tier string) tierAggregates {
+	if tier == "" || tier == domain.TierRaw {
+		return rawAggregates
+	}
+	return rolledAggregates
+}
+
+// таблица уровня, пустой уровень - сырые цены
+func tierTable(tier string) (string, error) {
+	if tier == "" {
+		tier = domain.TierRaw
+	}
+	table, ok := tierTables[tier]
+	if !ok {
+		return "", fmt.Errorf("unknown history tier: %s", tier)
+	}
+	return table, nil
+}
+
+// RollupPrices пересчитывает интервалы уровня tier за [from, to) из его исходного уровня.
+// Уже свёрнутые интервалы перезаписываются, нулевой from - с начала истории
+func (s *Store) RollupPrices(ctx context.Context, tier domain.RollupTier, from, to time.Time) (int64, error) {
+	const op = "gates.storage.RollupPrices"
+	s.log.Debug(op, "trying to roll up tier", tier.Name, "from", from, "to", to)
+
+	target, err := tierTable(tier.Name)
+	if err != nil {
+		return 0, err
+	}
+	source, err := tierTable(tier.Source)
+	if err != nil {
+		return 0, err
+	}
+
+	agg := aggregatesFor(tier.Source)
+	query := sq.Select("coin", "currency").
+		Column(sq.Expr("date_bin(?::interval, time, ?) AS bucket", fmt.Sprintf("%d seconds", int64(tier.Size/time.Second)), time.Unix(0, 0).UTC())).
+		Columns(agg.open, agg.high, agg.low, agg.close, agg.avg, agg.samples).
+		From(source).
+		Where(sq.Lt{"time": to}).
+		GroupBy("coin", "currency", "bucket")
+	if !from.IsZero() {
+		query = query.Where(sq.GtOrEq{"time": from})
+	}
+
+	qry, args, err := s.sq.Insert(target).
+		Columns("coin", "currency", "time", "open", "high", "low", "close", "avg", "samples").
+		Select(query).
+		Suffix(`ON CONFLICT (coin, currency, time) DO UPDATE SET open = EXCLUDED.open, high = EXCLUDED.high,
+			low = EXCLUDED.low, close = EXCLUDED.close, avg = EXCLUDED.avg, samples = EXCLUDED.samples`).
+		ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return 0, err
+	}
+	rows, _ := res.RowsAffected()
+	return rows, nil
+}
+
+// LatestHistoryTime время последней строки уровня по всем монетам, нулевое - уровень пуст
+func (s *Store) LatestHistoryTime(ctx context.Context, tier string) (time.Time, error) {
+	const op = "gates.storage.LatestHistoryTime"
+
+	table, err := tierTable(tier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	qry, args, err := s.sq.Select("MAX(time)").From(table).ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return time.Time{}, err
+	}
+	var latest sql.NullTime
+	err = s.db.GetContext(ctx, &latest, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return time.Time{}, err
+	}
+	return latest.Time, nil
+}
+
+// DeleteHistoryBefore удаляет строки уровня раньше before
+func (s *Store) DeleteHistoryBefore(ctx context.Context, tier string, before time.Time) (int64, error) {
+	const op = "gates.storage.DeleteHistoryBefore"
+
+	table, err := tierTable(tier)
+	if err != nil {
+		return 0, err
+	}
+	qry, args, err := s.sq.Delete(table).Where(sq.Lt{"time": before}).ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return 0, err
+	}
+	deleted, _ := res.RowsAffected()
+	return deleted, nil
+}
+
+// EarliestHistoryTime время первой строки уровня по всем монетам, нулевое - уровень пуст
+func (s *Store) EarliestHistoryTime(ctx context.Context, tier string) (time.Time, error) {
+	const op = "gates.storage.EarliestHistoryTime"
+
+	table, err := tierTable(tier)
+	if err != nil {
+		return time.Time{}, err
+	}
+	qry, args, err := s.sq.Select("MIN(time)").From(table).ToSql()
+	if err != nil {
+		s.log.Error(op, "failed to build query", err)
+		return time.Time{}, err
+	}
+	var earliest sql.NullTime
+	err = s.db.GetContext(ctx, &earliest, qry, args...)
+	if err != nil {
+		s.log.Error(op, "failed to execute query", err)
+		return time.Time{}, err
+	}
+	return earliest.Time, nil
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
 	"log"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -24,20 +30,226 @@ type Log struct {
 	FilePath string `yaml:"logger_file_path"`
 }
 
+type Backfill struct {
+	Enabled      bool `yaml:"enabled"`
+	LookbackDays int  `yaml:"lookback_days" env-default:"90"`
+	WindowDays   int  `yaml:"window_days" env-default:"30"` //период одного запроса истории
+}
+
+type Metadata struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval" env-default:"24h"` //как часто обновлять описание монет
+}
+
 type CoinsWatcher struct {
 	Cooldown time.Duration `yaml:"cooldown" default:"60"`
-	Currency string        `yaml:"currency" default:"USD"`
+	Currency Currencies    `yaml:"currency" env-default:"usd"`
 	Timeout  time.Duration `yaml:"timeout" default:"10"`
+	Backfill Backfill      `yaml:"backfill"`
+	Metadata Metadata      `yaml:"metadata"`
 	//CooldownInt int `yaml:"cooldown" default:"60"`
 	//TimeoutInt  int `yaml:"timeout" default:"10"`
 }
 
+const (
+	PlanPublic = "public"
+	PlanDemo   = "demo"
+	PlanPro    = "pro"
+)
+
+type CoinGecko struct {
+	BaseURL      string        `yaml:"base_url"` //пусто - адрес по тарифу
+	CoinsListTTL time.Duration `yaml:"coins_list_ttl" env-default:"1h"`
+
+	Plan       string `yaml:"plan" env:"COINGECKO_PLAN" env-default:"public"` //public, demo, pro
+	APIKey     Secret `yaml:"api_key" env:"COINGECKO_API_KEY"`                //лучше через переменную окружения, чем в файле конфига
+	APIKeyFile string `yaml:"api_key_file" env:"COINGECKO_API_KEY_FILE"`      //файл с ключом, например docker secret
+
+	CallsPerMinute int           `yaml:"calls_per_minute"` //0 - по тарифу, меньше нуля - без ограничения
+	Burst          int           `yaml:"burst"`            //0 - по тарифу
+	MaxRetries     int           `yaml:"max_retries" env-default:"5"`
+	Backoff        time.Duration `yaml:"backoff" env-default:"1s"` //первая задержка, дальше удваивается
+
+	PriceChunkSize int `yaml:"price_chunk_size" env-default:"100"` //id монет в одном запросе цен
+	PriceWorkers   int `yaml:"price_workers" env-default:"4"`      //сколько пачек запрашивается одновременно
+}
+
+// лимиты запросов по умолчанию для тарифов coingecko
+var planLimits = map[string]struct{ callsPerMinute, burst int }{
+	PlanPublic: {callsPerMinute: 10, burst: 3},
+	PlanDemo:   {callsPerMinute: 30, burst: 5},
+	PlanPro:    {callsPerMinute: 500, burst: 20},
+}
+
+// applyPlan читает ключ из файла и подставляет лимиты тарифа, если они не заданы явно
+func (c *CoinGecko) applyPlan() error {
+	c.Plan = strings.ToLower(c.Plan)
+	limits, ok := planLimits[c.Plan]
+	if !ok {
+		return fmt.Errorf("unknown coingecko plan: %s", c.Plan)
+	}
+
+	if c.APIKey == "" && c.APIKeyFile != "" {
+		key, err := os.ReadFile(c.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("cannot read coingecko api key file: %w", err)
+		}
+		c.APIKey = Secret(strings.TrimSpace(string(key)))
+	}
+	if c.Plan != PlanPublic && c.APIKey == "" {
+		return fmt.Errorf("coingecko plan %s requires an api key", c.Plan)
+	}
+
+	if c.CallsPerMinute == 0 {
+		c.CallsPerMinute = limits.callsPerMinute
+	}
+	if c.Burst == 0 {
+		c.Burst = limits.burst
+	}
+	return nil
+}
+
+// Secret строка, которая не попадает в логи: slog и fmt видят вместо неё заглушку
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Stream подписка на тикеры биржи по websocket (формат Binance)
+type Stream struct {
+	URL              string        `yaml:"url" env-default:"wss://stream.binance.com:9443/ws"`
+	QuoteAsset       string        `yaml:"quote_asset" env-default:"usdt"` //пара на бирже: символ монеты + quote_asset
+	Currency         string        `yaml:"currency" env-default:"usd"`     //валюта, в которой сохраняются цены пары
+	FlushInterval    time.Duration `yaml:"flush_interval" env-default:"5s"`
+	ChangeThreshold  float64       `yaml:"change_threshold" env-default:"0.5"` //в процентах от последней записанной цены, 0 - только по интервалу
+	MaxAge           time.Duration `yaml:"max_age" env-default:"1m"`           //более старые котировки считаются устаревшими
+	ReconnectBackoff time.Duration `yaml:"reconnect_backoff" env-default:"1s"` //первая задержка, дальше удваивается
+	MaxBackoff       time.Duration `yaml:"max_backoff" env-default:"1m"`
+}
+
+// FX курсы фиатных валют для пересчёта сохранённых цен при чтении (convert_to)
+type FX struct {
+	Enabled    bool          `yaml:"enabled"`
+	Base       string        `yaml:"base" env-default:"usd"`               //курсы хранятся относительно этой валюты
+	Currencies Currencies    `yaml:"currencies" env-default:"eur,gbp,jpy"` //какие курсы записывать
+	Interval   time.Duration `yaml:"interval" env-default:"1h"`
+}
+
+// Replay провайдер, который проигрывает цены из файла вместо похода в сеть
+type Replay struct {
+	File     string  `yaml:"file" env:"REPLAY_FILE"`
+	Format   string  `yaml:"format"`                     //csv, jsonl, пусто - по расширению файла
+	Speed    float64 `yaml:"speed" env-default:"1"`      //1 - реальное время, 60 - минута файла за секунду, 0 - шаг файла на каждый скан
+	Loop     bool    `yaml:"loop"`                       //после конца файла начать сначала, время продолжает расти
+	Currency string  `yaml:"currency" env-default:"usd"` //валюта цен в файле
+}
+
+// Rollups свёртка price_history в минутные, часовые и дневные таблицы и срок хранения каждого уровня.
+// Срок 0 - хранить всегда. Цены, ещё не свёрнутые в следующий уровень, не удаляются
+type Rollups struct {
+	Enabled   bool          `yaml:"enabled"`
+	Interval  time.Duration `yaml:"interval" env-default:"1m"` //как часто сворачивать новые цены и чистить старые
+	Grace     time.Duration `yaml:"grace" env-default:"15m"`   //насколько назад пересчитывать уже свёрнутое: время цены ставит провайдер, и она может прийти позже
+	Retention Retention     `yaml:"retention"`
+}
+
+type Retention struct {
+	Raw    time.Duration `yaml:"raw" env-default:"168h"`
+	Minute time.Duration `yaml:"minute" env-default:"720h"`
+	Hour   time.Duration `yaml:"hour" env-default:"8760h"`
+	Day    time.Duration `yaml:"day" env-default:"0"`
+}
+
+type Consensus struct {
+	Method       string  `yaml:"method" env-default:"median"` //median, trimmed_mean
+	TrimPercent  float64 `yaml:"trim_percent" env-default:"10"`
+	MaxDeviation float64 `yaml:"max_deviation" env-default:"5"` //в процентах от медианы, 0 - не отбрасывать
+	MinQuotes    int     `yaml:"min_quotes" env-default:"1"`
+}
+
+// Breaker предохранитель, который перестаёт дёргать упавшего провайдера
+type Breaker struct {
+	FailureThreshold int           `yaml:"failure_threshold" env-default:"5"` //ошибок подряд до открытия, 0 - выключен
+	OpenTimeout      time.Duration `yaml:"open_timeout" env-default:"1m"`     //сколько провайдер отдыхает перед пробным запросом
+	HalfOpenCalls    int           `yaml:"half_open_calls" env-default:"1"`   //пробных запросов одновременно
+}
+
+type Providers struct {
+	Order     []string  `yaml:"order" env-default:"coingecko"` //провайдеры в порядке приоритета: coingecko, binance_ws, replay
+	Mode      string    `yaml:"mode" env-default:"failover"`   //failover, consensus
+	Consensus Consensus `yaml:"consensus"`
+	Breaker   Breaker   `yaml:"breaker"`
+}
+
+// Currencies валюты котировки, в конфиге можно указать строкой "usd", "usd,eur" или списком ["usd", "eur"].
+// Первая валюта считается валютой по умолчанию
+type Currencies []string
+
+func (c *Currencies) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return c.SetValue(value.Value)
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	return c.SetValue(strings.Join(list, ","))
+}
+
+// SetValue нужен cleanenv для env-default и переменных окружения
+func (c *Currencies) SetValue(value string) error {
+	*c = (*c)[:0]
+	for _, currency := range strings.Split(value, ",") {
+		currency = strings.ToLower(strings.TrimSpace(currency))
+		if currency != "" && !slices.Contains(*c, currency) {
+			*c = append(*c, currency)
+		}
+	}
+	if len(*c) == 0 {
+		return fmt.Errorf("at least one currency is required")
+	}
+	return nil
+}
+
+func (c Currencies) Default() string {
+	if len(c) == 0 {
+		return "usd"
+	}
+	return c[0]
+}
+
+func (c Currencies) String() string {
+	return strings.Join(c, ",")
+}
+
 type Config struct {
 	Env          string       `yaml:"env"`
 	DB           DB           `yaml:"postgres_db"`
 	Rest         Rest         `yaml:"RestServer"`
 	Log          Log          `yaml:"logger"`
 	CoinsWatcher CoinsWatcher `yaml:"coins_watcher"`
+	Providers    Providers    `yaml:"providers"`
+	CoinGecko    CoinGecko    `yaml:"coingecko"`
+	Stream       Stream       `yaml:"stream"`
+	FX           FX           `yaml:"fx"`
+	Replay       Replay       `yaml:"replay"`
+	Rollups      Rollups      `yaml:"rollups"`
 }
 
 func MustLoad() *Config {
@@ -57,6 +269,11 @@ func MustLoad() *Config {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = cfg.CoinGecko.applyPlan()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.FX.Base = strings.ToLower(cfg.FX.Base)
 
 	//cfg.CoinsWatcher.Cooldown = time.Duration(cfg.CoinsWatcher.CooldownInt) * time.Second
 	//cfg.CoinsWatcher.Timeout = time.Duration(cfg.CoinsWatcher.TimeoutInt) * time.Second
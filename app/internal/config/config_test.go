@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPlanLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       CoinGecko
+		wantCalls int
+		wantBurst int
+	}{
+		{name: "public", cfg: CoinGecko{Plan: "public"}, wantCalls: 10, wantBurst: 3},
+		{name: "demo", cfg: CoinGecko{Plan: "demo", APIKey: "key"}, wantCalls: 30, wantBurst: 5},
+		{name: "pro", cfg: CoinGecko{Plan: "pro", APIKey: "key"}, wantCalls: 500, wantBurst: 20},
+		{name: "plan in upper case", cfg: CoinGecko{Plan: "PRO", APIKey: "key"}, wantCalls: 500, wantBurst: 20},
+		//явно заданные лимиты важнее тарифа
+		{name: "explicit limits", cfg: CoinGecko{Plan: "pro", APIKey: "key", CallsPerMinute: 100, Burst: 1}, wantCalls: 100, wantBurst: 1},
+		{name: "explicit calls only", cfg: CoinGecko{Plan: "demo", APIKey: "key", CallsPerMinute: 15}, wantCalls: 15, wantBurst: 5},
+		{name: "unlimited", cfg: CoinGecko{Plan: "public", CallsPerMinute: -1}, wantCalls: -1, wantBurst: 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			if err := cfg.applyPlan(); err != nil {
+				t.Fatalf("applyPlan: %v", err)
+			}
+			if cfg.CallsPerMinute != tc.wantCalls || cfg.Burst != tc.wantBurst {
+				t.Errorf("limits = %d/%d, want %d/%d", cfg.CallsPerMinute, cfg.Burst, tc.wantCalls, tc.wantBurst)
+			}
+			if cfg.Plan != strings.ToLower(tc.cfg.Plan) {
+				t.Errorf("plan = %q, want it lower cased", cfg.Plan)
+			}
+		})
+	}
+}
+
+func TestApplyPlanErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  CoinGecko
+	}{
+		{name: "unknown plan", cfg: CoinGecko{Plan: "enterprise", APIKey: "key"}},
+		{name: "demo without key", cfg: CoinGecko{Plan: "demo"}},
+		{name: "pro without key", cfg: CoinGecko{Plan: "pro"}},
+		{name: "missing key file", cfg: CoinGecko{Plan: "pro", APIKeyFile: filepath.Join(t.TempDir(), "missing")}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			if err := cfg.applyPlan(); err == nil {
+				t.Errorf("expected error, got limits %d/%d", cfg.CallsPerMinute, cfg.Burst)
+			}
+		})
+	}
+}
+
+func TestApplyPlanKeyFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coingecko_key")
+	if err := os.WriteFile(path, []byte("  file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CoinGecko{Plan: "pro", APIKeyFile: path}
+	if err := cfg.applyPlan(); err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	if cfg.APIKey != "file-key" {
+		t.Errorf("api key = %q, want the trimmed file contents", string(cfg.APIKey))
+	}
+
+	//ключ из переменной окружения или конфига важнее файла
+	cfg = CoinGecko{Plan: "pro", APIKey: "env-key", APIKeyFile: path}
+	if err := cfg.applyPlan(); err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	if cfg.APIKey != "env-key" {
+		t.Errorf("api key = %q, want env-key", string(cfg.APIKey))
+	}
+}
+
+func TestSecretIsRedacted(t *testing.T) {
+	const key = "super-secret-key"
+	cfg := CoinGecko{Plan: "pro", APIKey: key}
+
+	outputs := map[string]string{
+		"%s":  fmt.Sprintf("%s", cfg.APIKey),
+		"%v":  fmt.Sprintf("%v", cfg.APIKey),
+		"%#v": fmt.Sprintf("%#v", cfg.APIKey),
+		"%+v": fmt.Sprintf("%+v", cfg),
+	}
+
+	var logged bytes.Buffer
+	slog.New(slog.NewTextHandler(&logged, nil)).Info("config", "key", cfg.APIKey)
+	outputs["slog"] = logged.String()
+
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	outputs["json"] = string(encoded)
+
+	for name, out := range outputs {
+		if strings.Contains(out, key) {
+			t.Errorf("%s leaks the key: %s", name, out)
+		}
+		if !strings.Contains(out, "[REDACTED]") {
+			t.Errorf("%s has no placeholder: %s", name, out)
+		}
+	}
+}
+
+func TestEmptySecret(t *testing.T) {
+	var secret Secret
+	if got := fmt.Sprintf("%s|%#v", secret, secret); got != "|" {
+		t.Errorf("empty secret printed as %q", got)
+	}
+	encoded, err := json.Marshal(secret)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(encoded) != `""` {
+		t.Errorf("empty secret encoded as %s", encoded)
+	}
+}
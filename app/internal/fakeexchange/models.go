@@ -0,0 +1,32 @@
+package fakeexchange
+
+// стартовые цены пар, в которых котируется фейковая биржа
+var startPrices = map[string]float64{
+	"btcusdt":  97000,
+	"ethusdt":  3300,
+	"bnbusdt":  690,
+	"solusdt":  190,
+	"xrpusdt":  2.4,
+	"usdcusdt": 1,
+	"adausdt":  0.95,
+	"dogeusdt": 0.33,
+	"trxusdt":  0.25,
+}
+
+// сколько монет за сутки проходит через пару, для объёма в тикере
+const dailyVolume = 25000
+
+type command struct {
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+	ID     int64    `json:"id"`
+}
+
+type ticker struct {
+	Event     string `json:"e"`
+	EventTime int64  `json:"E"`
+	Symbol    string `json:"s"`
+	Price     string `json:"c"`
+	Change    string `json:"P"`
+	Volume    string `json:"q"`
+}
@@ -0,0 +1,130 @@
+package fakeexchange
+
+import (
+	"encoding/json"
+	"golang.org/x/net/websocket"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server имитирует websocket стрим тикеров Binance (/ws): принимает SUBSCRIBE/UNSUBSCRIBE
+// и раз в interval шлёт событие 24hrTicker по каждой подписке, цена каждый раз сдвигается случайным шагом.
+// Если dropAfter больше нуля, соединение рвётся через это время, чтобы проверять переподключение
+type Server struct {
+	interval  time.Duration
+	dropAfter time.Duration
+	mu        sync.Mutex
+	rnd       *rand.Rand
+	prices    map[string]float64
+	ws        websocket.Server
+}
+
+func NewServer(interval, dropAfter time.Duration, seed int64) *Server {
+	s := &Server{
+		interval:  interval,
+		dropAfter: dropAfter,
+		rnd:       rand.New(rand.NewSource(seed)),
+		prices:    make(map[string]float64, len(startPrices)),
+	}
+	for symbol, price := range startPrices {
+		s.prices[symbol] = price
+	}
+	//Origin не проверяется, клиенты не браузерные
+	s.ws = websocket.Server{Handler: s.serveConn}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ws" {
+		http.NotFound(w, r)
+		return
+	}
+	s.ws.ServeHTTP(w, r)
+}
+
+func (s *Server) serveConn(ws *websocket.Conn) {
+	var (
+		mu      sync.Mutex
+		streams = make(map[string]bool)
+		done    = make(chan struct{})
+	)
+	go func() { //команды клиента
+		defer close(done)
+		for {
+			var cmd command
+			if err := websocket.JSON.Receive(ws, &cmd); err != nil {
+				return
+			}
+			mu.Lock()
+			for _, stream := range cmd.Params {
+				switch strings.ToUpper(cmd.Method) {
+				case "SUBSCRIBE":
+					streams[stream] = true
+				case "UNSUBSCRIBE":
+					delete(streams, stream)
+				}
+			}
+			mu.Unlock()
+			websocket.JSON.Send(ws, json.RawMessage(`{"result":null,"id":`+strconv.FormatInt(cmd.ID, 10)+`}`))
+		}
+	}()
+
+	var drop <-chan time.Time
+	if s.dropAfter > 0 {
+		drop = time.After(s.dropAfter)
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-drop:
+			return
+		case <-ticker.C:
+		}
+		mu.Lock()
+		symbols := make([]string, 0, len(streams))
+		for stream := range streams {
+			symbol, ok := strings.CutSuffix(stream, "@ticker")
+			if ok {
+				symbols = append(symbols, symbol)
+			}
+		}
+		mu.Unlock()
+		for _, symbol := range symbols {
+			event, ok := s.nextTicker(symbol)
+			if !ok {
+				continue
+			}
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// сдвигает цену пары максимум на 0.5% и собирает событие тикера
+func (s *Server) nextTicker(symbol string) (ticker, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, ok := s.prices[symbol]
+	if !ok {
+		return ticker{}, false
+	}
+	price *= 1 + (s.rnd.Float64()*2-1)*0.005
+	s.prices[symbol] = price
+	open := startPrices[symbol]
+	return ticker{
+		Event:     "24hrTicker",
+		EventTime: time.Now().UnixMilli(),
+		Symbol:    strings.ToUpper(symbol),
+		Price:     strconv.FormatFloat(price, 'f', -1, 64),
+		Change:    strconv.FormatFloat((price-open)/open*100, 'f', 3, 64),
+		Volume:    strconv.FormatFloat(price*dailyVolume, 'f', 2, 64),
+	}, true
+}
@@ -0,0 +1,91 @@
+package fakegecko
+
+const (
+	ModeDeterministic = "deterministic"
+	ModeRandomWalk    = "random_walk"
+)
+
+type coinInfo struct {
+	ID        string            `json:"id"`
+	Symbol    string            `json:"symbol"`
+	Name      string            `json:"name"`
+	price     float64           //стартовая цена в долларах
+	supply    float64           //для капитализации в /coins/markets
+	platforms map[string]string //сеть -> адрес контракта токена
+	genesis   string            //дата запуска для /coins/{id}, у многих монет её нет
+}
+
+// набор монет, который отдаёт фейковый /coins/list
+var knownCoins = []coinInfo{
+	{ID: "bitcoin", Symbol: "btc", Name: "Bitcoin", price: 97000, supply: 19800000, genesis: "2009-01-03"},
+	{ID: "ethereum", Symbol: "eth", Name: "Ethereum", price: 3300, supply: 120500000, genesis: "2015-07-30"},
+	{ID: "tether", Symbol: "usdt", Name: "Tether", price: 1, supply: 138000000000,
+		platforms: map[string]string{"ethereum": "0xdac17f958d2ee523a2206206994597c13d831ec7", "tron": "tr7nhqjekqxgtci8q8zy4pl8otszgjlj6t"}},
+	{ID: "binancecoin", Symbol: "bnb", Name: "BNB", price: 690, supply: 144000000},
+	{ID: "solana", Symbol: "sol", Name: "Solana", price: 190, supply: 487000000},
+	{ID: "ripple", Symbol: "xrp", Name: "XRP", price: 2.4, supply: 57600000000},
+	{ID: "usd-coin", Symbol: "usdc", Name: "USDC", price: 1, supply: 45000000000,
+		platforms: map[string]string{"ethereum": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "solana": "epjfwdd5aufqssqem2qn1xzybapc8g4weggkzwytdt1v"}},
+	{ID: "cardano", Symbol: "ada", Name: "Cardano", price: 0.95, supply: 35100000000},
+	{ID: "dogecoin", Symbol: "doge", Name: "Dogecoin", price: 0.33, supply: 147000000000},
+	{ID: "tron", Symbol: "trx", Name: "TRON", price: 0.25, supply: 86200000000},
+	//монеты с повторяющимися символами, чтобы проверять выбор по капитализации
+	{ID: "ethereum-wormhole", Symbol: "eth", Name: "Ethereum (Wormhole)", price: 3300, supply: 12000},
+	{ID: "bridged-tether-fuse", Symbol: "usdt", Name: "Fuse Bridged USDT", price: 1, supply: 250000,
+		platforms: map[string]string{"fuse": "0xfadbbf8ce7d5b7041be672561bba99f79c532e10"}},
+}
+
+type market struct {
+	ID           string  `json:"id"`
+	Symbol       string  `json:"symbol"`
+	Name         string  `json:"name"`
+	CurrentPrice float64 `json:"current_price"`
+	MarketCap    float64 `json:"market_cap"`
+}
+
+// ответ /coins/{id}, только поля, которые читает провайдер
+type coinDetails struct {
+	ID            string            `json:"id"`
+	Symbol        string            `json:"symbol"`
+	Name          string            `json:"name"`
+	Categories    []string          `json:"categories"`
+	Image         map[string]string `json:"image"`
+	GenesisDate   *string           `json:"genesis_date"`
+	MarketCapRank *int              `json:"market_cap_rank"`
+	Platforms     map[string]string `json:"platforms"`
+}
+
+// ответ /coins/{platform}/contract/{address}, только поля, которые читает провайдер
+type contractInfo struct {
+	ID              string            `json:"id"`
+	Symbol          string            `json:"symbol"`
+	Name            string            `json:"name"`
+	AssetPlatformID string            `json:"asset_platform_id"`
+	ContractAddress string            `json:"contract_address"`
+	Platforms       map[string]string `json:"platforms"`
+}
+
+type exchangeRate struct {
+	Name  string  `json:"name"`
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+	Type  string  `json:"type"`
+}
+
+type marketChart struct {
+	Prices       [][]float64 `json:"prices"`
+	MarketCaps   [][]float64 `json:"market_caps"`
+	TotalVolumes [][]float64 `json:"total_volumes"`
+}
+
+// доля капитализации, которая торгуется за сутки
+const dailyTurnover = 0.03
+
+// курсы фиатных валют к доллару для vs_currencies
+var currencyRates = map[string]float64{
+	"usd": 1,
+	"eur": 0.92,
+	"gbp": 0.79,
+	"jpy": 151.3,
+	"rub": 92.5,
+}
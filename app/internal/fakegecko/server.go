@@ -0,0 +1,307 @@
+package fakegecko
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server имитирует часть API CoinGecko (/coins/list, /simple/price, цены токенов по контракту) без выхода в сеть.
+// В режиме deterministic цена зависит только от id монеты, в режиме random_walk
+// каждый запрос сдвигает цену случайным шагом от предыдущей.
+// last_updated_at в deterministic режиме - время запуска сервера, ведь цена с тех пор не менялась
+type Server struct {
+	mode    string
+	started time.Time
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	prices  map[string]float64
+	mux     *http.ServeMux
+}
+
+func NewServer(mode string, seed int64) *Server {
+	s := &Server{
+		mode:    mode,
+		started: time.Now(),
+		rnd:     rand.New(rand.NewSource(seed)),
+		prices:  make(map[string]float64, len(knownCoins)),
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/coins/list", s.coinsList)
+	s.mux.HandleFunc("/simple/price", s.simplePrice)
+	s.mux.HandleFunc("/coins/markets", s.coinsMarkets)
+	s.mux.HandleFunc("/coins/{id}", s.coinDetails)
+	s.mux.HandleFunc("/coins/{id}/market_chart/range", s.marketChartRange)
+	s.mux.HandleFunc("/coins/{platform}/contract/{address}", s.contractInfo)
+	s.mux.HandleFunc("/simple/token_price/{platform}", s.tokenPrice)
+	s.mux.HandleFunc("/exchange_rates", s.exchangeRates)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) coinsList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, knownCoins)
+}
+
+func (s *Server) simplePrice(w http.ResponseWriter, r *http.Request) {
+	ids := splitParam(r.URL.Query().Get("ids"))
+	currencies := splitParam(r.URL.Query().Get("vs_currencies"))
+	if len(ids) == 0 || len(currencies) == 0 {
+		http.Error(w, `{"error":"missing 'ids' or 'vs_currencies'"}`, http.StatusBadRequest)
+		return
+	}
+
+	resp := make(map[string]map[string]float64, len(ids))
+	for _, id := range ids {
+		coin, ok := findCoin(id)
+		if !ok {
+			continue
+		}
+		resp[id] = s.priceValues(coin, currencies, r)
+	}
+	writeJSON(w, resp)
+}
+
+// как и coingecko, ответ ключуется адресами контрактов в нижнем регистре, неизвестные адреса пропускаются
+func (s *Server) tokenPrice(w http.ResponseWriter, r *http.Request) {
+	platform := strings.ToLower(r.PathValue("platform"))
+	addresses := splitParam(r.URL.Query().Get("contract_addresses"))
+	currencies := splitParam(r.URL.Query().Get("vs_currencies"))
+	if len(addresses) == 0 || len(currencies) == 0 {
+		http.Error(w, `{"error":"missing 'contract_addresses' or 'vs_currencies'"}`, http.StatusBadRequest)
+		return
+	}
+
+	resp := make(map[string]map[string]float64, len(addresses))
+	for _, address := range addresses {
+		coin, ok := findContract(platform, address)
+		if !ok {
+			continue
+		}
+		resp[address] = s.priceValues(coin, currencies, r)
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) contractInfo(w http.ResponseWriter, r *http.Request) {
+	platform := strings.ToLower(r.PathValue("platform"))
+	address := strings.ToLower(r.PathValue("address"))
+	coin, ok := findContract(platform, address)
+	if !ok {
+		http.Error(w, `{"error":"coin not found"}`, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, contractInfo{
+		ID:              coin.ID,
+		Symbol:          coin.Symbol,
+		Name:            coin.Name,
+		AssetPlatformID: platform,
+		ContractAddress: address,
+		Platforms:       coin.platforms,
+	})
+}
+
+// курсы относительно btc, как у coingecko. Фиатные курсы постоянные, меняется только цена btc
+func (s *Server) exchangeRates(w http.ResponseWriter, r *http.Request) {
+	btc, _ := findCoin("bitcoin")
+	usd := s.price(btc)
+	rates := map[string]exchangeRate{
+		"btc": {Name: "Bitcoin", Unit: "BTC", Value: 1, Type: "crypto"},
+	}
+	for currency, rate := range currencyRates {
+		rates[currency] = exchangeRate{Name: strings.ToUpper(currency), Unit: currency, Value: usd * rate, Type: "fiat"}
+	}
+	writeJSON(w, map[string]any{"rates": rates})
+}
+
+// цены монеты по валютам вместе с рыночными данными, которые попросили в запросе
+func (s *Server) priceValues(coin coinInfo, currencies []string, r *http.Request) map[string]float64 {
+	query := r.URL.Query()
+	usd := s.price(coin)
+	values := make(map[string]float64, len(currencies))
+	for _, currency := range currencies {
+		rate, ok := currencyRates[currency]
+		if !ok {
+			continue
+		}
+		values[currency] = usd * rate
+		if query.Get("include_market_cap") == "true" {
+			values[currency+"_market_cap"] = usd * rate * coin.supply
+		}
+		if query.Get("include_24hr_vol") == "true" {
+			values[currency+"_24h_vol"] = usd * rate * coin.supply * dailyTurnover
+		}
+		if query.Get("include_24hr_change") == "true" {
+			values[currency+"_24h_change"] = (usd/coin.price - 1) * 100
+		}
+	}
+	if query.Get("include_last_updated_at") == "true" {
+		values["last_updated_at"] = float64(s.lastUpdated().Unix())
+	}
+	return values
+}
+
+func (s *Server) coinsMarkets(w http.ResponseWriter, r *http.Request) {
+	rate, ok := currencyRates[strings.ToLower(r.URL.Query().Get("vs_currency"))]
+	if !ok {
+		http.Error(w, `{"error":"invalid vs_currency"}`, http.StatusBadRequest)
+		return
+	}
+
+	ids := splitParam(r.URL.Query().Get("ids"))
+	resp := make([]market, 0, len(ids))
+	for _, id := range ids {
+		coin, ok := findCoin(id)
+		if !ok {
+			continue
+		}
+		price := s.price(coin) * rate
+		resp = append(resp, market{
+			ID:           coin.ID,
+			Symbol:       coin.Symbol,
+			Name:         coin.Name,
+			CurrentPrice: price,
+			MarketCap:    price * coin.supply,
+		})
+	}
+	writeJSON(w, resp)
+}
+
+// ранг по капитализации считается по стартовым ценам, у мостовых монет ранга нет, как и у мелких монет coingecko
+func (s *Server) coinDetails(w http.ResponseWriter, r *http.Request) {
+	coin, ok := findCoin(r.PathValue("id"))
+	if !ok {
+		http.Error(w, `{"error":"coin not found"}`, http.StatusNotFound)
+		return
+	}
+
+	categories := []string{"Cryptocurrency"}
+	if len(coin.platforms) > 0 {
+		categories = append(categories, "Stablecoins")
+	}
+	image := "https://assets.fakegecko.local/coins/" + coin.ID + ".png"
+	details := coinDetails{
+		ID:         coin.ID,
+		Symbol:     coin.Symbol,
+		Name:       coin.Name,
+		Categories: categories,
+		Image:      map[string]string{"thumb": image, "small": image, "large": image},
+		Platforms:  coin.platforms,
+	}
+	if coin.genesis != "" {
+		details.GenesisDate = &coin.genesis
+	}
+	if coin.supply > 1e6 {
+		rank := 1
+		for _, other := range knownCoins {
+			if other.supply > 1e6 && other.price*other.supply > coin.price*coin.supply {
+				rank++
+			}
+		}
+		details.MarketCapRank = &rank
+	}
+	writeJSON(w, details)
+}
+
+// история строится детерминированно от стартовой цены: плавная волна с периодом в неделю
+func (s *Server) marketChartRange(w http.ResponseWriter, r *http.Request) {
+	coin, ok := findCoin(r.PathValue("id"))
+	if !ok {
+		http.Error(w, `{"error":"coin not found"}`, http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	rate, ok := currencyRates[strings.ToLower(query.Get("vs_currency"))]
+	from, errFrom := strconv.ParseInt(query.Get("from"), 10, 64)
+	to, errTo := strconv.ParseInt(query.Get("to"), 10, 64)
+	if !ok || errFrom != nil || errTo != nil || from > to {
+		http.Error(w, `{"error":"invalid vs_currency, from or to"}`, http.StatusBadRequest)
+		return
+	}
+
+	step := int64(time.Hour / time.Second)
+	if to-from > 90*24*step { //как и coingecko: больше 90 дней - точки по дням
+		step *= 24
+	}
+	chart := marketChart{Prices: [][]float64{}, MarketCaps: [][]float64{}, TotalVolumes: [][]float64{}}
+	for ts := from - from%step + step; ts <= to; ts += step {
+		price := coin.price * rate * (1 + 0.05*math.Sin(float64(ts)/float64(7*24*time.Hour/time.Second)*2*math.Pi))
+		ms := float64(ts * 1000)
+		chart.Prices = append(chart.Prices, []float64{ms, price})
+		chart.MarketCaps = append(chart.MarketCaps, []float64{ms, price * coin.supply})
+		chart.TotalVolumes = append(chart.TotalVolumes, []float64{ms, price * coin.supply * dailyTurnover})
+	}
+	writeJSON(w, chart)
+}
+
+// цена монеты в долларах с учётом режима
+func (s *Server) price(coin coinInfo) float64 {
+	if s.mode != ModeRandomWalk {
+		return coin.price
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.prices[coin.ID]
+	if !ok {
+		last = coin.price
+	}
+	last *= 1 + (s.rnd.Float64()-0.5)/50 //шаг не больше 1% в любую сторону
+	s.prices[coin.ID] = last
+	return last
+}
+
+func (s *Server) lastUpdated() time.Time {
+	if s.mode != ModeRandomWalk {
+		return s.started
+	}
+	return time.Now()
+}
+
+func findCoin(id string) (coinInfo, bool) {
+	for _, coin := range knownCoins {
+		if coin.ID == id {
+			return coin, true
+		}
+	}
+	return coinInfo{}, false
+}
+
+func findContract(platform, address string) (coinInfo, bool) {
+	if address == "" {
+		return coinInfo{}, false
+	}
+	for _, coin := range knownCoins {
+		if coin.platforms[platform] == address {
+			return coin, true
+		}
+	}
+	return coinInfo{}, false
+}
+
+func splitParam(param string) []string {
+	if param == "" {
+		return nil
+	}
+	parts := strings.Split(strings.ToLower(param), ",")
+	res := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			res = append(res, part)
+		}
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}